@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"go.uber.org/zap"
+
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/services"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/storage"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/config"
+)
+
+/*
+runExport - подкоманда export: выгрузка всех ссылок настроенного хранилища в NDJSON.
+shortener -d <dsn> export [--out links.ndjson], без --out ссылки пишутся в stdout
+*/
+func runExport(ctx context.Context, log *zap.SugaredLogger, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	out := fs.String("out", "", "output file, stdout by default")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("can't create export file, err: %s", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	repository, err := storage.NewStorage(ctx, log, cfg)
+	if err != nil {
+		return err
+	}
+	defer repository.Close()
+
+	count, err := services.ExportLinks(ctx, repository, w)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("exported %d links", count)
+
+	return nil
+}
+
+/*
+runImport - подкоманда import: загрузка ссылок из NDJSON в настроенное хранилище.
+shortener -d <dsn> import [--in links.ndjson] [--dry-run] [--on-conflict skip|overwrite|fail], без --in ссылки читаются из stdin.
+Отчёт об импорте пишется в stdout в формате JSON
+*/
+func runImport(ctx context.Context, log *zap.SugaredLogger, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	in := fs.String("in", "", "input file, stdin by default")
+	dryRun := fs.Bool("dry-run", false, "validate records and report the result without changing the storage")
+	onConflict := fs.String("on-conflict", services.ConflictSkip, "conflict policy: skip, overwrite or fail")
+	batch := fs.Int("batch", 500, "links per batch")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return fmt.Errorf("can't open import file, err: %s", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	repository, err := storage.NewStorage(ctx, log, cfg)
+	if err != nil {
+		return err
+	}
+	defer repository.Close()
+
+	report, err := services.ImportLinks(ctx, repository, r, services.ImportLinksOptions{
+		OnConflict: *onConflict,
+		DryRun:     *dryRun,
+		BatchSize:  *batch,
+	})
+	if report != nil {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if errEnc := encoder.Encode(report); errEnc != nil {
+			log.Errorf("can't write import report, err: %s", errEnc)
+		}
+	}
+
+	return err
+}
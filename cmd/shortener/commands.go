@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/storage"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/config"
+)
+
+// runCommand - выполнение подкоманды вместо запуска сервера, подкоманда передаётся после флагов: shortener -d <dsn> migrate up
+func runCommand(ctx context.Context, log *zap.SugaredLogger, cfg *config.Config, args []string) error {
+	switch args[0] {
+	case "migrate":
+		return runMigrate(ctx, log, cfg, args[1:])
+	case "transfer":
+		return runTransfer(ctx, log, cfg, args[1:])
+	case "export":
+		return runExport(ctx, log, cfg, args[1:])
+	case "import":
+		return runImport(ctx, log, cfg, args[1:])
+	default:
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+}
+
+// runMigrate - подкоманда migrate: применение, откат и просмотр состояния миграций PostgreSQL
+func runMigrate(ctx context.Context, log *zap.SugaredLogger, cfg *config.Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: shortener migrate %s", strings.Join(storage.MigrateCommands, "|"))
+	}
+
+	if cfg.DB.CDN == "" {
+		return errors.New("database DSN is not set, use -d flag or DATABASE_DSN environment")
+	}
+
+	return storage.Migrate(ctx, log, cfg.DB.CDN, args[0])
+}
@@ -3,6 +3,11 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
 
 	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/handlers"
 	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/server"
@@ -15,7 +20,9 @@ import (
 const configURL = "internal/config/config.yml"
 
 func main() {
-	ctx := context.Background()
+	// контекст отменяется по сигналу остановки, подкоманды и сервер завершаются штатно
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer stop()
 
 	fl := config.GetFlags()
 	flag.Parse()
@@ -23,13 +30,82 @@ func main() {
 	log := logger.InitLogger()
 	cfg := config.GetConfig(log, configURL, fl)
 
-	repository := storage.NewStorage(ctx, log, cfg)
-	defer func() {
-		if err := repository.Close(); err != nil {
+	// подкоманды (migrate) выполняются вместо запуска сервера
+	if flag.NArg() > 0 {
+		if err := runCommand(ctx, log, cfg, flag.Args()); err != nil {
 			log.Fatal(err.Error())
 		}
+		return
+	}
+
+	if err := runServer(ctx, log, cfg); err != nil {
+		log.Fatal(err.Error())
+	}
+}
+
+/*
+runServer - запуск сервера до сигнала остановки или ошибки сервера. Остановка идёт в обратном порядке:
+сервер дорабатывает активные запросы, сервис дожидается фоновых воркеров, затем закрывается хранилище
+*/
+func runServer(ctx context.Context, log *zap.SugaredLogger, cfg *config.Config) (err error) {
+	repository, err := storage.NewStorage(ctx, log, cfg)
+	if err != nil {
+		return err
+	}
+	// кеш ссылок для переходов включается ненулевым размером
+	if cfg.App.Cache.Size > 0 {
+		repository = storage.NewCachedStorage(log, cfg, repository)
+	}
+	defer func() {
+		if errClose := repository.Close(); errClose != nil && err == nil {
+			err = fmt.Errorf("can't close storage, err: %s", errClose)
+		}
 	}()
+
 	ServiceURL := services.NewServiceURL(log, cfg, repository)
+	defer ServiceURL.Close()
+
 	handler := handlers.NewHandler(log, cfg, ServiceURL)
-	server.HTTPServerStart(log, cfg, handler.InitRoutes())
+	srv := server.NewServer(log, cfg, listeners(cfg, handler)...)
+	if err = srv.Start(); err != nil {
+		return err
+	}
+
+	// при ошибке одного адреса остальные тоже останавливаются до закрытия сервиса и хранилища
+	var errServe error
+	select {
+	case <-ctx.Done():
+		log.Info("shutdown signal received")
+	case errServe = <-srv.Done():
+		log.Errorf("server stopped unexpectedly, err: %s", errServe)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), server.ShutdownTimeout(cfg))
+	defer cancel()
+
+	if err = srv.Shutdown(shutdownCtx); errServe != nil {
+		return fmt.Errorf("server stopped unexpectedly, err: %s", errServe)
+	}
+
+	return err
+}
+
+/*
+listeners - адреса сервера: без отдельного адреса API все маршруты обслуживаются на основном адресе,
+иначе на основном остаются только переходы по коротким ссылкам, а API и внутренние эндпоинты обслуживаются отдельно
+*/
+func listeners(cfg *config.Config, handler *handlers.Handler) []server.Listener {
+	if cfg.Server.APIAddress == "" {
+		return []server.Listener{{Name: "public", Address: cfg.Server.Address, Handler: handler.InitRoutes()}}
+	}
+
+	res := []server.Listener{
+		{Name: "public", Address: cfg.Server.Address, Handler: handler.RedirectRoutes()},
+		{Name: "api", Address: cfg.Server.APIAddress, Handler: handler.APIRoutes(cfg.Server.InternalAddress == "")},
+	}
+	if cfg.Server.InternalAddress != "" {
+		res = append(res, server.Listener{Name: "internal", Address: cfg.Server.InternalAddress, Handler: handler.InternalRoutes()})
+	}
+
+	return res
 }
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/services"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/storage"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/config"
+)
+
+/*
+runTransfer - подкоманда transfer: перенос всех ссылок из одного хранилища в другое.
+shortener transfer --from file:/path --to postgres://... [--batch 500] [--state transfer.state]
+Если задан --state, то после каждой пачки в файл пишется ID последней перенесённой ссылки,
+и повторный запуск с тем же файлом продолжает перенос с этого места
+*/
+func runTransfer(ctx context.Context, log *zap.SugaredLogger, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("transfer", flag.ContinueOnError)
+	from := fs.String("from", "", "source storage DSN (file:<path>, postgres://..., memory:)")
+	to := fs.String("to", "", "destination storage DSN (file:<path>, postgres://..., memory:)")
+	batch := fs.Int("batch", 500, "links per batch")
+	state := fs.String("state", "", "checkpoint file to resume an interrupted transfer")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *from == "" || *to == "" {
+		return errors.New("usage: shortener transfer --from <dsn> --to <dsn> [--batch n] [--state file]")
+	}
+
+	if *from == *to {
+		return errors.New("source and destination storages must differ")
+	}
+
+	after, err := readTransferState(*state)
+	if err != nil {
+		return err
+	}
+
+	if after != "" {
+		log.Infof("resuming transfer after id %s", after)
+	}
+
+	source, err := storage.NewStorageFromDSN(ctx, log, cfg, *from)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	destination, err := storage.NewStorageFromDSN(ctx, log, cfg, *to)
+	if err != nil {
+		return err
+	}
+	defer destination.Close()
+
+	progress, err := services.Transfer(ctx, source, destination, services.TransferOptions{
+		After:     after,
+		BatchSize: *batch,
+		OnBatch: func(progress services.TransferProgress) error {
+			log.Infof("transferred up to id %s: created %d, existed %d, conflicts %d",
+				progress.Last, progress.Created, progress.Existed, len(progress.Conflicts))
+
+			return writeTransferState(*state, progress.Last)
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(progress.Conflicts) > 0 {
+		log.Warnf("links not transferred because id or URL is taken in destination: %s", strings.Join(progress.Conflicts, ", "))
+	}
+
+	log.Infof("transfer finished: created %d, existed %d, conflicts %d",
+		progress.Created, progress.Existed, len(progress.Conflicts))
+
+	return nil
+}
+
+// readTransferState - чтение ID последней перенесённой ссылки из файла состояния, пустая строка - перенос с начала
+func readTransferState(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("can't read transfer state, err: %s", err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// writeTransferState - запись ID последней перенесённой ссылки в файл состояния через временный файл, чтобы не оставить его обрезанным
+func writeTransferState(path, last string) error {
+	if path == "" {
+		return nil
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(last+"\n"), 0o644); err != nil {
+		return fmt.Errorf("can't write transfer state, err: %s", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("can't write transfer state, err: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/services"
+)
+
+// AdminMiddleware - middleware доступа к административным эндпоинтам по токену из заголовка Authorization: Bearer <token>.
+// Без настроенного токена эндпоинты отключены и отвечают 404
+func (h *Handler) AdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := h.cfg.App.AdminToken
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, "invalid admin token", http.StatusUnauthorized)
+			h.log.Warnf("invalid admin token from %s", r.RemoteAddr)
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// adminExport - функция-хэндлер выгрузки всех ссылок в формате NDJSON, отслеживаемый путь: "/admin/export"
+func (h *Handler) adminExport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	// после начала выгрузки код ответа уже не поменять, ошибка только логируется, а ответ обрывается
+	count, err := h.service.Export(r.Context(), w)
+	if err != nil {
+		h.log.Errorf("export failed after %d links, err: %s", count, err)
+		return
+	}
+
+	h.log.Infof("exported %d links", count)
+}
+
+/*
+adminImport - функция-хэндлер загрузки ссылок из NDJSON, отслеживаемый путь: "/admin/import".
+Параметры запроса: dry_run=true - только проверка, on_conflict=skip|overwrite|fail - политика конфликтов.
+В ответ пишется отчёт об импорте, в том числе при прерывании импорта из-за конфликта или невалидной записи
+*/
+func (h *Handler) adminImport(w http.ResponseWriter, r *http.Request) {
+	opts := services.ImportLinksOptions{OnConflict: r.URL.Query().Get("on_conflict")}
+
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		dryRun, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "invalid dry_run value", http.StatusBadRequest)
+			h.log.Errorf("invalid dry_run value %q, err: %s", v, err)
+
+			return
+		}
+		opts.DryRun = dryRun
+	}
+
+	defer r.Body.Close()
+
+	report, err := h.service.Import(r.Context(), r.Body, opts)
+	if report == nil {
+		h.writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	code := http.StatusOK
+	switch {
+	case errors.Is(err, services.ErrImportConflict):
+		code = http.StatusConflict
+	case errors.Is(err, services.ErrInvalidRecord):
+		code = http.StatusUnprocessableEntity
+	case bodyTooLarge(err):
+		code = http.StatusRequestEntityTooLarge
+	case err != nil:
+		code = http.StatusInternalServerError
+	}
+
+	if err != nil {
+		h.log.Errorf("import failed, err: %s", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err = json.NewEncoder(w).Encode(report); err != nil {
+		h.log.Errorf("failed to write response body, err: %s", err)
+	}
+}
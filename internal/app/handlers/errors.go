@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/services"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/storage"
+)
+
+/*
+errorStatuses - соответствие ошибок хранилища и сервиса кодам ответа.
+Для ошибок с detailed в ответ пишется полный текст ошибки, для остальных - только текст самой ошибки из списка
+*/
+var errorStatuses = []struct {
+	err      error
+	code     int
+	detailed bool
+}{
+	{err: storage.ErrNotFound, code: http.StatusNotFound},
+	{err: storage.ErrConflict, code: http.StatusConflict},
+	{err: storage.ErrGone, code: http.StatusGone},
+	{err: storage.ErrUnavailable, code: http.StatusServiceUnavailable},
+	{err: services.ErrLinkNotOwned, code: http.StatusNotFound},
+	{err: services.ErrExpiredInPast, code: http.StatusBadRequest},
+	{err: services.ErrInvalidAlias, code: http.StatusBadRequest, detailed: true},
+	{err: services.ErrServiceStopped, code: http.StatusServiceUnavailable},
+}
+
+/*
+writeError - запись ошибки в ответ. Для известных ошибок хранилища и сервиса код ответа и тело определяются типом ошибки,
+чтобы ответ не зависел от выбранного хранилища. Для остальных ошибок используется переданный код
+*/
+func (h *Handler) writeError(w http.ResponseWriter, err error, code int) {
+	for _, v := range errorStatuses {
+		if errors.Is(err, v.err) {
+			msg := v.err.Error()
+			if v.detailed {
+				msg = err.Error()
+			}
+
+			http.Error(w, msg, v.code)
+			h.log.Error(err)
+
+			return
+		}
+	}
+
+	http.Error(w, err.Error(), code)
+	h.log.Error(err)
+}
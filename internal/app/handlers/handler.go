@@ -6,15 +6,19 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"go.uber.org/zap"
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/models"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/server"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/services"
 	"github.com/kirill-chelyatnikov/shortener-url-service/internal/config"
 	"github.com/kirill-chelyatnikov/shortener-url-service/pkg"
 	"golang.org/x/exp/slices"
@@ -26,11 +30,20 @@ const (
 	APIURL     = "/api/shorten"
 	APIALLURLS = "/api/user/urls"
 	PING       = "/ping"
+	HEALTHZ    = "/healthz"
+	READYZ     = "/readyz"
 	APIBATCH   = "/api/shorten/batch"
+	APISTATS   = "/api/user/urls/{id}/stats"
+
+	ADMINEXPORT = "/admin/export"
+	ADMINIMPORT = "/admin/import"
 )
 
 var CookieKey = []byte("cookie_key_7385746739")
 
+// authCookieLen - длина случайного значения cookie пользователя
+const authCookieLen = 10
+
 var ContentTypesToEncode = []string{
 	"application/javascript",
 	"application/json",
@@ -46,8 +59,13 @@ type Handler struct {
 	service serviceInterface
 }
 
+// APIHandlerRequest - запрос на сокращение ссылки. Срок действия задаётся либо моментом expires_at (RFC 3339),
+// либо длительностью ttl в формате time.ParseDuration ("90m", "24h"). Alias - желаемый ID короткой ссылки
 type APIHandlerRequest struct {
-	URL string `json:"url"`
+	URL       string     `json:"url"`
+	Alias     string     `json:"alias,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	TTL       string     `json:"ttl,omitempty"`
 }
 
 type APIHandlerResponse struct {
@@ -55,18 +73,47 @@ type APIHandlerResponse struct {
 }
 
 type APIGETAllResponse struct {
-	ShortURL    string `json:"short_url"`
-	OriginalURL string `json:"original_url"`
+	ShortURL    string     `json:"short_url"`
+	OriginalURL string     `json:"original_url"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	Clicks      int64      `json:"clicks"`
 }
 
 type APIBatchRequest struct {
-	CorrelationID string `json:"correlation_id"`
-	OriginalURL   string `json:"original_url"`
+	CorrelationID string     `json:"correlation_id"`
+	OriginalURL   string     `json:"original_url"`
+	Alias         string     `json:"alias,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	TTL           string     `json:"ttl,omitempty"`
 }
 
 type APIBatchResponse struct {
 	CorrelationID string `json:"correlation_id"`
-	ShortURL      string `json:"short_url"`
+	ShortURL      string `json:"short_url,omitempty"`
+	Status        string `json:"status"`
+}
+
+type APIStatsBucket struct {
+	Time   time.Time `json:"time"`
+	Clicks int64     `json:"clicks"`
+}
+
+type APIStatsValue struct {
+	Value  string `json:"value"`
+	Clicks int64  `json:"clicks"`
+}
+
+type APIStatsResponse struct {
+	ShortURL     string           `json:"short_url"`
+	OriginalURL  string           `json:"original_url"`
+	Clicks       int64            `json:"clicks"`
+	Hourly       []APIStatsBucket `json:"hourly"`
+	Daily        []APIStatsBucket `json:"daily"`
+	TopReferrers []APIStatsValue  `json:"top_referrers"`
+	Browsers     []APIStatsValue  `json:"browsers"`
+	OS           []APIStatsValue  `json:"os"`
+	Devices      []APIStatsValue  `json:"devices"`
+	Traffic      []APIStatsValue  `json:"traffic"`
 }
 
 type serviceInterface interface {
@@ -74,6 +121,12 @@ type serviceInterface interface {
 	AddBatch(ctx context.Context, links []*models.Link) error
 	Get(ctx context.Context, id string) (string, error)
 	GetAll(ctx context.Context, hash string) ([]*models.Link, error)
+	Delete(ctx context.Context, hash string, ids []string) error
+	Click(event *models.ClickEvent)
+	Stats(ctx context.Context, hash, id string) (*models.LinkStats, error)
+	Export(ctx context.Context, w io.Writer) (int, error)
+	Import(ctx context.Context, r io.Reader, opts services.ImportLinksOptions) (*services.ImportLinksReport, error)
+	Ping(ctx context.Context) error
 }
 
 type gzipWriter struct {
@@ -158,21 +211,27 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		authCookie, _ := r.Cookie("auth")
 		hashCookie, _ := r.Cookie("hash")
 		if authCookie == nil || hashCookie == nil || !verifyCookie(authCookie.Value, hashCookie.Value) {
-			setAuthCookie(w, r)
+			if _, err := setAuthCookie(w, r); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
 		}
 
 		next.ServeHTTP(w, r)
 	})
 }
 
-func setAuthCookie(w http.ResponseWriter, r *http.Request) *http.Cookie {
-	cookie := pkg.GenerateRandomString()
+func setAuthCookie(w http.ResponseWriter, r *http.Request) (*http.Cookie, error) {
+	cookie, err := pkg.GenerateRandomString(authCookieLen)
+	if err != nil {
+		return nil, fmt.Errorf("can't generate auth cookie, err: %s", err)
+	}
 	authCookie := &http.Cookie{Name: "auth", Value: cookie, Path: "/"}
 	hashCookie := &http.Cookie{Name: "hash", Value: encryptCookie([]byte(cookie)), Path: "/"}
 	http.SetCookie(w, authCookie)
 	http.SetCookie(w, hashCookie)
 	r.Header.Set("Cookie", fmt.Sprintf("auth=%s; hash=%s", authCookie.Value, hashCookie.Value))
-	return hashCookie
+	return hashCookie, nil
 }
 
 func encryptCookie(cookie []byte) string {
@@ -193,25 +252,158 @@ func verifyCookie(authCookie, hashCookie string) bool {
 	return res
 }
 
+// newAPIStatsResponse - преобразование статистики ссылки в ответ API
+func newAPIStatsResponse(baseURL string, stats *models.LinkStats) *APIStatsResponse {
+	buckets := func(list []models.StatsBucket) []APIStatsBucket {
+		res := make([]APIStatsBucket, 0, len(list))
+		for _, v := range list {
+			res = append(res, APIStatsBucket{Time: v.Time, Clicks: v.Clicks})
+		}
+		return res
+	}
+	values := func(list []models.StatsValue) []APIStatsValue {
+		res := make([]APIStatsValue, 0, len(list))
+		for _, v := range list {
+			res = append(res, APIStatsValue{Value: v.Value, Clicks: v.Clicks})
+		}
+		return res
+	}
+
+	return &APIStatsResponse{
+		ShortURL:     fmt.Sprintf("%s/%s", baseURL, stats.Link.ID),
+		OriginalURL:  stats.Link.BaseURL,
+		Clicks:       stats.Link.Clicks,
+		Hourly:       buckets(stats.Hourly),
+		Daily:        buckets(stats.Daily),
+		TopReferrers: values(stats.Referrers),
+		Browsers:     values(stats.Browsers),
+		OS:           values(stats.OS),
+		Devices:      values(stats.Devices),
+		Traffic:      values(stats.Traffic),
+	}
+}
+
+// linkExpiresAt - получение срока действия ссылки из запроса, nil - ссылка бессрочная
+func linkExpiresAt(expiresAt *time.Time, ttl string) (*time.Time, error) {
+	if ttl == "" {
+		return expiresAt, nil
+	}
+
+	if expiresAt != nil {
+		return nil, errors.New("only one of expires_at and ttl can be passed")
+	}
+
+	duration, err := time.ParseDuration(ttl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ttl, err: %s", err)
+	}
+
+	if duration <= 0 {
+		return nil, errors.New("ttl must be positive")
+	}
+
+	res := time.Now().Add(duration)
+
+	return &res, nil
+}
+
+// InitRoutes - все маршруты на одном роутере с общим набором middleware, используется при запуске на одном адресе
 func (h *Handler) InitRoutes() chi.Router {
 	compressor := &Compressor{}
+	router := newRouter()
+	router.Use(compressor.GzipMiddlewareResponse)
+	router.Use(GzipMiddlewareRequest)
+	router.Use(AuthMiddleware)
+
+	h.redirectRoutes(router)
+	h.apiRoutes(router)
+	h.internalRoutes(router)
+
+	return router
+}
+
+// RedirectRoutes - публичный роутер переходов по коротким ссылкам, без cookie авторизации и gzip
+func (h *Handler) RedirectRoutes() chi.Router {
+	router := newRouter()
+	h.redirectRoutes(router)
+
+	return router
+}
+
+/*
+APIRoutes - роутер пользовательского API с cookie авторизацией и gzip.
+С withInternal на нём же регистрируются внутренние эндпоинты со своим набором middleware
+*/
+func (h *Handler) APIRoutes(withInternal bool) chi.Router {
+	router := newRouter()
+
+	router.Group(func(api chi.Router) {
+		compressor := &Compressor{}
+		api.Use(compressor.GzipMiddlewareResponse)
+		api.Use(GzipMiddlewareRequest)
+		api.Use(AuthMiddleware)
+		h.apiRoutes(api)
+	})
+
+	if withInternal {
+		router.Group(func(internal chi.Router) {
+			internal.Use(GzipMiddlewareRequest)
+			h.internalRoutes(internal)
+		})
+	}
+
+	return router
+}
+
+// InternalRoutes - роутер внутренних эндпоинтов: проверка состояния и администрирование
+func (h *Handler) InternalRoutes() chi.Router {
+	router := newRouter()
+	router.Use(GzipMiddlewareRequest)
+	h.internalRoutes(router)
+
+	return router
+}
+
+// newRouter - роутер с общими для всех адресов middleware
+func newRouter() chi.Router {
 	router := chi.NewRouter()
 	router.Use(middleware.RequestID)
 	router.Use(middleware.RealIP)
 	router.Use(middleware.Logger)
 	router.Use(middleware.Recoverer)
-	router.Use(compressor.GzipMiddlewareResponse)
-	router.Use(GzipMiddlewareRequest)
-	router.Use(AuthMiddleware)
 
-	router.Post(HomeURL, h.postHandler)
-	router.Post(APIURL, h.apiHandler)
-	router.Post(APIBATCH, h.apiBatch)
+	return router
+}
+
+// redirectRoutes - регистрация маршрута перехода по короткой ссылке
+func (h *Handler) redirectRoutes(router chi.Router) {
 	router.Get(DecodeURL, h.getHandler)
+}
+
+// apiRoutes - регистрация маршрутов пользовательского API
+func (h *Handler) apiRoutes(router chi.Router) {
+	limits := h.cfg.Server.BodyLimit
+	shortenLimit := LimitBody(bodyLimit(limits.Shorten, defaultShortenBodyLimit))
+
+	router.With(shortenLimit).Post(HomeURL, h.postHandler)
+	router.With(shortenLimit).Post(APIURL, h.apiHandler)
+	router.With(LimitBody(bodyLimit(limits.Batch, defaultBatchBodyLimit))).Post(APIBATCH, h.apiBatch)
 	router.Get(APIALLURLS, h.apiGetAllURLS)
-	router.Get(PING, h.pingDB)
+	router.With(LimitBody(bodyLimit(limits.Delete, defaultDeleteBodyLimit))).Delete(APIALLURLS, h.apiDeleteURLS)
+	router.Get(APISTATS, h.apiLinkStats)
+}
 
-	return router
+// internalRoutes - регистрация внутренних маршрутов, административные доступны только с токеном
+func (h *Handler) internalRoutes(router chi.Router) {
+	router.Get(HEALTHZ, h.healthz)
+	router.Get(READYZ, h.readyz)
+	router.Get(PING, h.readyz)
+
+	router.Group(func(admin chi.Router) {
+		admin.Use(h.AdminMiddleware, server.ExtendDeadlines(server.AdminTimeout(h.cfg)))
+		admin.Get(ADMINEXPORT, h.adminExport)
+		admin.With(LimitBody(bodyLimit(h.cfg.Server.BodyLimit.Import, defaultImportBodyLimit))).Post(ADMINIMPORT, h.adminImport)
+	})
 }
 
 func NewHandler(log *zap.SugaredLogger, cfg *config.Config, service serviceInterface) *Handler {
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// значение по умолчанию для времени ожидания проверки зависимостей при проверке готовности
+const defaultReadinessTimeout = 2 * time.Second
+
+// статусы проверок состояния
+const (
+	healthOK   = "ok"
+	healthFail = "fail"
+)
+
+// HealthCheck - результат проверки одной зависимости
+type HealthCheck struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// HealthResponse - ответ проверок состояния: общий статус и результаты проверок зависимостей
+type HealthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+// healthz - функция-хэндлер проверки жизнеспособности, отслеживаемый путь: "/healthz". Процесс отвечает - значит жив
+func (h *Handler) healthz(w http.ResponseWriter, r *http.Request) {
+	h.writeHealth(w, &HealthResponse{Status: healthOK}, http.StatusOK)
+}
+
+/*
+readyz - функция-хэндлер проверки готовности, отслеживаемые пути: "/readyz" и "/ping" для совместимости.
+Проверяет доступность хранилища, при недоступности отвечает 503
+*/
+func (h *Handler) readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), defaultReadinessTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := h.service.Ping(ctx)
+	check := HealthCheck{Status: healthOK, LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+
+	res := &HealthResponse{Status: healthOK, Checks: map[string]HealthCheck{"storage": check}}
+	code := http.StatusOK
+	if err != nil {
+		check.Status = healthFail
+		check.Error = err.Error()
+		res.Checks["storage"] = check
+		res.Status = healthFail
+		code = http.StatusServiceUnavailable
+		h.log.Errorf("storage is not ready, err: %s", err)
+	}
+
+	h.writeHealth(w, res, code)
+}
+
+// writeHealth - запись ответа проверки состояния в формате JSON
+func (h *Handler) writeHealth(w http.ResponseWriter, res *HealthResponse, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		h.log.Errorf("failed to write response body, err: %s", err)
+	}
+}
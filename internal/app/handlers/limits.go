@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+)
+
+// значения по умолчанию для максимального размера тела запроса по маршрутам
+const (
+	defaultShortenBodyLimit = 64 << 10
+	defaultBatchBodyLimit   = 4 << 20
+	defaultDeleteBodyLimit  = 1 << 20
+	defaultImportBodyLimit  = 256 << 20
+)
+
+// LimitBody - middleware ограничения размера тела запроса, при превышении чтение тела возвращает *http.MaxBytesError
+func LimitBody(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// bodyLimit - лимит из конфига или значение по умолчанию, если он не задан
+func bodyLimit(limit, def int64) int64 {
+	if limit <= 0 {
+		return def
+	}
+
+	return limit
+}
+
+// bodyTooLarge - превышен ли лимит размера тела запроса
+func bodyTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+
+	return errors.As(err, &maxErr)
+}
+
+// readBodyError - ответ на ошибку чтения тела запроса: 413 при превышении лимита, иначе 400
+func (h *Handler) readBodyError(w http.ResponseWriter, err error) {
+	code := http.StatusBadRequest
+	if bodyTooLarge(err) {
+		code = http.StatusRequestEntityTooLarge
+	}
+
+	http.Error(w, err.Error(), code)
+	h.log.Errorf("unable to read request body, err: %s", err)
+}
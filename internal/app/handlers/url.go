@@ -2,14 +2,15 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi"
-	"github.com/jackc/pgx/v5"
 	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/models"
-	"github.com/kirill-chelyatnikov/shortener-url-service/pkg"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/storage"
 )
 
 // postHandler - функция-хэндлер для обработки POST запросов, отслеживаемый путь: "/"
@@ -26,9 +27,7 @@ func (h *Handler) postHandler(w http.ResponseWriter, r *http.Request) {
 	// читаем тело запроса
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		h.log.Errorf("unable to read request body, err: %s", err)
-
+		h.readBodyError(w, err)
 		return
 	}
 
@@ -56,8 +55,7 @@ func (h *Handler) postHandler(w http.ResponseWriter, r *http.Request) {
 	var updated bool
 	updated, err = h.service.Add(ctx, link)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		h.log.Error(err)
+		h.writeError(w, err, http.StatusBadRequest)
 
 		return
 	}
@@ -96,12 +94,19 @@ func (h *Handler) getHandler(w http.ResponseWriter, r *http.Request) {
 	// получение url по индетификатору, проверка на его существование
 	url, err := h.service.Get(ctx, id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		h.log.Error(err)
+		h.writeError(w, err, http.StatusBadRequest)
 
 		return
 	}
 
+	// учёт перехода не блокирует редирект, событие сохраняется в хранилище в фоне
+	h.service.Click(&models.ClickEvent{
+		LinkID:    id,
+		Time:      time.Now(),
+		Referrer:  r.Referer(),
+		UserAgent: r.UserAgent(),
+	})
+
 	w.Header().Set("Location", url)
 	w.WriteHeader(http.StatusTemporaryRedirect)
 	h.log.Infof("successful redirect to: %s", url)
@@ -122,9 +127,7 @@ func (h *Handler) apiHandler(w http.ResponseWriter, r *http.Request) {
 	// читаем тело запроса
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		h.log.Errorf("unable to read request body, err: %s", err)
-
+		h.readBodyError(w, err)
 		return
 	}
 	defer func(Body io.ReadCloser) {
@@ -158,17 +161,26 @@ func (h *Handler) apiHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	expiresAt, err := linkExpiresAt(apiHandlerRequest.ExpiresAt, apiHandlerRequest.TTL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		h.log.Error(err)
+
+		return
+	}
+
 	// генерируем ссылку и записываем её в хранилище
 	link := &models.Link{
-		BaseURL: apiHandlerRequest.URL,
-		Hash:    cookieHash.Value,
+		ID:        apiHandlerRequest.Alias,
+		BaseURL:   apiHandlerRequest.URL,
+		Hash:      cookieHash.Value,
+		ExpiresAt: expiresAt,
 	}
 
 	var updated bool
 	updated, err = h.service.Add(ctx, link)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		h.log.Errorf("cant't add URL, err: %s", err)
+		h.writeError(w, err, http.StatusBadRequest)
 
 		return
 	}
@@ -218,12 +230,18 @@ func (h *Handler) apiGetAllURLS(w http.ResponseWriter, r *http.Request) {
 	}
 
 	links, err := h.service.GetAll(ctx, cookieHash.Value)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusNoContent)
+	// отсутствие ссылок у пользователя ошибкой не является, отдаём 204 без тела ответа
+	if errors.Is(err, storage.ErrNotFound) {
+		w.WriteHeader(http.StatusNoContent)
 		h.log.Info(err.Error())
 
 		return
 	}
+	if err != nil {
+		h.writeError(w, err, http.StatusInternalServerError)
+
+		return
+	}
 
 	result := make([]*APIGETAllResponse, 0, len(links))
 
@@ -231,6 +249,8 @@ func (h *Handler) apiGetAllURLS(w http.ResponseWriter, r *http.Request) {
 		result = append(result, &APIGETAllResponse{
 			ShortURL:    fmt.Sprintf("%s/%s", h.cfg.App.BaseURL, v.ID),
 			OriginalURL: v.BaseURL,
+			ExpiresAt:   v.ExpiresAt,
+			Clicks:      v.Clicks,
 		})
 	}
 
@@ -256,32 +276,96 @@ func (h *Handler) apiGetAllURLS(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *Handler) pingDB(w http.ResponseWriter, r *http.Request) {
+// apiDeleteURLS - функция-хэндлер для асинхронного удаления ссылок пользователя, отслеживаемый путь: "/api/user/urls"
+func (h *Handler) apiDeleteURLS(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	conn, err := pgx.Connect(ctx, h.cfg.DB.CDN)
+	cookieHash, err := r.Cookie("hash")
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		h.log.Errorf("unable to connect to database, err: %s", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		h.log.Errorf("can't get hash from cookie, err: %s", err)
+
+		return
+	}
+
+	// читаем тело запроса
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.readBodyError(w, err)
 		return
 	}
 
-	defer func() {
-		err = conn.Close(ctx)
+	defer func(Body io.ReadCloser) {
+		err = Body.Close()
 		if err != nil {
-			h.log.Errorf("can't close database connection, err: %s", err)
+			h.log.Errorf("can't close body request, err: %s", err)
 		}
-	}()
+	}(r.Body)
 
+	// проверка на пустоту тела запроса
+	if len(body) == 0 {
+		http.Error(w, "empty request body", http.StatusBadRequest)
+		h.log.Error("empty request body")
+
+		return
+	}
+
+	ids := make([]string, 0)
+	if err = json.Unmarshal(body, &ids); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		h.log.Errorf("cant't unmarshal request, err: %s", err)
+
+		return
+	}
+
+	// удаление выполняется в фоне, клиенту сразу отдаём 202
+	if err = h.service.Delete(ctx, cookieHash.Value, ids); err != nil {
+		h.writeError(w, err, http.StatusBadRequest)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	h.log.Infof("accepted %d links for deletion", len(ids))
+}
+
+// apiLinkStats - функция-хэндлер для получения статистики переходов по ссылке пользователя, отслеживаемый путь: "/api/user/urls/{id}/stats"
+func (h *Handler) apiLinkStats(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	cookieHash, err := r.Cookie("hash")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		h.log.Errorf("can't get hash from cookie, err: %s", err)
+
+		return
+	}
+
+	stats, err := h.service.Stats(ctx, cookieHash.Value, chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeError(w, err, http.StatusInternalServerError)
+
+		return
+	}
+
+	jsonResult, err := json.Marshal(newAPIStatsResponse(h.cfg.App.BaseURL, stats))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.log.Errorf("cant't marshal result, err: %s", err)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
-	_, err = w.Write([]byte("database is working!"))
+
+	_, err = w.Write(jsonResult)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		h.log.Errorf("failed to write response body, err: %s", err)
 
 		return
 	}
-	h.log.Info("successful database ping")
 }
 
 func (h *Handler) apiBatch(w http.ResponseWriter, r *http.Request) {
@@ -298,9 +382,7 @@ func (h *Handler) apiBatch(w http.ResponseWriter, r *http.Request) {
 	// читаем тело запроса
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		h.log.Errorf("unable to read request body, err: %s", err)
-
+		h.readBodyError(w, err)
 		return
 	}
 
@@ -331,11 +413,21 @@ func (h *Handler) apiBatch(w http.ResponseWriter, r *http.Request) {
 	links := make([]*models.Link, 0)
 	for _, v := range requestLinks {
 		if len(v.CorrelationID) > 0 && len(v.OriginalURL) > 0 {
+			var expiresAt *time.Time
+			expiresAt, err = linkExpiresAt(v.ExpiresAt, v.TTL)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				h.log.Errorf("invalid expiration for correlation_id %s, err: %s", v.CorrelationID, err)
+
+				return
+			}
+
 			link := &models.Link{
-				ID:            pkg.GenerateRandomString(),
+				ID:            v.Alias,
 				BaseURL:       v.OriginalURL,
 				CorrelationID: v.CorrelationID,
 				Hash:          cookieHash.Value,
+				ExpiresAt:     expiresAt,
 			}
 
 			links = append(links, link)
@@ -344,18 +436,23 @@ func (h *Handler) apiBatch(w http.ResponseWriter, r *http.Request) {
 
 	err = h.service.AddBatch(ctx, links)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		h.log.Errorf("can't add links batch, err: %s", err)
+		h.writeError(w, err, http.StatusInternalServerError)
 
 		return
 	}
 
+	// результат по каждой записи: для уже сокращённых URL отдаётся существующая короткая ссылка, для занятых алиасов - только статус
 	result := make([]APIBatchResponse, 0)
 	for _, v := range links {
-		result = append(result, APIBatchResponse{
+		item := APIBatchResponse{
 			CorrelationID: v.CorrelationID,
-			ShortURL:      fmt.Sprintf("%s/%s", h.cfg.App.BaseURL, v.ID),
-		})
+			Status:        v.Status,
+		}
+		if v.Status != models.LinkConflict {
+			item.ShortURL = fmt.Sprintf("%s/%s", h.cfg.App.BaseURL, v.ID)
+		}
+
+		result = append(result, item)
 	}
 
 	jsonResult, err := json.Marshal(result)
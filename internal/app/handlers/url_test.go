@@ -2,12 +2,15 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/models"
@@ -26,11 +29,21 @@ var (
 	log        = logger.InitLogger()
 	fl         = config.GetFlags()
 	cfg        = config.GetConfig(log, testConfigURL, fl)
-	repository = storage.NewStorage(context.TODO(), log, cfg)
+	repository = newTestRepository()
 	serviceURL = services.NewServiceURL(log, cfg, repository)
 	h          = NewHandler(log, cfg, serviceURL)
 )
 
+// newTestRepository - хранилище из тестового конфига
+func newTestRepository() services.RepositoryInterface {
+	repository, err := storage.NewStorage(context.TODO(), log, cfg)
+	if err != nil {
+		log.Fatalf("can't create storage, err: %s", err)
+	}
+
+	return repository
+}
+
 func TestPostHandler(t *testing.T) {
 	type want struct {
 		code         int
@@ -112,8 +125,8 @@ func TestGetHandler(t *testing.T) {
 		{
 			name: "wrong id",
 			want: want{
-				code: 400,
-				err:  "can't find URL by id: 123",
+				code: 404,
+				err:  "link not found",
 			},
 			id:      "123",
 			wantErr: true,
@@ -185,6 +198,83 @@ func TestApiHandler(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "conflict_test",
+			body: "{\"url\":\"https://www.google.com\"}",
+			want: want{
+				code:        409,
+				contentType: "application/json; charset=utf-8",
+			},
+			wantErr: false,
+		},
+		{
+			name: "alias",
+			body: "{\"url\":\"https://alias.com\",\"alias\":\"my-alias\"}",
+			want: want{
+				code:        201,
+				contentType: "application/json; charset=utf-8",
+			},
+			wantErr: false,
+		},
+		{
+			name: "alias_taken",
+			body: "{\"url\":\"https://other-alias.com\",\"alias\":\"my-alias\"}",
+			want: want{
+				code:        409,
+				contentType: "text/plain; charset=utf-8",
+			},
+			textErr: "link already exists",
+			wantErr: true,
+		},
+		{
+			name: "alias_reserved",
+			body: "{\"url\":\"https://reserved-alias.com\",\"alias\":\"API\"}",
+			want: want{
+				code:        400,
+				contentType: "text/plain; charset=utf-8",
+			},
+			textErr: "invalid alias: API is reserved",
+			wantErr: true,
+		},
+		{
+			name: "alias_invalid_chars",
+			body: "{\"url\":\"https://invalid-alias.com\",\"alias\":\"my/alias\"}",
+			want: want{
+				code:        400,
+				contentType: "text/plain; charset=utf-8",
+			},
+			textErr: "invalid alias: only latin letters, digits, \"-\" and \"_\" are allowed",
+			wantErr: true,
+		},
+		{
+			name: "with_ttl",
+			body: "{\"url\":\"https://ttl.com\",\"ttl\":\"1h\"}",
+			want: want{
+				code:        201,
+				contentType: "application/json; charset=utf-8",
+			},
+			wantErr: false,
+		},
+		{
+			name: "expires_in_past",
+			body: "{\"url\":\"https://expired.com\",\"expires_at\":\"2000-01-01T00:00:00Z\"}",
+			want: want{
+				code:        400,
+				contentType: "text/plain; charset=utf-8",
+			},
+			textErr: "link expiration time is in the past",
+			wantErr: true,
+		},
+		{
+			name: "negative_ttl",
+			body: "{\"url\":\"https://ttl.com\",\"ttl\":\"-1h\"}",
+			want: want{
+				code:        400,
+				contentType: "text/plain; charset=utf-8",
+			},
+			textErr: "ttl must be positive",
+			wantErr: true,
+		},
 		{
 			name: "empty_body",
 			body: "",
@@ -234,3 +324,387 @@ func TestApiHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestApiGetAllURLS(t *testing.T) {
+	router := h.InitRoutes()
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// новый пользователь без ссылок получает 204 без тела ответа
+	response, err := http.Get(fmt.Sprintf("%s/api/user/urls", ts.URL))
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusNoContent, response.StatusCode)
+	assert.Empty(t, body)
+}
+
+func TestApiDeleteURLS(t *testing.T) {
+	router := h.InitRoutes()
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// создаём ссылку, чтобы получить куки пользователя
+	response, err := http.Post(fmt.Sprintf("%s/api/shorten", ts.URL), "application/json",
+		strings.NewReader("{\"url\":\"https://delete-test.com\"}"))
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusCreated, response.StatusCode)
+
+	result := &APIHandlerResponse{}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(result))
+	id := result.Result[strings.LastIndex(result.Result, "/")+1:]
+
+	request, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/api/user/urls", ts.URL),
+		strings.NewReader(fmt.Sprintf("[\"%s\"]", id)))
+	require.NoError(t, err)
+	for _, v := range response.Cookies() {
+		request.AddCookie(v)
+	}
+
+	deleteResponse, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	defer deleteResponse.Body.Close()
+	assert.Equal(t, http.StatusAccepted, deleteResponse.StatusCode)
+
+	// удаление асинхронное, поэтому ждём, пока ссылка станет недоступна
+	assert.Eventually(t, func() bool {
+		_, err = serviceURL.Get(context.TODO(), id)
+		return errors.Is(err, storage.ErrGone)
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestApiLinkStats(t *testing.T) {
+	router := h.InitRoutes()
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// создаём ссылку, чтобы получить куки пользователя
+	response, err := http.Post(fmt.Sprintf("%s/api/shorten", ts.URL), "application/json",
+		strings.NewReader("{\"url\":\"https://stats-test.com\"}"))
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusCreated, response.StatusCode)
+
+	result := &APIHandlerResponse{}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(result))
+	id := result.Result[strings.LastIndex(result.Result, "/")+1:]
+
+	// ссылка другого пользователя, без куки первого
+	foreignResponse, err := http.Post(fmt.Sprintf("%s/api/shorten", ts.URL), "application/json",
+		strings.NewReader("{\"url\":\"https://stats-foreign-test.com\"}"))
+	require.NoError(t, err)
+	defer foreignResponse.Body.Close()
+	require.Equal(t, http.StatusCreated, foreignResponse.StatusCode)
+
+	foreign := &APIHandlerResponse{}
+	require.NoError(t, json.NewDecoder(foreignResponse.Body).Decode(foreign))
+	foreignID := foreign.Result[strings.LastIndex(foreign.Result, "/")+1:]
+
+	tests := []struct {
+		name string
+		id   string
+		code int
+	}{
+		{name: "own_link", id: id, code: http.StatusOK},
+		{name: "foreign_link", id: foreignID, code: http.StatusNotFound},
+		{name: "unknown_link", id: "unknown", code: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/user/urls/%s/stats", ts.URL, tt.id), nil)
+			require.NoError(t, err)
+			for _, v := range response.Cookies() {
+				request.AddCookie(v)
+			}
+
+			statsResponse, err := http.DefaultClient.Do(request)
+			require.NoError(t, err)
+			defer statsResponse.Body.Close()
+
+			assert.Equal(t, tt.code, statsResponse.StatusCode)
+			if tt.code != http.StatusOK {
+				return
+			}
+
+			stats := &APIStatsResponse{}
+			require.NoError(t, json.NewDecoder(statsResponse.Body).Decode(stats))
+			assert.Equal(t, result.Result, stats.ShortURL)
+			assert.Equal(t, "https://stats-test.com", stats.OriginalURL)
+		})
+	}
+}
+
+func TestApiBatch(t *testing.T) {
+	router := h.InitRoutes()
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// уже сокращённый URL и занятый алиас не должны прерывать пачку
+	response, err := http.Post(fmt.Sprintf("%s/api/shorten", ts.URL), "application/json",
+		strings.NewReader("{\"url\":\"https://batch-existing.com\",\"alias\":\"batch-alias\"}"))
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusCreated, response.StatusCode)
+
+	body := `[
+		{"correlation_id":"1","original_url":"https://batch-new.com"},
+		{"correlation_id":"2","original_url":"https://batch-existing.com"},
+		{"correlation_id":"3","original_url":"https://batch-other.com","alias":"batch-alias"}
+	]`
+	batchResponse, err := http.Post(fmt.Sprintf("%s/api/shorten/batch", ts.URL), "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	defer batchResponse.Body.Close()
+	require.Equal(t, http.StatusCreated, batchResponse.StatusCode)
+
+	result := make([]APIBatchResponse, 0)
+	require.NoError(t, json.NewDecoder(batchResponse.Body).Decode(&result))
+	require.Len(t, result, 3)
+
+	tests := []struct {
+		name     string
+		item     APIBatchResponse
+		status   string
+		shortURL string
+	}{
+		{name: "created", item: result[0], status: models.LinkCreated},
+		{name: "existed", item: result[1], status: models.LinkExisted, shortURL: fmt.Sprintf("%s/batch-alias", cfg.App.BaseURL)},
+		{name: "conflict", item: result[2], status: models.LinkConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.status, tt.item.Status)
+
+			switch tt.status {
+			case models.LinkConflict:
+				assert.Empty(t, tt.item.ShortURL)
+			case models.LinkExisted:
+				assert.Equal(t, tt.shortURL, tt.item.ShortURL)
+			default:
+				assert.NotEmpty(t, tt.item.ShortURL)
+			}
+		})
+	}
+}
+
+func TestAdminEndpoints(t *testing.T) {
+	const token = "admin-token"
+
+	router := h.InitRoutes()
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		body   string
+		auth   string
+		code   int
+	}{
+		{name: "disabled", method: http.MethodGet, path: ADMINEXPORT, code: http.StatusNotFound},
+		{name: "wrong_token", token: token, method: http.MethodGet, path: ADMINEXPORT, auth: "wrong", code: http.StatusUnauthorized},
+		{name: "export", token: token, method: http.MethodGet, path: ADMINEXPORT, auth: token, code: http.StatusOK},
+		{
+			name: "import_dry_run", token: token, method: http.MethodPost, path: ADMINIMPORT + "?dry_run=true", auth: token,
+			body: `{"id":"admin-import","base_url":"https://admin-import.com","owners":["user"]}`, code: http.StatusOK,
+		},
+		{
+			name: "import_invalid", token: token, method: http.MethodPost, path: ADMINIMPORT + "?on_conflict=fail", auth: token,
+			body: `{"id":"admin-invalid","base_url":"","owners":["user"]}`, code: http.StatusUnprocessableEntity,
+		},
+		{name: "import_bad_policy", token: token, method: http.MethodPost, path: ADMINIMPORT + "?on_conflict=bad", auth: token, code: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.App.AdminToken = tt.token
+			t.Cleanup(func() { cfg.App.AdminToken = "" })
+
+			request, err := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader(tt.body))
+			require.NoError(t, err)
+			if tt.auth != "" {
+				request.Header.Set("Authorization", "Bearer "+tt.auth)
+			}
+
+			response, err := http.DefaultClient.Do(request)
+			require.NoError(t, err)
+			defer response.Body.Close()
+
+			assert.Equal(t, tt.code, response.StatusCode)
+		})
+	}
+
+	// после проверки без записи ссылки в хранилище нет
+	_, err := serviceURL.Get(context.Background(), "admin-import")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestBodyLimit(t *testing.T) {
+	const token = "admin-token"
+
+	limits := cfg.Server.BodyLimit
+	cfg.Server.BodyLimit.Shorten = 64
+	cfg.Server.BodyLimit.Batch = 64
+	cfg.Server.BodyLimit.Delete = 64
+	cfg.Server.BodyLimit.Import = 64
+	cfg.App.AdminToken = token
+	t.Cleanup(func() {
+		cfg.Server.BodyLimit = limits
+		cfg.App.AdminToken = ""
+	})
+
+	router := h.InitRoutes()
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	large := strings.Repeat("a", 100)
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{name: "shorten_within_limit", method: http.MethodPost, path: HomeURL, body: "https://limit.com", code: http.StatusCreated},
+		{name: "shorten", method: http.MethodPost, path: HomeURL, body: "https://" + large + ".com", code: http.StatusRequestEntityTooLarge},
+		{name: "api_shorten", method: http.MethodPost, path: APIURL, body: `{"url":"https://` + large + `.com"}`, code: http.StatusRequestEntityTooLarge},
+		{name: "batch", method: http.MethodPost, path: APIBATCH, body: `[{"correlation_id":"1","original_url":"https://` + large + `.com"}]`, code: http.StatusRequestEntityTooLarge},
+		{name: "delete", method: http.MethodDelete, path: APIALLURLS, body: `["` + large + `"]`, code: http.StatusRequestEntityTooLarge},
+		{name: "import", method: http.MethodPost, path: ADMINIMPORT, body: `{"id":"limit","base_url":"https://` + large + `.com","owners":["user"]}`, code: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, err := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader(tt.body))
+			require.NoError(t, err)
+			request.Header.Set("Authorization", "Bearer "+token)
+
+			response, err := http.DefaultClient.Do(request)
+			require.NoError(t, err)
+			defer response.Body.Close()
+
+			assert.Equal(t, tt.code, response.StatusCode)
+		})
+	}
+}
+
+func TestSplitRoutes(t *testing.T) {
+	const token = "admin-token"
+
+	cfg.App.AdminToken = token
+	t.Cleanup(func() { cfg.App.AdminToken = "" })
+
+	public := httptest.NewServer(h.RedirectRoutes())
+	defer public.Close()
+	api := httptest.NewServer(h.APIRoutes(false))
+	defer api.Close()
+	internal := httptest.NewServer(h.InternalRoutes())
+	defer internal.Close()
+
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	// ссылка создаётся через API, в ответе выдаётся cookie пользователя
+	response, err := client.Post(api.URL+HomeURL, "text/plain", strings.NewReader("https://split-routes.com"))
+	require.NoError(t, err)
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, response.StatusCode)
+	assert.NotEmpty(t, response.Cookies())
+	id := strings.TrimPrefix(string(body), cfg.App.BaseURL+"/")
+
+	// переход работает только на публичном адресе и не выдаёт cookie
+	response, err = client.Get(public.URL + "/" + id)
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, response.StatusCode)
+	assert.Empty(t, response.Cookies())
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		code   int
+	}{
+		{name: "no_redirect_on_api", method: http.MethodGet, url: api.URL + "/" + id, code: http.StatusNotFound},
+		{name: "no_shorten_on_public", method: http.MethodPost, url: public.URL + HomeURL, code: http.StatusNotFound},
+		{name: "no_api_on_public", method: http.MethodGet, url: public.URL + APIALLURLS, code: http.StatusNotFound},
+		{name: "no_admin_on_api", method: http.MethodGet, url: api.URL + ADMINEXPORT, code: http.StatusNotFound},
+		{name: "admin_on_internal", method: http.MethodGet, url: internal.URL + ADMINEXPORT, code: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, err := http.NewRequest(tt.method, tt.url, nil)
+			require.NoError(t, err)
+			request.Header.Set("Authorization", "Bearer "+token)
+
+			response, err := client.Do(request)
+			require.NoError(t, err)
+			defer response.Body.Close()
+
+			assert.Equal(t, tt.code, response.StatusCode)
+		})
+	}
+}
+
+// pingFailService - сервис с недоступным хранилищем
+type pingFailService struct {
+	serviceInterface
+}
+
+func (s *pingFailService) Ping(ctx context.Context) error {
+	return errors.New("storage is down")
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	ts := httptest.NewServer(h.InternalRoutes())
+	defer ts.Close()
+	failing := httptest.NewServer(NewHandler(log, cfg, &pingFailService{serviceInterface: serviceURL}).InternalRoutes())
+	defer failing.Close()
+
+	tests := []struct {
+		name    string
+		url     string
+		code    int
+		status  string
+		storage string
+	}{
+		{name: "healthz", url: ts.URL + HEALTHZ, code: http.StatusOK, status: "ok"},
+		{name: "readyz", url: ts.URL + READYZ, code: http.StatusOK, status: "ok", storage: "ok"},
+		{name: "ping_alias", url: ts.URL + PING, code: http.StatusOK, status: "ok", storage: "ok"},
+		{name: "healthz_storage_down", url: failing.URL + HEALTHZ, code: http.StatusOK, status: "ok"},
+		{name: "readyz_storage_down", url: failing.URL + READYZ, code: http.StatusServiceUnavailable, status: "fail", storage: "fail"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := http.Get(tt.url)
+			require.NoError(t, err)
+			defer response.Body.Close()
+
+			assert.Equal(t, tt.code, response.StatusCode)
+			assert.Equal(t, "application/json", response.Header.Get("Content-Type"))
+
+			var res HealthResponse
+			require.NoError(t, json.NewDecoder(response.Body).Decode(&res))
+			assert.Equal(t, tt.status, res.Status)
+			if tt.storage == "" {
+				assert.Empty(t, res.Checks)
+				return
+			}
+			require.Contains(t, res.Checks, "storage")
+			assert.Equal(t, tt.storage, res.Checks["storage"].Status)
+			assert.GreaterOrEqual(t, res.Checks["storage"].LatencyMS, 0.0)
+		})
+	}
+}
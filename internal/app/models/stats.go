@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// измерения, по которым агрегируются переходы по ссылке
+const (
+	DimensionReferrer = "referrer"
+	DimensionBrowser  = "browser"
+	DimensionOS       = "os"
+	DimensionDevice   = "device"
+	DimensionTraffic  = "traffic" // значения TrafficHuman / TrafficBot, по нему же считается общее число переходов
+)
+
+const (
+	TrafficHuman = "human"
+	TrafficBot   = "bot"
+)
+
+// ClickEvent - сырое событие перехода по ссылке
+type ClickEvent struct {
+	ID        int64
+	LinkID    string
+	Time      time.Time
+	Referrer  string
+	UserAgent string
+}
+
+// StatsCounter - агрегированное количество переходов по ссылке за час Bucket со значением Value измерения Dimension
+type StatsCounter struct {
+	LinkID    string
+	Bucket    time.Time
+	Dimension string
+	Value     string
+	Count     int64
+}
+
+// StatsBucket - количество переходов за период, начинающийся в Time
+type StatsBucket struct {
+	Time   time.Time
+	Clicks int64
+}
+
+// StatsValue - количество переходов со значением Value измерения
+type StatsValue struct {
+	Value  string
+	Clicks int64
+}
+
+// LinkStats - статистика переходов по ссылке
+type LinkStats struct {
+	Link      *Link
+	Hourly    []StatsBucket
+	Daily     []StatsBucket
+	Referrers []StatsValue
+	Browsers  []StatsValue
+	OS        []StatsValue
+	Devices   []StatsValue
+	Traffic   []StatsValue
+}
@@ -1,8 +1,41 @@
 package models
 
+import "time"
+
+// результаты добавления ссылки в составе пачки (Link.Status)
+const (
+	LinkCreated  = "created"  // ссылка добавлена
+	LinkExisted  = "existed"  // URL уже сокращён, возвращён существующий ID, хеш пользователя добавлен к владельцам
+	LinkConflict = "conflict" // ID (алиас) занят другой ссылкой, ссылка не добавлена
+
+	LinkOverwritten = "overwritten" // при импорте с перезаписью ссылка с тем же ID заменена импортируемой
+)
+
 type Link struct {
 	ID            string
 	BaseURL       string
 	CorrelationID string
 	Hash          string
+	CreatedAt     time.Time  // момент создания ссылки, нулевой для ссылок, созданных до появления поля
+	ExpiresAt     *time.Time // момент, после которого ссылка перестаёт работать, nil - ссылка бессрочная
+	Clicks        int64      // количество переходов по ссылке
+	Status        string     `json:"-"` // результат добавления в составе пачки, не сохраняется
+}
+
+// Expired - проверка, истёк ли срок действия ссылки на момент now
+func (l *Link) Expired(now time.Time) bool {
+	return l.ExpiresAt != nil && !now.Before(*l.ExpiresAt)
+}
+
+// LinkRecord - ссылка со всеми владельцами и признаком удаления, используется для переноса ссылок между хранилищами
+type LinkRecord struct {
+	Link
+	Owners  []string // хеши всех владельцев ссылки
+	Deleted bool
+}
+
+// ImportOptions - параметры импорта записей в хранилище
+type ImportOptions struct {
+	Overwrite bool // запись с тем же ID заменяется импортируемой вместе с владельцами
+	DryRun    bool // только определить результат импорта каждой записи, не изменяя хранилище
 }
@@ -1,15 +1,290 @@
 package server
 
 import (
-	"go.uber.org/zap"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
 
-	"github.com/go-chi/chi"
 	"github.com/kirill-chelyatnikov/shortener-url-service/internal/config"
 )
 
-// HTTPServerStart - функция запуска HTTP сервера
-func HTTPServerStart(log *zap.SugaredLogger, cfg *config.Config, router chi.Router) {
-	log.Infof("starting %s", cfg.Server.Address)
-	log.Fatal(http.ListenAndServe(cfg.Server.Address, router))
+// значения по умолчанию для таймаутов и ограничений сервера
+const (
+	defaultShutdownTimeout   = 10 * time.Second
+	defaultReadTimeout       = 30 * time.Second
+	defaultReadHeaderTimeout = 5 * time.Second
+	defaultWriteTimeout      = 30 * time.Second
+	defaultIdleTimeout       = 2 * time.Minute
+	defaultAdminTimeout      = time.Hour
+	defaultMaxHeaderBytes    = 64 << 10
+)
+
+// Listener - адрес и обработчик одного из портов сервера, Name используется в логах и для получения адреса
+type Listener struct {
+	Name    string
+	Address string
+	Handler http.Handler
+}
+
+/*
+Server - HTTP или HTTPS сервер на одном или нескольких адресах с явным жизненным циклом: Start, ожидание Done, Shutdown.
+Первый адрес считается публичным: на него перенаправляет HTTP сервер в режиме HTTPS
+*/
+type Server struct {
+	log       *zap.SugaredLogger
+	cfg       *config.Config
+	names     []string
+	servers   []*http.Server
+	listeners []net.Listener
+	// необязательный HTTP сервер, перенаправляющий запросы на HTTPS
+	redirect *http.Server
+	done     chan error
+	serving  sync.WaitGroup
+}
+
+// NewServer - конструктор сервера на адресах listeners с таймаутами и ограничением заголовков из cfg.Server
+func NewServer(log *zap.SugaredLogger, cfg *config.Config, listeners ...Listener) *Server {
+	srv := &Server{
+		log: log,
+		cfg: cfg,
+		// по одному результату от каждого сервера и сервера перенаправления
+		done: make(chan error, len(listeners)+1),
+	}
+
+	for _, v := range listeners {
+		srv.names = append(srv.names, v.Name)
+		srv.servers = append(srv.servers, newHTTPServer(cfg, v.Address, v.Handler))
+	}
+
+	if cfg.Server.HTTPS.Enabled && cfg.Server.HTTPS.RedirectAddress != "" {
+		srv.redirect = newHTTPServer(cfg, cfg.Server.HTTPS.RedirectAddress, nil)
+	}
+
+	return srv
+}
+
+// newHTTPServer - http.Server с таймаутами и ограничением заголовков из cfg.Server
+func newHTTPServer(cfg *config.Config, address string, handler http.Handler) *http.Server {
+	srv := &http.Server{
+		Addr:              address,
+		Handler:           handler,
+		ReadTimeout:       durationOrDefault(cfg.Server.ReadTimeout, defaultReadTimeout),
+		ReadHeaderTimeout: durationOrDefault(cfg.Server.ReadHeaderTimeout, defaultReadHeaderTimeout),
+		WriteTimeout:      durationOrDefault(cfg.Server.WriteTimeout, defaultWriteTimeout),
+		IdleTimeout:       durationOrDefault(cfg.Server.IdleTimeout, defaultIdleTimeout),
+		MaxHeaderBytes:    defaultMaxHeaderBytes,
+		// соединение доступно обработчикам для продления таймаутов через ExtendDeadlines
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, connContextKey{}, c)
+		},
+	}
+	if cfg.Server.MaxHeaderBytes > 0 {
+		srv.MaxHeaderBytes = int(cfg.Server.MaxHeaderBytes)
+	}
+
+	return srv
+}
+
+// durationOrDefault - значение из конфига или значение по умолчанию, если оно не задано
+func durationOrDefault(value, def time.Duration) time.Duration {
+	if value <= 0 {
+		return def
+	}
+
+	return value
+}
+
+/*
+Start - функция открытия портов и запуска обработки запросов в фоне, ошибки открытия порта и загрузки сертификата
+возвращаются сразу. В режиме HTTPS дополнительно запускается сервер перенаправления, если задан его адрес
+*/
+func (s *Server) Start() error {
+	if len(s.servers) == 0 {
+		return errors.New("no listeners configured")
+	}
+
+	var tlsConfig *tls.Config
+	if s.cfg.Server.HTTPS.Enabled {
+		var err error
+		if tlsConfig, err = newTLSConfig(s.log, s.cfg); err != nil {
+			return err
+		}
+	}
+
+	// все порты открываются до начала обработки запросов, чтобы при ошибке не остался запущенным частично
+	listeners := make([]net.Listener, 0, len(s.servers)+1)
+	closeAll := func() {
+		for _, v := range listeners {
+			v.Close()
+		}
+	}
+
+	for _, srv := range s.servers {
+		listener, err := net.Listen("tcp", srv.Addr)
+		if err != nil {
+			closeAll()
+			return fmt.Errorf("can't listen %s, err: %s", srv.Addr, err)
+		}
+		if tlsConfig != nil {
+			srv.TLSConfig = tlsConfig
+			listener = tls.NewListener(listener, tlsConfig)
+		}
+		listeners = append(listeners, listener)
+	}
+
+	var redirectListener net.Listener
+	if s.redirect != nil {
+		_, port, err := net.SplitHostPort(listeners[0].Addr().String())
+		if err != nil {
+			closeAll()
+			return fmt.Errorf("can't get HTTPS port, err: %s", err)
+		}
+		s.redirect.Handler = redirectHandler(port)
+
+		redirectListener, err = net.Listen("tcp", s.redirect.Addr)
+		if err != nil {
+			closeAll()
+			return fmt.Errorf("can't listen %s, err: %s", s.redirect.Addr, err)
+		}
+	}
+	s.listeners = listeners
+
+	scheme := "HTTP"
+	if tlsConfig != nil {
+		scheme = "HTTPS"
+	}
+	for i, srv := range s.servers {
+		s.log.Infof("starting %s %s on %s", s.names[i], scheme, listeners[i].Addr())
+		s.serve(srv, listeners[i])
+	}
+
+	if redirectListener != nil {
+		s.log.Infof("starting HTTP to HTTPS redirect on %s", redirectListener.Addr())
+		s.serve(s.redirect, redirectListener)
+	}
+
+	go func() {
+		s.serving.Wait()
+		close(s.done)
+	}()
+
+	return nil
+}
+
+// serve - обработка запросов сервера srv в фоне, результат работы пишется в канал done
+func (s *Server) serve(srv *http.Server, listener net.Listener) {
+	s.serving.Add(1)
+	go func() {
+		defer s.serving.Done()
+
+		err := srv.Serve(listener)
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+		s.done <- err
+	}()
+}
+
+// Addr - фактический адрес первого сервера после Start, в том числе при запуске на порту 0
+func (s *Server) Addr() string {
+	return s.listeners[0].Addr().String()
+}
+
+// ListenerAddr - фактический адрес сервера с именем name после Start, пустая строка для неизвестного имени
+func (s *Server) ListenerAddr(name string) string {
+	for i, v := range s.names {
+		if v == name && i < len(s.listeners) {
+			return s.listeners[i].Addr().String()
+		}
+	}
+
+	return ""
+}
+
+// Done - канал результатов работы серверов: nil после Shutdown или ошибка, остановившая сервер. Закрывается после остановки всех серверов
+func (s *Server) Done() <-chan error {
+	return s.done
+}
+
+/*
+Shutdown - функция остановки серверов: новые соединения не принимаются, активные запросы дорабатывают до истечения ctx,
+после чего оставшиеся соединения закрываются принудительно
+*/
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.redirect != nil {
+		if err := s.redirect.Shutdown(ctx); err != nil {
+			s.log.Errorf("can't stop redirect server, err: %s", err)
+		}
+	}
+
+	// серверы останавливаются параллельно, чтобы все дорабатывали запросы в пределах одного ctx
+	errs := make([]error, len(s.servers))
+	var wg sync.WaitGroup
+	for i, srv := range s.servers {
+		wg.Add(1)
+		go func(i int, srv *http.Server) {
+			defer wg.Done()
+			errs[i] = srv.Shutdown(ctx)
+		}(i, srv)
+	}
+	wg.Wait()
+
+	var res error
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if errClose := s.servers[i].Close(); errClose != nil {
+			s.log.Errorf("can't close %s server connections, err: %s", s.names[i], errClose)
+		}
+		if res == nil {
+			res = fmt.Errorf("%s server shutdown interrupted, err: %s", s.names[i], err)
+		}
+	}
+	if res != nil {
+		return res
+	}
+
+	s.log.Info("server stopped")
+
+	return nil
+}
+
+// ShutdownTimeout - время ожидания активных запросов при остановке из cfg.Server.ShutdownTimeout
+func ShutdownTimeout(cfg *config.Config) time.Duration {
+	return durationOrDefault(cfg.Server.ShutdownTimeout, defaultShutdownTimeout)
+}
+
+// AdminTimeout - таймаут выгрузки и загрузки ссылок через /admin из cfg.Server.AdminTimeout
+func AdminTimeout(cfg *config.Config) time.Duration {
+	return durationOrDefault(cfg.Server.AdminTimeout, defaultAdminTimeout)
+}
+
+// connContextKey - ключ соединения запроса в контексте
+type connContextKey struct{}
+
+/*
+ExtendDeadlines - middleware, заменяющее ReadTimeout и WriteTimeout сервера для запроса на timeout: длинные выгрузки
+и загрузки не обрываются общими таймаутами. Таймауты сервера восстанавливаются для следующего запроса соединения.
+Продлевается и чтение, так как по его таймауту сервер отменяет контекст запроса
+*/
+func ExtendDeadlines(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if conn, ok := r.Context().Value(connContextKey{}).(net.Conn); ok {
+				deadline := time.Now().Add(timeout)
+				_ = conn.SetReadDeadline(deadline)
+				_ = conn.SetWriteDeadline(deadline)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
 }
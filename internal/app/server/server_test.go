@@ -0,0 +1,209 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/config"
+	"github.com/kirill-chelyatnikov/shortener-url-service/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T, handler http.Handler) *Server {
+	cfg := &config.Config{}
+	cfg.Server.Address = "127.0.0.1:0"
+
+	srv := NewServer(logger.InitLogger(), cfg, Listener{Name: "public", Address: cfg.Server.Address, Handler: handler})
+	require.NoError(t, srv.Start())
+
+	return srv
+}
+
+func TestServerShutdownDrainsRequests(t *testing.T) {
+	started := make(chan struct{})
+	srv := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		_, _ = io.WriteString(w, "done")
+	}))
+
+	type result struct {
+		body string
+		err  error
+	}
+	resCh := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + srv.Addr())
+		if err != nil {
+			resCh <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		resCh <- result{body: string(body), err: err}
+	}()
+
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, srv.Shutdown(ctx))
+
+	// запрос, начатый до остановки, дорабатывает до конца
+	res := <-resCh
+	require.NoError(t, res.err)
+	assert.Equal(t, "done", res.body)
+	assert.NoError(t, <-srv.Done())
+
+	// новые соединения после остановки не принимаются
+	_, err := http.Get("http://" + srv.Addr())
+	assert.Error(t, err)
+}
+
+func TestServerShutdownTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	srv := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	go func() {
+		resp, err := http.Get("http://" + srv.Addr())
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Error(t, srv.Shutdown(ctx))
+	assert.NoError(t, <-srv.Done())
+}
+
+func TestServerStartError(t *testing.T) {
+	srv := newTestServer(t, http.NotFoundHandler())
+	defer srv.Shutdown(context.Background())
+
+	cfg := &config.Config{}
+	assert.Error(t, NewServer(logger.InitLogger(), cfg, Listener{Name: "public", Address: srv.Addr(), Handler: http.NotFoundHandler()}).Start())
+}
+
+func TestServerReadHeaderTimeout(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Server.Address = "127.0.0.1:0"
+	cfg.Server.ReadHeaderTimeout = 50 * time.Millisecond
+
+	srv := NewServer(logger.InitLogger(), cfg, Listener{Name: "public", Address: cfg.Server.Address, Handler: http.NotFoundHandler()})
+	require.NoError(t, srv.Start())
+	defer srv.Shutdown(context.Background())
+
+	// клиент, не дописавший заголовки, отключается по таймауту
+	conn, err := net.Dial("tcp", srv.Addr())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n")
+	require.NoError(t, err)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	start := time.Now()
+	_, err = io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestServerListeners(t *testing.T) {
+	cfg := &config.Config{}
+	text := func(body string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, body)
+		})
+	}
+
+	srv := NewServer(logger.InitLogger(), cfg,
+		Listener{Name: "public", Address: "127.0.0.1:0", Handler: text("public")},
+		Listener{Name: "api", Address: "127.0.0.1:0", Handler: text("api")},
+	)
+	require.NoError(t, srv.Start())
+
+	assert.Equal(t, srv.Addr(), srv.ListenerAddr("public"))
+	assert.Empty(t, srv.ListenerAddr("unknown"))
+	for _, name := range []string{"public", "api"} {
+		resp, err := http.Get("http://" + srv.ListenerAddr(name))
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, name, string(body))
+	}
+
+	require.NoError(t, srv.Shutdown(context.Background()))
+	for err := range srv.Done() {
+		assert.NoError(t, err)
+	}
+
+	// при занятом втором адресе сервер не запускается и освобождает первый
+	busy := newTestServer(t, http.NotFoundHandler())
+	defer busy.Shutdown(context.Background())
+	failed := NewServer(logger.InitLogger(), cfg,
+		Listener{Name: "public", Address: "127.0.0.1:0", Handler: http.NotFoundHandler()},
+		Listener{Name: "api", Address: busy.Addr(), Handler: http.NotFoundHandler()},
+	)
+	assert.Error(t, failed.Start())
+}
+
+func TestExtendDeadlines(t *testing.T) {
+	const chunks = 5
+
+	// ответ пишется дольше таймаутов сервера
+	stream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher := w.(http.Flusher)
+		for i := 0; i < chunks; i++ {
+			_, _ = io.WriteString(w, "chunk\n")
+			flusher.Flush()
+			time.Sleep(60 * time.Millisecond)
+		}
+	})
+
+	tests := []struct {
+		name     string
+		handler  http.Handler
+		complete bool
+	}{
+		{name: "server_timeouts", handler: stream, complete: false},
+		{name: "extended", handler: ExtendDeadlines(time.Second)(stream), complete: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Server.Address = "127.0.0.1:0"
+			cfg.Server.ReadTimeout = 100 * time.Millisecond
+			cfg.Server.WriteTimeout = 100 * time.Millisecond
+
+			srv := NewServer(logger.InitLogger(), cfg, Listener{Name: "public", Address: cfg.Server.Address, Handler: tt.handler})
+			require.NoError(t, srv.Start())
+			defer srv.Shutdown(context.Background())
+
+			resp, err := http.Get("http://" + srv.Addr())
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			full := strings.Repeat("chunk\n", chunks)
+			if tt.complete {
+				require.NoError(t, err)
+				assert.Equal(t, full, string(body))
+				return
+			}
+			assert.True(t, err != nil || string(body) != full)
+		})
+	}
+}
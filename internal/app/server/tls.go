@@ -0,0 +1,205 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/config"
+)
+
+const (
+	// срок действия самоподписанного сертификата
+	selfSignedValidity = 365 * 24 * time.Hour
+	// сертификат из кеша перевыпускается, если до его истечения осталось меньше этого срока
+	selfSignedRenewBefore = 7 * 24 * time.Hour
+	// имена файлов самоподписанного сертификата и ключа в каталоге кеша
+	selfSignedCertFile = "cert.pem"
+	selfSignedKeyFile  = "key.pem"
+)
+
+// newTLSConfig - TLS конфиг сервера: сертификат из файлов cfg.Server.HTTPS или самоподписанный сертификат из кеша
+func newTLSConfig(log *zap.SugaredLogger, cfg *config.Config) (*tls.Config, error) {
+	https := cfg.Server.HTTPS
+
+	var cert tls.Certificate
+	var err error
+	switch {
+	case https.CertFile != "" && https.KeyFile != "":
+		cert, err = tls.LoadX509KeyPair(https.CertFile, https.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't load TLS certificate, err: %s", err)
+		}
+	case https.CertFile != "" || https.KeyFile != "":
+		return nil, errors.New("both TLS certificate and key files must be set")
+	default:
+		dir := https.CertCacheDir
+		if dir == "" {
+			dir = defaultCertCacheDir()
+		}
+		cert, err = selfSignedCertificate(log, dir, certHosts(cfg.Server.Address), time.Now())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// defaultCertCacheDir - каталог кеша самоподписанного сертификата по умолчанию
+func defaultCertCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+
+	return filepath.Join(dir, "shortener-url-service")
+}
+
+// certHosts - имена и адреса, для которых выпускается самоподписанный сертификат: localhost и хост адреса сервера
+func certHosts(address string) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil || host == "" {
+		return hosts
+	}
+	for _, v := range hosts {
+		if v == host {
+			return hosts
+		}
+	}
+
+	return append(hosts, host)
+}
+
+/*
+selfSignedCertificate - самоподписанный сертификат из каталога dir. Сертификат выпускается заново,
+если в кеше его нет, он не покрывает все hosts или скоро истекает
+*/
+func selfSignedCertificate(log *zap.SugaredLogger, dir string, hosts []string, now time.Time) (tls.Certificate, error) {
+	certPath := filepath.Join(dir, selfSignedCertFile)
+	keyPath := filepath.Join(dir, selfSignedKeyFile)
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err == nil && certValid(cert, hosts, now) {
+		log.Infof("using cached self-signed certificate %s", certPath)
+		return cert, nil
+	}
+
+	certPEM, keyPEM, err := generateCertificate(hosts, now)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	if err = os.MkdirAll(dir, 0o700); err != nil {
+		return tls.Certificate{}, fmt.Errorf("can't create certificate cache dir, err: %s", err)
+	}
+	if err = os.WriteFile(keyPath, keyPEM, 0o600); err != nil {
+		return tls.Certificate{}, fmt.Errorf("can't write certificate key, err: %s", err)
+	}
+	if err = os.WriteFile(certPath, certPEM, 0o644); err != nil {
+		return tls.Certificate{}, fmt.Errorf("can't write certificate, err: %s", err)
+	}
+
+	log.Infof("generated self-signed certificate %s for %v", certPath, hosts)
+
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// certValid - покрывает ли сертификат все hosts и действует ли он ещё не меньше selfSignedRenewBefore
+func certValid(cert tls.Certificate, hosts []string, now time.Time) bool {
+	if len(cert.Certificate) == 0 {
+		return false
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil || now.Add(selfSignedRenewBefore).After(leaf.NotAfter) {
+		return false
+	}
+
+	for _, v := range hosts {
+		if leaf.VerifyHostname(v) != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// generateCertificate - выпуск самоподписанного сертификата ECDSA P-256 для hosts, результат в формате PEM
+func generateCertificate(hosts []string, now time.Time) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't generate certificate key, err: %s", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't generate certificate serial number, err: %s", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"shortener-url-service"}, CommonName: hosts[0]},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, v := range hosts {
+		if ip := net.ParseIP(v); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, v)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't create certificate, err: %s", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't marshal certificate key, err: %s", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	return certPEM, keyPEM, nil
+}
+
+// redirectHandler - перенаправление запросов на тот же хост и путь по HTTPS на порт httpsPort
+func redirectHandler(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/config"
+	"github.com/kirill-chelyatnikov/shortener-url-service/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerHTTPSSelfSigned(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Server.Address = "127.0.0.1:0"
+	cfg.Server.HTTPS.Enabled = true
+	cfg.Server.HTTPS.CertCacheDir = t.TempDir()
+
+	srv := NewServer(logger.InitLogger(), cfg, Listener{Name: "public", Address: cfg.Server.Address, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "secure")
+	})})
+	require.NoError(t, srv.Start())
+	defer srv.Shutdown(context.Background())
+
+	// клиент доверяет сертификату из кеша
+	certPEM, err := os.ReadFile(filepath.Join(cfg.Server.HTTPS.CertCacheDir, selfSignedCertFile))
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(certPEM))
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+
+	resp, err := client.Get("https://" + srv.Addr())
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "secure", string(body))
+
+	// обычный HTTP на порту HTTPS не обслуживается
+	plain, err := http.Get("http://" + srv.Addr())
+	require.NoError(t, err)
+	defer plain.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, plain.StatusCode)
+}
+
+func TestSelfSignedCertificateCache(t *testing.T) {
+	log := logger.InitLogger()
+	dir := t.TempDir()
+	now := time.Now()
+
+	first, err := selfSignedCertificate(log, dir, certHosts("localhost:8080"), now)
+	require.NoError(t, err)
+
+	// сертификат из кеша используется повторно
+	cached, err := selfSignedCertificate(log, dir, certHosts("localhost:8080"), now)
+	require.NoError(t, err)
+	assert.Equal(t, first.Certificate, cached.Certificate)
+
+	// новый хост и скорое истечение приводят к перевыпуску
+	renamed, err := selfSignedCertificate(log, dir, certHosts("shortener.local:8080"), now)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.Certificate, renamed.Certificate)
+
+	renewed, err := selfSignedCertificate(log, dir, certHosts("shortener.local:8080"), now.Add(selfSignedValidity))
+	require.NoError(t, err)
+	assert.NotEqual(t, renamed.Certificate, renewed.Certificate)
+
+	info, err := os.Stat(filepath.Join(dir, selfSignedKeyFile))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		port     string
+		target   string
+		location string
+	}{
+		{name: "default_port", port: "443", target: "http://example.com:80/abc?x=1", location: "https://example.com/abc?x=1"},
+		{name: "custom_port", port: "8443", target: "http://example.com/abc", location: "https://example.com:8443/abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			redirectHandler(tt.port).ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			assert.Equal(t, http.StatusMovedPermanently, w.Code)
+			assert.Equal(t, tt.location, w.Header().Get("Location"))
+		})
+	}
+}
+
+func TestNewTLSConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	certPEM, keyPEM, err := generateCertificate([]string{"localhost"}, time.Now())
+	require.NoError(t, err)
+	cfg := &config.Config{}
+	cfg.Server.HTTPS.CertFile = filepath.Join(dir, "server.crt")
+	cfg.Server.HTTPS.KeyFile = filepath.Join(dir, "server.key")
+	require.NoError(t, os.WriteFile(cfg.Server.HTTPS.CertFile, certPEM, 0o644))
+	require.NoError(t, os.WriteFile(cfg.Server.HTTPS.KeyFile, keyPEM, 0o600))
+
+	tlsConfig, err := newTLSConfig(logger.InitLogger(), cfg)
+	require.NoError(t, err)
+	require.Len(t, tlsConfig.Certificates, 1)
+
+	cfg.Server.HTTPS.KeyFile = ""
+	_, err = newTLSConfig(logger.InitLogger(), cfg)
+	assert.Error(t, err)
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ограничения на длину пользовательского алиаса
+const (
+	aliasMinLen = 3
+	aliasMaxLen = 32
+)
+
+// reservedAliases - пути, занятые самим сервисом, алиасы сравниваются с ними без учёта регистра
+var reservedAliases = []string{"api", "ping", "healthz", "readyz", "admin"}
+
+var ErrInvalidAlias = errors.New("invalid alias")
+
+// validateAlias - проверка пользовательского алиаса: длина, допустимые символы (латиница, цифры, "-", "_") и зарезервированные пути
+func validateAlias(alias string) error {
+	if len(alias) < aliasMinLen || len(alias) > aliasMaxLen {
+		return fmt.Errorf("%w: length must be from %d to %d characters", ErrInvalidAlias, aliasMinLen, aliasMaxLen)
+	}
+
+	return validateID(alias)
+}
+
+/*
+validateID - проверка ID ссылки без ограничения минимальной длины, которое действует только для алиасов:
+сгенерированные ID (например, последовательные) бывают короче. Нужна для ID, пришедших извне, например при импорте
+*/
+func validateID(id string) error {
+	if id == "" || len(id) > aliasMaxLen {
+		return fmt.Errorf("%w: length must be from 1 to %d characters", ErrInvalidAlias, aliasMaxLen)
+	}
+
+	for _, v := range id {
+		if !(v >= 'a' && v <= 'z' || v >= 'A' && v <= 'Z' || v >= '0' && v <= '9' || v == '-' || v == '_') {
+			return fmt.Errorf("%w: only latin letters, digits, \"-\" and \"_\" are allowed", ErrInvalidAlias)
+		}
+	}
+
+	if isReservedID(id) {
+		return fmt.Errorf("%w: %s is reserved", ErrInvalidAlias, id)
+	}
+
+	return nil
+}
+
+// isReservedID - совпадает ли ID с путём, занятым самим сервисом
+func isReservedID(id string) bool {
+	for _, v := range reservedAliases {
+		if strings.EqualFold(id, v) {
+			return true
+		}
+	}
+
+	return false
+}
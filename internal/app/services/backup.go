@@ -0,0 +1,310 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/models"
+)
+
+// политики разрешения конфликтов импорта: запись с занятым ID или URL пропускается, перезаписывает ссылку с тем же ID или прерывает импорт
+const (
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+	ConflictFail      = "fail"
+)
+
+const (
+	// значение по умолчанию для размера пачки экспорта и импорта
+	defaultBackupBatchSize = 500
+	// максимальная длина строки NDJSON при импорте
+	backupMaxLineSize = 1 << 20
+	// максимальная длина хеша владельца (ограничение длины users.hash в БД)
+	ownerHashMaxLen = 64
+)
+
+var (
+	ErrInvalidRecord  = errors.New("invalid import record")
+	ErrImportConflict = errors.New("import conflict")
+)
+
+// BackupRecord - строка NDJSON экспорта и импорта: ссылка со всеми владельцами, моментами создания и истечения
+type BackupRecord struct {
+	ID            string     `json:"id"`
+	BaseURL       string     `json:"base_url"`
+	Owners        []string   `json:"owners"`
+	CreatedAt     *time.Time `json:"created_at,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	CorrelationID string     `json:"correlation_id,omitempty"`
+	Clicks        int64      `json:"clicks,omitempty"`
+	Deleted       bool       `json:"deleted,omitempty"`
+}
+
+// ImportLinksOptions - параметры импорта ссылок из NDJSON
+type ImportLinksOptions struct {
+	OnConflict string // политика конфликтов ConflictSkip (по умолчанию), ConflictOverwrite или ConflictFail
+	DryRun     bool   // только проверить записи и определить результат импорта, не изменяя хранилище
+	BatchSize  int
+}
+
+// ImportIssue - запись, не прошедшая проверку, Line - номер строки NDJSON начиная с 1
+type ImportIssue struct {
+	Line  int    `json:"line"`
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error"`
+}
+
+// ImportLinksReport - результат импорта: счётчики по статусам, ID конфликтующих записей и невалидные строки
+type ImportLinksReport struct {
+	DryRun      bool          `json:"dry_run"`
+	Created     int           `json:"created"`
+	Existed     int           `json:"existed"`
+	Overwritten int           `json:"overwritten"`
+	Conflicts   []string      `json:"conflicts"`
+	Invalid     []ImportIssue `json:"invalid"`
+}
+
+// newBackupRecord - преобразование записи хранилища в строку экспорта
+func newBackupRecord(record *models.LinkRecord) *BackupRecord {
+	res := &BackupRecord{
+		ID:            record.ID,
+		BaseURL:       record.BaseURL,
+		Owners:        record.Owners,
+		ExpiresAt:     record.ExpiresAt,
+		CorrelationID: record.CorrelationID,
+		Clicks:        record.Clicks,
+		Deleted:       record.Deleted,
+	}
+
+	if !record.CreatedAt.IsZero() {
+		createdAt := record.CreatedAt
+		res.CreatedAt = &createdAt
+	}
+
+	if res.Owners == nil {
+		res.Owners = []string{}
+	}
+
+	return res
+}
+
+// linkRecord - преобразование строки импорта в запись хранилища
+func (r *BackupRecord) linkRecord() *models.LinkRecord {
+	res := &models.LinkRecord{
+		Link: models.Link{
+			ID:            r.ID,
+			BaseURL:       r.BaseURL,
+			CorrelationID: r.CorrelationID,
+			ExpiresAt:     r.ExpiresAt,
+			Clicks:        r.Clicks,
+		},
+		Owners:  r.Owners,
+		Deleted: r.Deleted,
+	}
+
+	if r.CreatedAt != nil {
+		res.CreatedAt = *r.CreatedAt
+	}
+
+	return res
+}
+
+/*
+validate - проверка записи по тем же правилам, что применяет Add: непустой URL, хотя бы один владелец.
+ID проверяется как алиас, но без ограничения минимальной длины. Срок действия в прошлом допустим:
+экспорт содержит истёкшие ссылки, и они импортируются истёкшими так же, как удалённые - удалёнными
+*/
+func (r *BackupRecord) validate() error {
+	if r.BaseURL == "" {
+		return errors.New("empty url received")
+	}
+
+	if err := validateID(r.ID); err != nil {
+		return err
+	}
+
+	if len(r.Owners) == 0 {
+		return errors.New("record has no owners")
+	}
+
+	for _, v := range r.Owners {
+		if v == "" || len(v) > ownerHashMaxLen {
+			return fmt.Errorf("owner hash length must be from 1 to %d characters", ownerHashMaxLen)
+		}
+	}
+
+	if r.Clicks < 0 {
+		return errors.New("clicks must not be negative")
+	}
+
+	return nil
+}
+
+// ExportLinks - функция записи всех ссылок хранилища, включая удалённые и истёкшие, в w в формате NDJSON. Возвращает количество записей
+func ExportLinks(ctx context.Context, repository RepositoryInterface, w io.Writer) (int, error) {
+	encoder := json.NewEncoder(w)
+
+	var count int
+	var after string
+	for {
+		records, err := repository.ListURLS(ctx, after, defaultBackupBatchSize)
+		if err != nil {
+			return count, fmt.Errorf("can't read links after %q, err: %w", after, err)
+		}
+
+		for _, v := range records {
+			if err = encoder.Encode(newBackupRecord(v)); err != nil {
+				return count, fmt.Errorf("can't write link %s, err: %w", v.ID, err)
+			}
+			count++
+		}
+
+		if len(records) < defaultBackupBatchSize {
+			return count, nil
+		}
+		after = records[len(records)-1].ID
+	}
+}
+
+/*
+ImportLinks - функция импорта ссылок из NDJSON пачками. Невалидные строки и конфликты попадают в отчёт,
+с политикой ConflictFail первая невалидная строка или пачка с конфликтом прерывает импорт,
+пачки до неё уже записаны, поэтому файл стоит предварительно проверить с DryRun.
+С DryRun каждая пачка проверяется по текущему состоянию хранилища независимо от предыдущих
+*/
+func ImportLinks(ctx context.Context, repository RepositoryInterface, r io.Reader, opts ImportLinksOptions) (*ImportLinksReport, error) {
+	switch opts.OnConflict {
+	case "":
+		opts.OnConflict = ConflictSkip
+	case ConflictSkip, ConflictOverwrite, ConflictFail:
+	default:
+		return nil, fmt.Errorf("unknown conflict policy %q, expected %s", opts.OnConflict,
+			strings.Join([]string{ConflictSkip, ConflictOverwrite, ConflictFail}, ", "))
+	}
+
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBackupBatchSize
+	}
+
+	report := &ImportLinksReport{DryRun: opts.DryRun, Conflicts: []string{}, Invalid: []ImportIssue{}}
+	fail := opts.OnConflict == ConflictFail
+	storageOpts := models.ImportOptions{Overwrite: opts.OnConflict == ConflictOverwrite, DryRun: opts.DryRun}
+
+	flush := func(batch []*models.LinkRecord) error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		// без перезаписи пачка сначала проверяется, чтобы не записать её частично
+		if fail && !opts.DryRun {
+			if err := repository.ImportURLS(ctx, batch, models.ImportOptions{DryRun: true}); err != nil {
+				return err
+			}
+			if err := checkImportConflicts(batch, report); err != nil {
+				return err
+			}
+		}
+
+		if err := repository.ImportURLS(ctx, batch, storageOpts); err != nil {
+			return err
+		}
+
+		for _, v := range batch {
+			switch v.Status {
+			case models.LinkCreated:
+				report.Created++
+			case models.LinkExisted:
+				report.Existed++
+			case models.LinkOverwritten:
+				report.Overwritten++
+			default:
+				report.Conflicts = append(report.Conflicts, v.ID)
+			}
+		}
+
+		if fail && len(report.Conflicts) > 0 {
+			return fmt.Errorf("%w: ids %s", ErrImportConflict, strings.Join(report.Conflicts, ", "))
+		}
+
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), backupMaxLineSize)
+
+	batch := make([]*models.LinkRecord, 0, batchSize)
+	for line := 1; scanner.Scan(); line++ {
+		data := strings.TrimSpace(scanner.Text())
+		if data == "" {
+			continue
+		}
+
+		var record BackupRecord
+		err := json.Unmarshal([]byte(data), &record)
+		if err == nil {
+			err = record.validate()
+		}
+		if err != nil {
+			report.Invalid = append(report.Invalid, ImportIssue{Line: line, ID: record.ID, Error: err.Error()})
+			if fail {
+				return report, fmt.Errorf("%w: line %d, err: %s", ErrInvalidRecord, line, err)
+			}
+			continue
+		}
+
+		batch = append(batch, record.linkRecord())
+		if len(batch) < batchSize {
+			continue
+		}
+
+		if err = flush(batch); err != nil {
+			return report, err
+		}
+		batch = make([]*models.LinkRecord, 0, batchSize)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return report, fmt.Errorf("can't read import data, err: %w", err)
+	}
+
+	if err := flush(batch); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// checkImportConflicts - ошибка ErrImportConflict, если проверка пачки нашла конфликты, ID конфликтующих записей пишутся в отчёт
+func checkImportConflicts(batch []*models.LinkRecord, report *ImportLinksReport) error {
+	var conflicts []string
+	for _, v := range batch {
+		if v.Status == models.LinkConflict {
+			conflicts = append(conflicts, v.ID)
+		}
+	}
+
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	report.Conflicts = append(report.Conflicts, conflicts...)
+
+	return fmt.Errorf("%w: ids %s", ErrImportConflict, strings.Join(conflicts, ", "))
+}
+
+// Export - функция сервиса для выгрузки всех ссылок в формате NDJSON
+func (s *ServiceURL) Export(ctx context.Context, w io.Writer) (int, error) {
+	return ExportLinks(ctx, s.repository, w)
+}
+
+// Import - функция сервиса для загрузки ссылок из NDJSON
+func (s *ServiceURL) Import(ctx context.Context, r io.Reader, opts ImportLinksOptions) (*ImportLinksReport, error) {
+	return ImportLinks(ctx, s.repository, r, opts)
+}
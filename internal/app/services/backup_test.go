@@ -0,0 +1,166 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/models"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/services"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/storage"
+	"github.com/kirill-chelyatnikov/shortener-url-service/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	log := logger.InitLogger()
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	expiredAt := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+
+	from := storage.NewMapStorage(log)
+	require.NoError(t, from.AddURL(ctx, &models.Link{ID: "abc", BaseURL: "https://first.com", Hash: "user", CorrelationID: "1", ExpiresAt: &expiresAt}))
+	require.NoError(t, from.AddURL(ctx, &models.Link{ID: "abd", BaseURL: "https://second.com", Hash: "user"}))
+	require.NoError(t, from.UpdateHash(ctx, &models.Link{BaseURL: "https://first.com", Hash: "second"}))
+	require.NoError(t, from.AddURL(ctx, &models.Link{ID: "abe", BaseURL: "https://expired.com", Hash: "user", ExpiresAt: &expiredAt}))
+	require.NoError(t, from.DeleteURLS(ctx, []*models.Link{{ID: "abd", Hash: "user"}}))
+
+	var buf bytes.Buffer
+	count, err := services.ExportLinks(ctx, from, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+	var record services.BackupRecord
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	assert.Equal(t, "abc", record.ID)
+	assert.Equal(t, []string{"second", "user"}, record.Owners)
+	assert.Equal(t, "1", record.CorrelationID)
+	require.NotNil(t, record.CreatedAt)
+
+	to := storage.NewMapStorage(log)
+	report, err := services.ImportLinks(ctx, to, bytes.NewReader(buf.Bytes()), services.ImportLinksOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Created)
+	assert.Empty(t, report.Invalid)
+
+	// удалённая и истёкшая ссылки переносятся, но остаются недоступными
+	for _, id := range []string{"abd", "abe"} {
+		_, err = to.GetURLByID(ctx, id)
+		assert.ErrorIs(t, err, storage.ErrGone)
+	}
+
+	var exported bytes.Buffer
+	_, err = services.ExportLinks(ctx, to, &exported)
+	require.NoError(t, err)
+	assert.Equal(t, buf.String(), exported.String())
+
+	// повторный импорт того же файла ничего не меняет
+	report, err = services.ImportLinks(ctx, to, bytes.NewReader(buf.Bytes()), services.ImportLinksOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, report.Created)
+	assert.Equal(t, 3, report.Existed)
+}
+
+func TestImportLinks(t *testing.T) {
+	const data = `{"id":"abc","base_url":"https://first.com","owners":["user"]}
+
+{"id":"abd","base_url":"","owners":["user"]}
+{"id":"api","base_url":"https://reserved.com","owners":["user"]}
+{"id":"abe","base_url":"https://no-owners.com","owners":[]}
+{"id":"abf","base_url":"https://expired.com","owners":["user"],"expires_at":"2000-01-01T00:00:00Z"}
+not json
+{"id":"taken","base_url":"https://new.com","owners":["user"]}
+`
+
+	tests := []struct {
+		name        string
+		opts        services.ImportLinksOptions
+		wantErr     error
+		wantCreated int
+		wantTaken   string
+		wantInvalid int
+	}{
+		{
+			name:        "skip",
+			opts:        services.ImportLinksOptions{OnConflict: services.ConflictSkip},
+			wantCreated: 1,
+			wantTaken:   "https://taken.com",
+			wantInvalid: 4,
+		},
+		{
+			name:        "dry run",
+			opts:        services.ImportLinksOptions{DryRun: true, OnConflict: services.ConflictOverwrite},
+			wantCreated: 0,
+			wantTaken:   "https://taken.com",
+			wantInvalid: 4,
+		},
+		{
+			name:        "overwrite",
+			opts:        services.ImportLinksOptions{OnConflict: services.ConflictOverwrite},
+			wantCreated: 1,
+			wantTaken:   "https://new.com",
+			wantInvalid: 4,
+		},
+		{
+			name:        "fail",
+			opts:        services.ImportLinksOptions{OnConflict: services.ConflictFail},
+			wantErr:     services.ErrInvalidRecord,
+			wantCreated: 0,
+			wantTaken:   "https://taken.com",
+			wantInvalid: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repository := storage.NewMapStorage(logger.InitLogger())
+			require.NoError(t, repository.AddURL(ctx, &models.Link{ID: "taken", BaseURL: "https://taken.com", Hash: "user"}))
+
+			report, err := services.ImportLinks(ctx, repository, strings.NewReader(data), tt.opts)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Len(t, report.Invalid, tt.wantInvalid)
+
+			_, err = repository.GetURLByID(ctx, "abc")
+			if tt.wantCreated == 1 {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, storage.ErrNotFound)
+			}
+
+			url, err := repository.GetURLByID(ctx, "taken")
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantTaken, url)
+		})
+	}
+}
+
+func TestImportLinksFailOnConflict(t *testing.T) {
+	ctx := context.Background()
+	repository := storage.NewMapStorage(logger.InitLogger())
+	require.NoError(t, repository.AddURL(ctx, &models.Link{ID: "taken", BaseURL: "https://taken.com", Hash: "user"}))
+
+	data := `{"id":"abc","base_url":"https://first.com","owners":["user"]}
+{"id":"taken","base_url":"https://new.com","owners":["user"]}
+`
+	report, err := services.ImportLinks(ctx, repository, strings.NewReader(data), services.ImportLinksOptions{OnConflict: services.ConflictFail})
+	require.ErrorIs(t, err, services.ErrImportConflict)
+	assert.Equal(t, []string{"taken"}, report.Conflicts)
+
+	// пачка с конфликтом не записывается частично
+	_, err = repository.GetURLByID(ctx, "abc")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	_, err = services.ImportLinks(ctx, repository, strings.NewReader(data), services.ImportLinksOptions{OnConflict: "unknown"})
+	assert.Error(t, err)
+}
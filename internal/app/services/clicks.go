@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/models"
+)
+
+// значения по умолчанию для подсчёта переходов, если они не заданы в конфиге
+const (
+	defaultClicksBufferSize    = 1024
+	defaultClicksBatchSize     = 1000
+	defaultClicksFlushInterval = 5 * time.Second
+)
+
+/*
+Click - функция сервиса для учёта перехода по ссылке. Функция никогда не блокируется:
+если буфер агрегатора заполнен, переход не учитывается
+*/
+func (s *ServiceURL) Click(event *models.ClickEvent) {
+	select {
+	case s.clicksCh <- event:
+	default:
+		s.log.Warnf("clicks buffer is full, click on %s is dropped", event.LinkID)
+	}
+}
+
+/*
+startClicksAggregator - запуск агрегатора, который копит переходы в памяти и сбрасывает их в хранилище
+при заполнении пачки или по таймеру: суммы переходов по ссылкам и сырые события для статистики
+*/
+func (s *ServiceURL) startClicksAggregator() {
+	interval := s.cfg.App.Clicks.FlushInterval
+	if interval <= 0 {
+		interval = defaultClicksFlushInterval
+	}
+
+	batchSize := s.cfg.App.Clicks.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultClicksBatchSize
+	}
+
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		clicks := make(map[string]int64)
+		events := make([]*models.ClickEvent, 0)
+		collect := func(event *models.ClickEvent) {
+			clicks[event.LinkID]++
+			events = append(events, event)
+		}
+		flush := func() {
+			if len(events) == 0 {
+				return
+			}
+
+			if err := s.repository.AddClicks(context.Background(), clicks); err != nil {
+				s.log.Errorf("can't save clicks, err: %s", err)
+			}
+			if err := s.repository.AddClickEvents(context.Background(), events); err != nil {
+				s.log.Errorf("can't save click events, err: %s", err)
+			}
+			clicks = make(map[string]int64)
+			events = make([]*models.ClickEvent, 0)
+		}
+
+		for {
+			select {
+			case event := <-s.clicksCh:
+				collect(event)
+				if len(events) >= batchSize {
+					flush()
+				}
+			case <-ticker.C:
+				flush()
+			case <-s.stop:
+				// забираем оставшиеся в буфере переходы и сохраняем их перед выходом
+				for {
+					select {
+					case event := <-s.clicksCh:
+						collect(event)
+					default:
+						flush()
+						return
+					}
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,116 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/models"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/services"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/storage"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/config"
+	"github.com/kirill-chelyatnikov/shortener-url-service/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	chromeUserAgent    = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36"
+	googlebotUserAgent = "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+)
+
+// newClicksService - сервис с хранилищем в памяти и заданными интервалами сброса переходов и подсчёта статистики
+func newClicksService(t *testing.T, cfg *config.Config) (*services.ServiceURL, *storage.MapStorage) {
+	log := logger.InitLogger()
+	repository := storage.NewMapStorage(log)
+
+	s := services.NewServiceURL(log, cfg, repository)
+	t.Cleanup(s.Close)
+
+	return s, repository
+}
+
+// redirect - переход по короткой ссылке так же, как его учитывает хендлер
+func redirect(t *testing.T, s *services.ServiceURL, id, referrer, userAgent string) {
+	_, err := s.Get(context.Background(), id)
+	require.NoError(t, err)
+
+	s.Click(&models.ClickEvent{LinkID: id, Time: time.Now(), Referrer: referrer, UserAgent: userAgent})
+}
+
+func TestClicksStats(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{}
+	cfg.App.Clicks.FlushInterval = 10 * time.Millisecond
+	cfg.App.Stats.RollupInterval = 10 * time.Millisecond
+	s, repository := newClicksService(t, cfg)
+
+	link := &models.Link{BaseURL: "https://example.com/stats", Hash: "owner"}
+	_, err := s.Add(ctx, link)
+	require.NoError(t, err)
+
+	redirect(t, s, link.ID, "https://WWW.Google.com/search?q=shortener", chromeUserAgent)
+	redirect(t, s, link.ID, "https://www.google.com/", chromeUserAgent)
+	redirect(t, s, link.ID, "", googlebotUserAgent)
+
+	// переходы сбрасываются агрегатором и учитываются в счётчиках фоновой задачей
+	var stats *models.LinkStats
+	require.Eventually(t, func() bool {
+		stats, err = s.Stats(ctx, "owner", link.ID)
+		return err == nil && len(stats.Hourly) == 1 && stats.Hourly[0].Clicks == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	bucket := time.Now().UTC().Truncate(time.Hour)
+	assert.Equal(t, bucket, stats.Hourly[0].Time)
+	require.Len(t, stats.Daily, 1)
+	assert.Equal(t, time.Date(bucket.Year(), bucket.Month(), bucket.Day(), 0, 0, 0, 0, time.UTC), stats.Daily[0].Time)
+	assert.Equal(t, int64(3), stats.Daily[0].Clicks)
+
+	assert.Equal(t, []models.StatsValue{{Value: "www.google.com", Clicks: 2}, {Value: "direct", Clicks: 1}}, stats.Referrers)
+	assert.Equal(t, []models.StatsValue{{Value: models.TrafficHuman, Clicks: 2}, {Value: models.TrafficBot, Clicks: 1}}, stats.Traffic)
+	assert.Equal(t, []models.StatsValue{{Value: "Chrome", Clicks: 2}, {Value: "Other", Clicks: 1}}, stats.Browsers)
+	assert.Equal(t, int64(3), stats.Link.Clicks)
+
+	// статистика чужой ссылки не отличается от статистики несуществующей
+	_, err = s.Stats(ctx, "stranger", link.ID)
+	assert.ErrorIs(t, err, services.ErrLinkNotOwned)
+	_, err = s.Stats(ctx, "owner", "unknown")
+	assert.ErrorIs(t, err, services.ErrLinkNotOwned)
+
+	// владелец видит статистику и после удаления ссылки
+	require.NoError(t, repository.DeleteURLS(ctx, []*models.Link{{ID: link.ID, Hash: "owner"}}))
+	stats, err = s.Stats(ctx, "owner", link.ID)
+	require.NoError(t, err)
+	require.Len(t, stats.Hourly, 1)
+	assert.Equal(t, int64(3), stats.Hourly[0].Clicks)
+}
+
+func TestClicksAggregatorFlushesFullBatch(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{}
+	cfg.App.Clicks.BatchSize = 2
+	cfg.App.Clicks.FlushInterval = time.Hour
+	s, repository := newClicksService(t, cfg)
+
+	link := &models.Link{BaseURL: "https://example.com/batch", Hash: "owner"}
+	_, err := s.Add(ctx, link)
+	require.NoError(t, err)
+
+	clicks := func() int64 {
+		stored, err := repository.GetLinkByID(ctx, link.ID)
+		require.NoError(t, err)
+		return stored.Clicks
+	}
+
+	// заполненная пачка сбрасывается сразу, не дожидаясь таймера
+	redirect(t, s, link.ID, "", chromeUserAgent)
+	redirect(t, s, link.ID, "", chromeUserAgent)
+	assert.Eventually(t, func() bool { return clicks() == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	redirect(t, s, link.ID, "", chromeUserAgent)
+	assert.Never(t, func() bool { return clicks() != 2 }, 100*time.Millisecond, 10*time.Millisecond)
+
+	// при остановке сервиса неполная пачка тоже сохраняется
+	s.Close()
+	assert.Equal(t, int64(3), clicks())
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/models"
+)
+
+// значения по умолчанию для удаления ссылок, если они не заданы в конфиге
+const (
+	defaultDeleteWorkers       = 4
+	defaultDeleteBatchSize     = 100
+	defaultDeleteFlushInterval = time.Second
+)
+
+var ErrServiceStopped = errors.New("service is stopped")
+
+/*
+Delete - функция сервиса для асинхронного удаления ссылок пользователя.
+Ссылки передаются в общий канал отдельной горутиной, поэтому функция не ждёт ни воркеров, ни хранилища
+*/
+func (s *ServiceURL) Delete(_ context.Context, hash string, ids []string) error {
+	if len(ids) == 0 {
+		return errors.New("passed an empty array of ids")
+	}
+
+	s.deleteMutex.RLock()
+	defer s.deleteMutex.RUnlock()
+
+	if s.deleteStopped {
+		return ErrServiceStopped
+	}
+
+	s.deleteProducers.Add(1)
+	go func() {
+		defer s.deleteProducers.Done()
+
+		for _, id := range ids {
+			s.deleteCh <- &models.Link{ID: id, Hash: hash}
+		}
+	}()
+
+	return nil
+}
+
+// startDeleteWorkers - запуск пула воркеров, которые читают ссылки из общего канала и удаляют их пачками
+func (s *ServiceURL) startDeleteWorkers() {
+	workers := s.cfg.App.Delete.Workers
+	if workers <= 0 {
+		workers = defaultDeleteWorkers
+	}
+
+	for i := 0; i < workers; i++ {
+		s.workers.Add(1)
+		go s.deleteWorker()
+	}
+}
+
+// deleteWorker - воркер удаления, сбрасывает пачку в хранилище при её заполнении или по таймеру
+func (s *ServiceURL) deleteWorker() {
+	defer s.workers.Done()
+
+	batchSize := s.cfg.App.Delete.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultDeleteBatchSize
+	}
+
+	flushInterval := s.cfg.App.Delete.FlushInterval
+	if flushInterval <= 0 {
+		flushInterval = defaultDeleteFlushInterval
+	}
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*models.Link, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		if err := s.repository.DeleteURLS(context.Background(), batch); err != nil {
+			s.log.Errorf("can't delete links batch, err: %s", err)
+		} else {
+			s.log.Infof("links batch deleted: %d links", len(batch))
+		}
+		batch = make([]*models.Link, 0, batchSize)
+	}
+
+	for {
+		select {
+		case link, ok := <-s.deleteCh:
+			if !ok {
+				flush()
+				return
+			}
+
+			batch = append(batch, link)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"time"
+)
+
+// значение по умолчанию для периода очистки ссылок с истёкшим сроком действия
+const defaultSweepInterval = time.Minute
+
+/*
+startExpiredSweeper - запуск воркера, который периодически удаляет из хранилища ссылки с истёкшим сроком действия.
+Ссылка удаляется спустя Retention после истечения срока, до этого она отдаёт 410
+*/
+func (s *ServiceURL) startExpiredSweeper() {
+	interval := s.cfg.App.Expire.SweepInterval
+	if interval <= 0 {
+		interval = defaultSweepInterval
+	}
+
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				s.sweepExpired()
+			}
+		}
+	}()
+}
+
+// sweepExpired - удаление ссылок, срок действия которых истёк раньше, чем Retention назад
+func (s *ServiceURL) sweepExpired() {
+	before := time.Now().Add(-s.cfg.App.Expire.Retention)
+
+	count, err := s.repository.DeleteExpiredURLS(context.Background(), before)
+	if err != nil {
+		s.log.Errorf("can't delete expired links, err: %s", err)
+		return
+	}
+
+	if count > 0 {
+		s.log.Infof("expired links deleted: %d links", count)
+	}
+}
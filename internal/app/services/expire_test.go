@@ -0,0 +1,46 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/models"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/storage"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpiredSweeper(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{}
+	cfg.App.Expire.SweepInterval = 10 * time.Millisecond
+	cfg.App.Expire.Retention = time.Hour
+	s, repository := newClicksService(t, cfg)
+
+	old := time.Now().Add(-2 * time.Hour)
+	recent := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	links := []*models.Link{
+		{ID: "old", BaseURL: "https://example.com/old", Hash: "owner", ExpiresAt: &old},
+		{ID: "recent", BaseURL: "https://example.com/recent", Hash: "owner", ExpiresAt: &recent},
+		{ID: "active", BaseURL: "https://example.com/active", Hash: "owner", ExpiresAt: &future},
+	}
+	require.NoError(t, repository.AddURLSBatch(ctx, links))
+
+	// ссылка, истёкшая раньше Retention, удаляется полностью
+	assert.Eventually(t, func() bool {
+		_, err := s.Get(ctx, "old")
+		return errors.Is(err, storage.ErrNotFound)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// недавно истёкшая ссылка до конца Retention отдаёт 410, действующая работает
+	_, err := s.Get(ctx, "recent")
+	assert.ErrorIs(t, err, storage.ErrGone)
+
+	url, err := s.Get(ctx, "active")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/active", url)
+}
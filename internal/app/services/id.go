@@ -0,0 +1,201 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"go.uber.org/zap"
+
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/models"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/config"
+	"github.com/kirill-chelyatnikov/shortener-url-service/pkg"
+	"github.com/kirill-chelyatnikov/shortener-url-service/pkg/hashids"
+)
+
+// стратегии генерации коротких ID (Config.App.IDStrategy)
+const (
+	IDStrategyRandom     = "random"     // случайная строка из crypto/rand
+	IDStrategySequential = "sequential" // значение счётчика хранилища в base62
+	IDStrategyHashids    = "hashids"    // значение счётчика хранилища, закодированное hashids с солью
+	IDStrategyHash       = "hash"       // хеш исходного URL, повторное сокращение даёт тот же ID
+	IDStrategyBlock      = "block"      // base62 из блоков ID, зарезервированных в хранилище
+)
+
+// значения по умолчанию для генерации коротких ID, если они не заданы в конфиге
+const (
+	defaultShortedURLLen = 10
+	defaultIDAttempts    = 5
+)
+
+// ErrIDCollision - сгенерированный ID уже занят, хранилища оборачивают её при нарушении уникальности id
+var ErrIDCollision = errors.New("short id is already taken")
+
+/*
+IDGenerator - стратегия генерации коротких ID ссылок.
+attempt - номер попытки вставки начиная с 1, детерминированные стратегии используют его, чтобы при коллизии выдать другой ID
+*/
+type IDGenerator interface {
+	NewID(ctx context.Context, link *models.Link, attempt int) (string, error)
+}
+
+// sequenceFunc - получение следующего значения счётчика ID из хранилища
+type sequenceFunc func(ctx context.Context) (uint64, error)
+
+// idSequence - счётчик ID хранилища, на котором основаны последовательные стратегии
+type idSequence interface {
+	NextID(ctx context.Context) (uint64, error)
+	ReserveIDBlock(ctx context.Context, size uint64) (uint64, error)
+}
+
+// generatorCloser - генератор с фоновой работой, которую нужно дождаться при остановке сервиса
+type generatorCloser interface {
+	Close()
+}
+
+// randomGenerator - случайные ID заданной длины
+type randomGenerator struct {
+	length int
+}
+
+func (g *randomGenerator) NewID(_ context.Context, _ *models.Link, _ int) (string, error) {
+	return pkg.GenerateRandomString(g.length)
+}
+
+// sequentialGenerator - короткие последовательные ID: значение счётчика в base62
+type sequentialGenerator struct {
+	next sequenceFunc
+}
+
+func (g *sequentialGenerator) NewID(ctx context.Context, _ *models.Link, _ int) (string, error) {
+	n, err := g.next(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return new(big.Int).SetUint64(n).Text(62), nil
+}
+
+// hashidsGenerator - значение счётчика, закодированное hashids, чтобы ID нельзя было перебрать по порядку
+type hashidsGenerator struct {
+	next    sequenceFunc
+	hashids *hashids.HashID
+}
+
+func (g *hashidsGenerator) NewID(ctx context.Context, _ *models.Link, _ int) (string, error) {
+	n, err := g.next(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return g.hashids.Encode(n)
+}
+
+// hashGenerator - ID из sha256 исходного URL в base62, при коллизии к URL добавляется номер попытки
+type hashGenerator struct {
+	length int
+}
+
+func (g *hashGenerator) NewID(_ context.Context, link *models.Link, attempt int) (string, error) {
+	content := link.BaseURL
+	if attempt > 1 {
+		content += "#" + strconv.Itoa(attempt)
+	}
+
+	sum := sha256.Sum256([]byte(content))
+	id := new(big.Int).SetBytes(sum[:]).Text(62)
+	if len(id) > g.length {
+		id = id[:g.length]
+	}
+
+	return id, nil
+}
+
+/*
+reservedSkipGenerator - обёртка над стратегией, пропускающая ID, совпадающие с зарезервированными путями.
+Последовательные стратегии при повторном вызове берут следующее значение счётчика, детерминированные получают
+следующий номер попытки
+*/
+type reservedSkipGenerator struct {
+	next IDGenerator
+}
+
+func (g *reservedSkipGenerator) NewID(ctx context.Context, link *models.Link, attempt int) (string, error) {
+	// каждый повторный вызов даёт новый ID, поэтому хватает по одной попытке на зарезервированный путь
+	for i := 0; i <= len(reservedAliases); i++ {
+		id, err := g.next.NewID(ctx, link, attempt+i)
+		if err != nil {
+			return "", err
+		}
+
+		if !isReservedID(id) {
+			return id, nil
+		}
+	}
+
+	return "", fmt.Errorf("can't generate id that differs from reserved paths")
+}
+
+func (g *reservedSkipGenerator) Close() {
+	if closer, ok := g.next.(generatorCloser); ok {
+		closer.Close()
+	}
+}
+
+// newIDGenerator - создание генератора ID по стратегии из конфига, сгенерированные ID не совпадают с зарезервированными путями
+func newIDGenerator(log *zap.SugaredLogger, cfg *config.Config, sequence idSequence) (IDGenerator, error) {
+	generator, err := newStrategyGenerator(log, cfg, sequence)
+	if err != nil {
+		return nil, err
+	}
+
+	return &reservedSkipGenerator{next: generator}, nil
+}
+
+// newStrategyGenerator - создание генератора ID по стратегии из конфига, по умолчанию используются случайные ID
+func newStrategyGenerator(log *zap.SugaredLogger, cfg *config.Config, sequence idSequence) (IDGenerator, error) {
+	// ID длиннее aliasMaxLen не помещаются в хранилище и не проходят проверку при импорте
+	length := int(cfg.App.ShortedURLLen)
+	if length <= 0 {
+		length = defaultShortedURLLen
+	}
+	if length > aliasMaxLen {
+		return nil, fmt.Errorf("short url length %d exceeds maximum id length %d", length, aliasMaxLen)
+	}
+	if cfg.App.Hashids.MinLength > aliasMaxLen {
+		return nil, fmt.Errorf("hashids min length %d exceeds maximum id length %d", cfg.App.Hashids.MinLength, aliasMaxLen)
+	}
+
+	switch cfg.App.IDStrategy {
+	case "", IDStrategyRandom:
+		return &randomGenerator{length: length}, nil
+	case IDStrategySequential:
+		return &sequentialGenerator{next: sequence.NextID}, nil
+	case IDStrategyHashids:
+		h, err := hashids.New(cfg.App.Hashids.Salt, cfg.App.Hashids.MinLength)
+		if err != nil {
+			return nil, fmt.Errorf("can't create hashids encoder, err: %s", err)
+		}
+
+		return &hashidsGenerator{next: sequence.NextID, hashids: h}, nil
+	case IDStrategyHash:
+		return &hashGenerator{length: length}, nil
+	case IDStrategyBlock:
+		allocator := newBlockAllocator(log, cfg.App.IDBlock.Size, cfg.App.IDBlock.Refill, sequence.ReserveIDBlock)
+		return &blockGenerator{allocator: allocator}, nil
+	default:
+		return nil, fmt.Errorf("unknown id strategy: %s", cfg.App.IDStrategy)
+	}
+}
+
+// idAttempts - максимальное количество попыток вставки с новым ID при коллизиях
+func (s *ServiceURL) idAttempts() int {
+	if s.cfg.App.IDAttempts <= 0 {
+		return defaultIDAttempts
+	}
+
+	return s.cfg.App.IDAttempts
+}
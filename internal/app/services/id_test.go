@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/models"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/config"
+	"github.com/kirill-chelyatnikov/shortener-url-service/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testLog = logger.InitLogger()
+
+// testSequence - счётчик ID в памяти вместо хранилища
+type testSequence struct {
+	mutex    sync.Mutex
+	n        uint64
+	reserves int
+}
+
+func (s *testSequence) NextID(_ context.Context) (uint64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.n++
+	return s.n, nil
+}
+
+func (s *testSequence) ReserveIDBlock(_ context.Context, size uint64) (uint64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	start := s.n + 1
+	s.n += size
+	s.reserves++
+
+	return start, nil
+}
+
+func TestIDGenerators(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		length   uint8
+		// want - ожидаемые ID двух первых ссылок, пустое значение - проверяется только длина
+		want []string
+		// deterministic - повторная генерация для того же URL даёт тот же ID
+		deterministic bool
+	}{
+		{name: "default", length: 8},
+		{name: "random", strategy: IDStrategyRandom, length: 12},
+		{name: "sequential", strategy: IDStrategySequential, want: []string{"1", "2"}},
+		{name: "hashids", strategy: IDStrategyHashids, want: []string{"xkXG8Z", "zmdv8v"}},
+		{name: "hash", strategy: IDStrategyHash, length: 10, deterministic: true},
+		{name: "block", strategy: IDStrategyBlock, want: []string{"1", "2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.App.IDStrategy = tt.strategy
+			cfg.App.ShortedURLLen = tt.length
+			cfg.App.Hashids.Salt = "salt"
+			cfg.App.Hashids.MinLength = 6
+
+			generator, err := newIDGenerator(testLog, cfg, &testSequence{})
+			require.NoError(t, err)
+
+			ctx := context.Background()
+			link := &models.Link{BaseURL: "https://example.com"}
+
+			first, err := generator.NewID(ctx, link, 1)
+			require.NoError(t, err)
+			second, err := generator.NewID(ctx, link, 1)
+			require.NoError(t, err)
+
+			if tt.want != nil {
+				assert.Equal(t, tt.want, []string{first, second})
+				return
+			}
+
+			assert.Len(t, first, int(tt.length))
+			if !tt.deterministic {
+				assert.NotEqual(t, first, second)
+				return
+			}
+
+			assert.Equal(t, first, second)
+
+			// при коллизии детерминированная стратегия должна выдать другой ID
+			retry, err := generator.NewID(ctx, link, 2)
+			require.NoError(t, err)
+			assert.NotEqual(t, first, retry)
+		})
+	}
+}
+
+func TestNewIDGeneratorInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		strategy  string
+		length    uint8
+		minLength int
+	}{
+		{name: "unknown_strategy", strategy: "unknown"},
+		{name: "long_random", strategy: IDStrategyRandom, length: aliasMaxLen + 1},
+		{name: "long_hash", strategy: IDStrategyHash, length: 255},
+		{name: "long_hashids", strategy: IDStrategyHashids, minLength: aliasMaxLen + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.App.IDStrategy = tt.strategy
+			cfg.App.ShortedURLLen = tt.length
+			cfg.App.Hashids.MinLength = tt.minLength
+
+			_, err := newIDGenerator(testLog, cfg, &testSequence{})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestIDGeneratorsSkipReserved(t *testing.T) {
+	// 40008 в base62 - "api", 40009 - "apj"
+	for _, strategy := range []string{IDStrategySequential, IDStrategyBlock} {
+		t.Run(strategy, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.App.IDStrategy = strategy
+
+			generator, err := newIDGenerator(testLog, cfg, &testSequence{n: 40007})
+			require.NoError(t, err)
+			defer generator.(generatorCloser).Close()
+
+			id, err := generator.NewID(context.Background(), &models.Link{BaseURL: "https://example.com"}, 1)
+			require.NoError(t, err)
+			assert.Equal(t, "apj", id)
+		})
+	}
+}
+
+func TestBlockAllocator(t *testing.T) {
+	const (
+		instances = 3
+		perWorker = 500
+		workers   = 4
+	)
+
+	// несколько экземпляров сервиса с общим хранилищем не должны выдать один и тот же ID
+	sequence := &testSequence{}
+	allocators := make([]*blockAllocator, instances)
+	for i := range allocators {
+		allocators[i] = newBlockAllocator(testLog, 100, 0.2, sequence.ReserveIDBlock)
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	ids := make(map[uint64]struct{})
+
+	for _, allocator := range allocators {
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(allocator *blockAllocator) {
+				defer wg.Done()
+
+				for j := 0; j < perWorker; j++ {
+					id, err := allocator.Next(context.Background())
+					if !assert.NoError(t, err) {
+						return
+					}
+
+					mutex.Lock()
+					_, ok := ids[id]
+					assert.False(t, ok, "duplicate id %d", id)
+					ids[id] = struct{}{}
+					mutex.Unlock()
+				}
+			}(allocator)
+		}
+	}
+	wg.Wait()
+
+	for _, allocator := range allocators {
+		allocator.Close()
+	}
+
+	assert.Len(t, ids, instances*workers*perWorker)
+	// хранилище резервирует ID блоками, а не на каждый ID
+	assert.Less(t, sequence.reserves, len(ids)/50)
+}
+
+func TestBlockAllocatorRefill(t *testing.T) {
+	sequence := &testSequence{}
+	allocator := newBlockAllocator(testLog, 10, 0.5, sequence.ReserveIDBlock)
+
+	// после выдачи половины блока следующий блок резервируется в фоне
+	for i := 0; i < 5; i++ {
+		_, err := allocator.Next(context.Background())
+		require.NoError(t, err)
+	}
+	allocator.Close()
+
+	assert.Equal(t, 2, sequence.reserves)
+
+	// остаток текущего блока и начало резервного выдаются без обращения к хранилищу
+	for i := 0; i < 6; i++ {
+		_, err := allocator.Next(context.Background())
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, sequence.reserves)
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/models"
+)
+
+// значения по умолчанию для выдачи ID блоками, если они не заданы в конфиге
+const (
+	defaultIDBlockSize    = 1000
+	defaultIDBlockRefill  = 0.2
+	defaultIDBlockTimeout = 5 * time.Second
+)
+
+// idBlock - зарезервированный в хранилище диапазон ID [next, end)
+type idBlock struct {
+	next uint64
+	end  uint64
+}
+
+/*
+blockAllocator - выдача ID из зарезервированных в хранилище блоков без обращения к хранилищу на каждый ID.
+Когда в текущем блоке остаётся refillAt ID, следующий блок резервируется в фоне,
+поэтому обращение к хранилищу в момент выдачи ID нужно, только если фоновое резервирование не успело
+*/
+type blockAllocator struct {
+	log      *zap.SugaredLogger
+	reserve  func(ctx context.Context, size uint64) (uint64, error)
+	size     uint64
+	refillAt uint64
+
+	mutex     sync.Mutex
+	current   idBlock
+	spare     *idBlock
+	refilling bool
+	refills   sync.WaitGroup
+}
+
+// Next - получение следующего ID
+func (a *blockAllocator) Next(ctx context.Context) (uint64, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.current.next == a.current.end {
+		if a.spare != nil {
+			a.current, a.spare = *a.spare, nil
+		} else {
+			block, err := a.reserveBlock(ctx)
+			if err != nil {
+				return 0, err
+			}
+			a.current = block
+		}
+	}
+
+	id := a.current.next
+	a.current.next++
+
+	if a.current.end-a.current.next <= a.refillAt && a.spare == nil && !a.refilling {
+		a.refilling = true
+		a.refills.Add(1)
+		go a.refill()
+	}
+
+	return id, nil
+}
+
+// refill - фоновое резервирование следующего блока
+func (a *blockAllocator) refill() {
+	defer a.refills.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultIDBlockTimeout)
+	defer cancel()
+
+	block, err := a.reserveBlock(ctx)
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.refilling = false
+	if err != nil {
+		a.log.Errorf("can't reserve id block, err: %s", err)
+		return
+	}
+	a.spare = &block
+}
+
+// reserveBlock - резервирование блока в хранилище
+func (a *blockAllocator) reserveBlock(ctx context.Context) (idBlock, error) {
+	start, err := a.reserve(ctx, a.size)
+	if err != nil {
+		return idBlock{}, err
+	}
+	a.log.Infof("id block reserved: %d-%d", start, start+a.size-1)
+
+	return idBlock{next: start, end: start + a.size}, nil
+}
+
+// Close - ожидание фонового резервирования, чтобы оно не обратилось к уже закрытому хранилищу
+func (a *blockAllocator) Close() {
+	a.refills.Wait()
+}
+
+// blockGenerator - последовательные ID в base62, выдаваемые из блоков
+type blockGenerator struct {
+	allocator *blockAllocator
+}
+
+func (g *blockGenerator) NewID(ctx context.Context, _ *models.Link, _ int) (string, error) {
+	n, err := g.allocator.Next(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return new(big.Int).SetUint64(n).Text(62), nil
+}
+
+func (g *blockGenerator) Close() {
+	g.allocator.Close()
+}
+
+// newBlockAllocator - создание аллокатора с размером блока и порогом фонового резервирования из конфига
+func newBlockAllocator(log *zap.SugaredLogger, size int, refill float64, reserve func(ctx context.Context, size uint64) (uint64, error)) *blockAllocator {
+	if size <= 0 {
+		size = defaultIDBlockSize
+	}
+	if refill <= 0 || refill >= 1 {
+		refill = defaultIDBlockRefill
+	}
+
+	return &blockAllocator{
+		log:      log,
+		reserve:  reserve,
+		size:     uint64(size),
+		refillAt: uint64(float64(size) * refill),
+	}
+}
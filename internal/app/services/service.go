@@ -3,6 +3,8 @@ package services
 import (
 	"context"
 	"go.uber.org/zap"
+	"sync"
+	"time"
 
 	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/models"
 	"github.com/kirill-chelyatnikov/shortener-url-service/internal/config"
@@ -12,22 +14,93 @@ type ServiceURL struct {
 	log        *zap.SugaredLogger
 	cfg        *config.Config
 	repository RepositoryInterface
+	generator  IDGenerator
+
+	// асинхронное удаление ссылок
+	deleteCh        chan *models.Link
+	deleteMutex     sync.RWMutex
+	deleteStopped   bool
+	deleteProducers sync.WaitGroup
+
+	// буфер событий перехода по ссылкам для агрегатора
+	clicksCh chan *models.ClickEvent
+
+	// остановка и ожидание фоновых воркеров сервиса
+	stop    chan struct{}
+	workers sync.WaitGroup
 }
 
 type RepositoryInterface interface {
 	AddURL(ctx context.Context, link *models.Link) error
+	UpsertURL(ctx context.Context, link *models.Link) (bool, error)
 	AddURLSBatch(ctx context.Context, links []*models.Link) error
 	GetURLByID(ctx context.Context, id string) (string, error)
+	GetLinkByID(ctx context.Context, id string) (*models.Link, error)
 	GetAllURLSByHash(ctx context.Context, hash string) ([]*models.Link, error)
+	GetOwnedLink(ctx context.Context, id, hash string) (*models.Link, error)
 	CheckBaseURLExist(ctx context.Context, link *models.Link) (bool, error)
 	UpdateHash(ctx context.Context, link *models.Link) error
+	DeleteURLS(ctx context.Context, links []*models.Link) error
+	DeleteExpiredURLS(ctx context.Context, before time.Time) (int, error)
+	AddClicks(ctx context.Context, clicks map[string]int64) error
+	AddClickEvents(ctx context.Context, events []*models.ClickEvent) error
+	GetPendingClickEvents(ctx context.Context, limit int) ([]*models.ClickEvent, error)
+	SaveClickStats(ctx context.Context, ids []int64, counters []*models.StatsCounter) error
+	GetClickStats(ctx context.Context, id string) ([]*models.StatsCounter, error)
+	DeleteClickEvents(ctx context.Context, before time.Time) (int, error)
+	NextID(ctx context.Context) (uint64, error)
+	ReserveIDBlock(ctx context.Context, size uint64) (uint64, error)
+	CurrentID(ctx context.Context) (uint64, error)
+	ListURLS(ctx context.Context, after string, limit int) ([]*models.LinkRecord, error)
+	ImportURLS(ctx context.Context, records []*models.LinkRecord, opts models.ImportOptions) error
+	Ping(ctx context.Context) error
 	Close() error
 }
 
 func NewServiceURL(log *zap.SugaredLogger, cfg *config.Config, repository RepositoryInterface) *ServiceURL {
-	return &ServiceURL{
+	clicksBufferSize := cfg.App.Clicks.BufferSize
+	if clicksBufferSize <= 0 {
+		clicksBufferSize = defaultClicksBufferSize
+	}
+
+	generator, err := newIDGenerator(log, cfg, repository)
+	if err != nil {
+		log.Fatalf("can't create id generator, err: %s", err)
+	}
+
+	s := &ServiceURL{
 		log:        log,
 		cfg:        cfg,
 		repository: repository,
+		generator:  generator,
+		deleteCh:   make(chan *models.Link),
+		clicksCh:   make(chan *models.ClickEvent, clicksBufferSize),
+		stop:       make(chan struct{}),
+	}
+	s.startDeleteWorkers()
+	s.startExpiredSweeper()
+	s.startClicksAggregator()
+	s.startStatsRollup()
+
+	return s
+}
+
+// Close - остановка фоновых воркеров сервиса. Все уже принятые на удаление ссылки будут удалены до выхода из функции
+func (s *ServiceURL) Close() {
+	s.deleteMutex.Lock()
+	if s.deleteStopped {
+		s.deleteMutex.Unlock()
+		return
+	}
+	s.deleteStopped = true
+	s.deleteMutex.Unlock()
+
+	s.deleteProducers.Wait()
+	close(s.deleteCh)
+	close(s.stop)
+	s.workers.Wait()
+
+	if closer, ok := s.generator.(generatorCloser); ok {
+		closer.Close()
 	}
 }
@@ -0,0 +1,245 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/models"
+	"github.com/kirill-chelyatnikov/shortener-url-service/pkg/useragent"
+)
+
+// значения по умолчанию для статистики переходов, если они не заданы в конфиге
+const (
+	defaultRollupInterval  = time.Minute
+	defaultRollupBatchSize = 1000
+	defaultTopReferrers    = 10
+)
+
+// значения измерения referrer для переходов без заголовка Referer и с некорректным заголовком
+const (
+	referrerDirect  = "direct"
+	referrerUnknown = "unknown"
+)
+
+var ErrLinkNotOwned = errors.New("link not found")
+
+// Stats - функция сервиса для получения статистики переходов по ссылке пользователя
+func (s *ServiceURL) Stats(ctx context.Context, hash, id string) (*models.LinkStats, error) {
+	// владелец видит статистику и удалённой или истёкшей ссылки, статистику чужой не отдаём, не раскрывая факт её существования
+	link, err := s.repository.GetOwnedLink(ctx, id, hash)
+	if err != nil {
+		return nil, err
+	}
+	if link == nil {
+		return nil, ErrLinkNotOwned
+	}
+
+	stats := &models.LinkStats{Link: link}
+
+	counters, err := s.repository.GetClickStats(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	topReferrers := s.cfg.App.Stats.TopReferrers
+	if topReferrers <= 0 {
+		topReferrers = defaultTopReferrers
+	}
+
+	hourly := make(map[time.Time]int64)
+	daily := make(map[time.Time]int64)
+	values := make(map[string]map[string]int64)
+
+	for _, v := range counters {
+		if values[v.Dimension] == nil {
+			values[v.Dimension] = make(map[string]int64)
+		}
+		values[v.Dimension][v.Value] += v.Count
+
+		// каждый переход учитывается ровно в одном значении traffic, поэтому по нему считаются переходы за период
+		if v.Dimension == models.DimensionTraffic {
+			bucket := v.Bucket.UTC()
+			hourly[bucket] += v.Count
+			daily[time.Date(bucket.Year(), bucket.Month(), bucket.Day(), 0, 0, 0, 0, time.UTC)] += v.Count
+		}
+	}
+
+	stats.Hourly = sortedBuckets(hourly)
+	stats.Daily = sortedBuckets(daily)
+	stats.Referrers = sortedValues(values[models.DimensionReferrer])
+	if len(stats.Referrers) > topReferrers {
+		stats.Referrers = stats.Referrers[:topReferrers]
+	}
+	stats.Browsers = sortedValues(values[models.DimensionBrowser])
+	stats.OS = sortedValues(values[models.DimensionOS])
+	stats.Devices = sortedValues(values[models.DimensionDevice])
+	stats.Traffic = sortedValues(values[models.DimensionTraffic])
+
+	return stats, nil
+}
+
+/*
+startStatsRollup - запуск фоновой задачи, которая переносит сырые события переходов в почасовые счётчики статистики
+и удаляет из журнала учтённые события старше Retention
+*/
+func (s *ServiceURL) startStatsRollup() {
+	interval := s.cfg.App.Stats.RollupInterval
+	if interval <= 0 {
+		interval = defaultRollupInterval
+	}
+
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				s.rollupStats()
+				s.purgeClickEvents()
+			}
+		}
+	}()
+}
+
+// rollupStats - учёт всех накопившихся событий переходов в счётчиках, события обрабатываются пачками
+func (s *ServiceURL) rollupStats() {
+	ctx := context.Background()
+
+	batchSize := s.cfg.App.Stats.RollupBatchSize
+	if batchSize <= 0 {
+		batchSize = defaultRollupBatchSize
+	}
+
+	for {
+		events, err := s.repository.GetPendingClickEvents(ctx, batchSize)
+		if err != nil {
+			s.log.Errorf("can't get pending click events, err: %s", err)
+			return
+		}
+
+		if len(events) == 0 {
+			return
+		}
+
+		ids := make([]int64, 0, len(events))
+		for _, v := range events {
+			ids = append(ids, v.ID)
+		}
+
+		if err = s.repository.SaveClickStats(ctx, ids, aggregateClickEvents(events)); err != nil {
+			s.log.Errorf("can't save click stats, err: %s", err)
+			return
+		}
+		s.log.Infof("click events rolled up: %d events", len(events))
+
+		if len(events) < batchSize {
+			return
+		}
+	}
+}
+
+// purgeClickEvents - удаление из журнала учтённых событий, вышедших за окно хранения
+func (s *ServiceURL) purgeClickEvents() {
+	if s.cfg.App.Stats.Retention <= 0 {
+		return
+	}
+
+	count, err := s.repository.DeleteClickEvents(context.Background(), time.Now().Add(-s.cfg.App.Stats.Retention))
+	if err != nil {
+		s.log.Errorf("can't delete old click events, err: %s", err)
+		return
+	}
+
+	if count > 0 {
+		s.log.Infof("old click events deleted: %d events", count)
+	}
+}
+
+// aggregateClickEvents - свёртка событий переходов в почасовые счётчики по всем измерениям
+func aggregateClickEvents(events []*models.ClickEvent) []*models.StatsCounter {
+	counters := make(map[models.StatsCounter]int64)
+
+	for _, v := range events {
+		agent := useragent.Parse(v.UserAgent)
+		traffic := models.TrafficHuman
+		if agent.Bot {
+			traffic = models.TrafficBot
+		}
+
+		key := models.StatsCounter{LinkID: v.LinkID, Bucket: v.Time.UTC().Truncate(time.Hour)}
+		for dimension, value := range map[string]string{
+			models.DimensionReferrer: referrerHost(v.Referrer),
+			models.DimensionBrowser:  agent.Browser,
+			models.DimensionOS:       agent.OS,
+			models.DimensionDevice:   agent.Device,
+			models.DimensionTraffic:  traffic,
+		} {
+			key.Dimension = dimension
+			key.Value = value
+			counters[key]++
+		}
+	}
+
+	res := make([]*models.StatsCounter, 0, len(counters))
+	for k, v := range counters {
+		counter := k
+		counter.Count = v
+		res = append(res, &counter)
+	}
+
+	return res
+}
+
+// referrerHost - получение хоста из заголовка Referer
+func referrerHost(referrer string) string {
+	if referrer == "" {
+		return referrerDirect
+	}
+
+	u, err := url.Parse(referrer)
+	if err != nil || u.Host == "" {
+		return referrerUnknown
+	}
+
+	return strings.ToLower(u.Hostname())
+}
+
+func sortedBuckets(buckets map[time.Time]int64) []models.StatsBucket {
+	res := make([]models.StatsBucket, 0, len(buckets))
+	for k, v := range buckets {
+		res = append(res, models.StatsBucket{Time: k, Clicks: v})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Time.Before(res[j].Time)
+	})
+
+	return res
+}
+
+// sortedValues - значения измерения по убыванию количества переходов
+func sortedValues(values map[string]int64) []models.StatsValue {
+	res := make([]models.StatsValue, 0, len(values))
+	for k, v := range values {
+		res = append(res, models.StatsValue{Value: k, Clicks: v})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Clicks != res[j].Clicks {
+			return res[i].Clicks > res[j].Clicks
+		}
+		return res[i].Value < res[j].Value
+	})
+
+	return res
+}
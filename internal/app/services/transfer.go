@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/models"
+)
+
+// значение по умолчанию для размера пачки переноса ссылок
+const defaultTransferBatchSize = 500
+
+// TransferOptions - параметры переноса ссылок между хранилищами
+type TransferOptions struct {
+	After     string                                // ID последней перенесённой ссылки, перенос продолжается после него
+	BatchSize int                                   // количество ссылок, читаемых и записываемых за раз
+	OnBatch   func(progress TransferProgress) error // вызывается после записи каждой пачки, ошибка прерывает перенос
+}
+
+// TransferProgress - состояние переноса: ID последней перенесённой ссылки и счётчики результатов
+type TransferProgress struct {
+	Last      string
+	Created   int
+	Existed   int
+	Conflicts []string // ID ссылок, которые не удалось перенести из-за занятого ID или URL
+}
+
+/*
+Transfer - функция переноса всех ссылок из одного хранилища в другое пачками в порядке возрастания ID
+с сохранением ID, владельцев, correlation_id, срока действия, счётчика переходов и признака удаления.
+Повторный перенос тех же ссылок безопасен, поэтому прерванный перенос можно продолжить с After.
+Счётчик ID хранилища-приёмника сдвигается за счётчик источника, чтобы последовательные стратегии
+не выдавали ID уже перенесённых ссылок
+*/
+func Transfer(ctx context.Context, from, to RepositoryInterface, opts TransferOptions) (*TransferProgress, error) {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultTransferBatchSize
+	}
+
+	progress := &TransferProgress{Last: opts.After}
+
+	if err := syncIDSequence(ctx, from, to); err != nil {
+		return progress, err
+	}
+
+	for {
+		records, err := from.ListURLS(ctx, progress.Last, batchSize)
+		if err != nil {
+			return progress, fmt.Errorf("can't read links after %q, err: %w", progress.Last, err)
+		}
+
+		if len(records) == 0 {
+			return progress, nil
+		}
+
+		if err = to.ImportURLS(ctx, records, models.ImportOptions{}); err != nil {
+			return progress, fmt.Errorf("can't write links after %q, err: %w", progress.Last, err)
+		}
+
+		for _, v := range records {
+			switch v.Status {
+			case models.LinkCreated:
+				progress.Created++
+			case models.LinkExisted:
+				progress.Existed++
+			default:
+				progress.Conflicts = append(progress.Conflicts, v.ID)
+			}
+		}
+		progress.Last = records[len(records)-1].ID
+
+		if opts.OnBatch != nil {
+			if err = opts.OnBatch(*progress); err != nil {
+				return progress, err
+			}
+		}
+
+		if len(records) < batchSize {
+			return progress, nil
+		}
+	}
+}
+
+// syncIDSequence - сдвиг счётчика ID хранилища-приёмника не ниже счётчика источника, источник только читается
+func syncIDSequence(ctx context.Context, from, to RepositoryInterface) error {
+	last, err := from.CurrentID(ctx)
+	if err != nil {
+		return fmt.Errorf("can't read source id sequence, err: %w", err)
+	}
+
+	current, err := to.CurrentID(ctx)
+	if err != nil {
+		return fmt.Errorf("can't read destination id sequence, err: %w", err)
+	}
+
+	if current < last {
+		if _, err = to.ReserveIDBlock(ctx, last-current); err != nil {
+			return fmt.Errorf("can't advance destination id sequence, err: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/models"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/services"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/storage"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/config"
+	"github.com/kirill-chelyatnikov/shortener-url-service/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransferResume(t *testing.T) {
+	ctx := context.Background()
+	log := logger.InitLogger()
+	cfg := &config.Config{}
+	cfg.App.FileStorage = filepath.Join(t.TempDir(), "storage.json")
+
+	from, err := storage.NewFileStorage(log, cfg)
+	require.NoError(t, err)
+	defer from.Close()
+	for i := 0; i < 5; i++ {
+		link := &models.Link{ID: fmt.Sprint(i), BaseURL: fmt.Sprintf("https://example.com/%d", i), Hash: "user", CorrelationID: fmt.Sprint(i)}
+		require.NoError(t, from.AddURL(ctx, link))
+	}
+	require.NoError(t, from.UpdateHash(ctx, &models.Link{BaseURL: "https://example.com/0", Hash: "second"}))
+	require.NoError(t, from.DeleteURLS(ctx, []*models.Link{{ID: "4", Hash: "user"}}))
+
+	to := storage.NewMapStorage(log)
+	defer to.Close()
+
+	// перенос прерывается после второй пачки
+	interrupted := errors.New("interrupted")
+	progress, err := services.Transfer(ctx, from, to, services.TransferOptions{
+		BatchSize: 2,
+		OnBatch: func(progress services.TransferProgress) error {
+			if progress.Last == "3" {
+				return interrupted
+			}
+			return nil
+		},
+	})
+	require.ErrorIs(t, err, interrupted)
+	assert.Equal(t, "3", progress.Last)
+	assert.Equal(t, 4, progress.Created)
+
+	// повторный запуск с последней пачки безопасен и переносит оставшееся
+	progress, err = services.Transfer(ctx, from, to, services.TransferOptions{After: "1", BatchSize: 2})
+	require.NoError(t, err)
+	assert.Equal(t, "4", progress.Last)
+	assert.Equal(t, 1, progress.Created)
+	assert.Equal(t, 2, progress.Existed)
+	assert.Empty(t, progress.Conflicts)
+
+	links, err := to.GetAllURLSByHash(ctx, "user")
+	require.NoError(t, err)
+	require.Len(t, links, 4)
+	assert.Equal(t, "0", links[0].CorrelationID)
+
+	links, err = to.GetAllURLSByHash(ctx, "second")
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, "0", links[0].ID)
+
+	_, err = to.GetURLByID(ctx, "4")
+	assert.ErrorIs(t, err, storage.ErrGone)
+}
+
+func TestTransferAdvancesIDSequence(t *testing.T) {
+	ctx := context.Background()
+	log := logger.InitLogger()
+	cfg := &config.Config{}
+	cfg.App.IDStrategy = services.IDStrategySequential
+	// коллизия ID сразу завершает добавление ошибкой
+	cfg.App.IDAttempts = 1
+
+	from := storage.NewMapStorage(log)
+	defer from.Close()
+	source := services.NewServiceURL(log, cfg, from)
+	defer source.Close()
+	for i := 0; i < 5; i++ {
+		_, err := source.Add(ctx, &models.Link{BaseURL: fmt.Sprintf("https://example.com/%d", i), Hash: "user"})
+		require.NoError(t, err)
+	}
+
+	to := storage.NewMapStorage(log)
+	defer to.Close()
+
+	before, err := from.CurrentID(ctx)
+	require.NoError(t, err)
+
+	progress, err := services.Transfer(ctx, from, to, services.TransferOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 5, progress.Created)
+
+	// повторный запуск не сдвигает счётчики, счётчик источника не меняется вовсе
+	_, err = services.Transfer(ctx, from, to, services.TransferOptions{})
+	require.NoError(t, err)
+
+	after, err := from.CurrentID(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	current, err := to.CurrentID(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, before, current)
+
+	// новая ссылка в приёмнике не должна получить ID перенесённой
+	destination := services.NewServiceURL(log, cfg, to)
+	defer destination.Close()
+	link := &models.Link{BaseURL: "https://example.com/new", Hash: "user"}
+	_, err = destination.Add(ctx, link)
+	require.NoError(t, err)
+
+	links, err := to.GetAllURLSByHash(ctx, "user")
+	require.NoError(t, err)
+	assert.Len(t, links, 6)
+}
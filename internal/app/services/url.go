@@ -3,50 +3,129 @@ package services
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/models"
-	"github.com/kirill-chelyatnikov/shortener-url-service/pkg"
 )
 
-// Add - функция сервиса для добавления/изменения записи
+var ErrExpiredInPast = errors.New("link expiration time is in the past")
+
+// Add - функция сервиса для добавления/изменения записи. Если у записи задан ID, он используется как пользовательский алиас
 func (s *ServiceURL) Add(ctx context.Context, link *models.Link) (bool, error) {
 	// Проверка на пустоту переданных полей
 	if len(link.BaseURL) == 0 || len(link.Hash) == 0 {
 		return false, errors.New("empty url received")
 	}
 
-	// Проверяем наличие URL в БД
-	check, err := s.repository.CheckBaseURLExist(ctx, link)
-	if err != nil {
-		return false, err
+	if link.Expired(time.Now()) {
+		return false, ErrExpiredInPast
 	}
 
-	/* Если URL в базе уже существует, то добавляем хеш пользователя в массив хэшей данной записи,
-	также передаем информацию в хендлер о том, что запись мы проапдейтили, а не вставили новую, нужно для понимания
-	какой код ответа следует отдать */
-	if check {
-		if err = s.repository.UpdateHash(ctx, link); err != nil {
+	alias := link.ID
+	if alias != "" {
+		if err := validateAlias(alias); err != nil {
 			return false, err
 		}
-		return true, nil
-	}
-	/* Если URL не найден, то просто пишем его в БД.
-	Присваиваем записи ID (в случае апдейта записи, ID мы берем из БД) */
-	link.ID = pkg.GenerateRandomString()
-	if err = s.repository.AddURL(ctx, link); err != nil {
-		return false, err
 	}
 
-	return false, nil
+	/* Добавление и проверка существования URL выполняются хранилищем атомарно:
+	если URL уже сокращён, хранилище пишет в запись существующий ID и добавляет хеш пользователя к владельцам,
+	а в хендлер передается информация о том, что запись уже была, нужно для понимания какой код ответа следует отдать.
+	Присваиваем записи ID, если не передан алиас, при коллизии сгенерированного ID пробуем снова с новым */
+	attempts := s.idAttempts()
+	for attempt := 1; ; attempt++ {
+		if alias == "" {
+			id, err := s.generator.NewID(ctx, link, attempt)
+			if err != nil {
+				return false, err
+			}
+			link.ID = id
+		}
+
+		existed, err := s.repository.UpsertURL(ctx, link)
+		if alias == "" && attempt < attempts && errors.Is(err, ErrIDCollision) {
+			s.log.Warnf("generated id %s is already taken, attempt %d of %d", link.ID, attempt, attempts)
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+
+		return existed, nil
+	}
 }
 
-// AddBatch - функция сервиса для добавления записей "пачкой"
+/*
+AddBatch - функция сервиса для добавления записей "пачкой". Записям без ID (алиаса) ID генерируется.
+Результат добавления каждой записи хранилище пишет в её Status, пачка целиком завершается ошибкой только при ошибке хранилища
+*/
 func (s *ServiceURL) AddBatch(ctx context.Context, links []*models.Link) error {
 	if len(links) == 0 {
 		return errors.New("passed an empty array of references")
 	}
 
-	return s.repository.AddURLSBatch(ctx, links)
+	now := time.Now()
+	generated := make(map[*models.Link]struct{}, len(links))
+	for _, v := range links {
+		if v.Expired(now) {
+			return ErrExpiredInPast
+		}
+
+		if v.ID == "" {
+			generated[v] = struct{}{}
+			continue
+		}
+
+		if err := validateAlias(v.ID); err != nil {
+			return fmt.Errorf("%w, correlation_id: %s", err, v.CorrelationID)
+		}
+	}
+
+	/* Записи со сгенерированным занятым ID повторяются с новым ID, конфликт алиаса остаётся результатом записи.
+	Если хранилище отклонило пачку целиком из-за коллизии ID, повторяется вся пачка */
+	attempts := s.idAttempts()
+	pending := links
+	for attempt := 1; ; attempt++ {
+		for _, v := range pending {
+			v.Status = ""
+			if _, ok := generated[v]; !ok {
+				continue
+			}
+
+			id, err := s.generator.NewID(ctx, v, attempt)
+			if err != nil {
+				return err
+			}
+			v.ID = id
+		}
+
+		err := s.repository.AddURLSBatch(ctx, pending)
+		if len(generated) > 0 && attempt < attempts && errors.Is(err, ErrIDCollision) {
+			s.log.Warnf("generated id in batch is already taken, attempt %d of %d", attempt, attempts)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		retry := make([]*models.Link, 0)
+		for _, v := range pending {
+			if _, ok := generated[v]; ok && v.Status == models.LinkConflict {
+				retry = append(retry, v)
+			}
+		}
+
+		if len(retry) == 0 {
+			return nil
+		}
+		if attempt >= attempts {
+			return fmt.Errorf("%w: %d links in batch after %d attempts", ErrIDCollision, len(retry), attempts)
+		}
+
+		s.log.Warnf("%d generated ids in batch are already taken, attempt %d of %d", len(retry), attempt, attempts)
+		pending = retry
+	}
 }
 
 // Get - функция сервиса для получение записи по ID
@@ -54,6 +133,11 @@ func (s *ServiceURL) Get(ctx context.Context, id string) (string, error) {
 	return s.repository.GetURLByID(ctx, id)
 }
 
+// Ping - функция сервиса для проверки доступности хранилища
+func (s *ServiceURL) Ping(ctx context.Context) error {
+	return s.repository.Ping(ctx)
+}
+
 // GetAll - функция сервиса для получения всех записей по хешу
 func (s *ServiceURL) GetAll(ctx context.Context, hash string) ([]*models.Link, error) {
 	return s.repository.GetAllURLSByHash(ctx, hash)
@@ -0,0 +1,111 @@
+package services_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/models"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/services"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/storage"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/config"
+	"github.com/kirill-chelyatnikov/shortener-url-service/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSequentialService - сервис с последовательными ID, первые ID которых уже заняты ссылками в хранилище
+func newSequentialService(t *testing.T, attempts int, taken ...string) *services.ServiceURL {
+	log := logger.InitLogger()
+	cfg := &config.Config{}
+	cfg.App.IDStrategy = services.IDStrategySequential
+	cfg.App.IDAttempts = attempts
+
+	repository := storage.NewMapStorage(log)
+	for _, id := range taken {
+		require.NoError(t, repository.AddURL(context.Background(), &models.Link{ID: id, BaseURL: "https://taken.com/" + id, Hash: "taken"}))
+	}
+
+	s := services.NewServiceURL(log, cfg, repository)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func TestAddRetriesIDCollision(t *testing.T) {
+	s := newSequentialService(t, 3, "1", "2")
+
+	link := &models.Link{BaseURL: "https://example.com", Hash: "user"}
+	existed, err := s.Add(context.Background(), link)
+	require.NoError(t, err)
+	assert.False(t, existed)
+	assert.Equal(t, "3", link.ID)
+}
+
+func TestAddBatchRetriesIDCollision(t *testing.T) {
+	s := newSequentialService(t, 3, "1", "2")
+
+	links := []*models.Link{
+		{BaseURL: "https://first.com", Hash: "user", CorrelationID: "1"},
+		{BaseURL: "https://second.com", Hash: "user", CorrelationID: "2"},
+		{BaseURL: "https://taken.com/1", Hash: "user", CorrelationID: "3"},
+	}
+	require.NoError(t, s.AddBatch(context.Background(), links))
+
+	// повторяются только записи со сгенерированным занятым ID
+	assert.Equal(t, []string{models.LinkCreated, models.LinkCreated, models.LinkExisted},
+		[]string{links[0].Status, links[1].Status, links[2].Status})
+	assert.Equal(t, []string{"4", "5", "1"}, []string{links[0].ID, links[1].ID, links[2].ID})
+
+	for _, v := range links {
+		url, err := s.Get(context.Background(), v.ID)
+		require.NoError(t, err)
+		assert.Equal(t, v.BaseURL, url)
+	}
+}
+
+func TestAddBatchIDAttemptsExhausted(t *testing.T) {
+	s := newSequentialService(t, 2, "1", "2", "3", "4")
+
+	// занятых подряд ID больше, чем попыток
+	links := []*models.Link{{BaseURL: "https://first.com", Hash: "user"}}
+	assert.ErrorIs(t, s.AddBatch(context.Background(), links), services.ErrIDCollision)
+
+	link := &models.Link{BaseURL: "https://second.com", Hash: "user"}
+	_, err := s.Add(context.Background(), link)
+	assert.ErrorIs(t, err, services.ErrIDCollision)
+}
+
+func TestAddConcurrentSameURL(t *testing.T) {
+	const writers = 20
+
+	s := newSequentialService(t, 1)
+
+	links := make([]*models.Link, writers)
+	results := make([]bool, writers)
+	errs := make([]error, writers)
+
+	// из конкурентных сокращений одного URL ровно одно создаёт ссылку (201), остальные получают её же (409)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		links[i] = &models.Link{BaseURL: "https://concurrent.com", Hash: fmt.Sprintf("user-%d", i)}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = s.Add(context.Background(), links[i])
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for i := 0; i < writers; i++ {
+		require.NoError(t, errs[i])
+		assert.Equal(t, links[0].ID, links[i].ID)
+		if !results[i] {
+			created++
+		}
+	}
+	assert.Equal(t, 1, created)
+}
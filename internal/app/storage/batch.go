@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/models"
+)
+
+/*
+resolveBatch - определение результата добавления каждой ссылки пачки (Link.Status) без изменения хранилища.
+URL, который уже сокращён в хранилище или ранее в той же пачке, получает существующий ID и статус LinkExisted.
+Ссылка, ID которой занят, получает статус LinkConflict, остальные - LinkCreated.
+existingID - поиск действующей ссылки по URL, idTaken - поиск любой ссылки по ID в текущем состоянии хранилища
+*/
+func resolveBatch(links []*models.Link, existingID func(baseURL string) (string, bool), idTaken func(id string) bool) {
+	ids := make(map[string]struct{}, len(links))
+	baseURLs := make(map[string]string, len(links))
+
+	for _, v := range links {
+		if id, ok := existingID(v.BaseURL); ok {
+			v.ID, v.Status = id, models.LinkExisted
+			continue
+		}
+		if id, ok := baseURLs[v.BaseURL]; ok {
+			v.ID, v.Status = id, models.LinkExisted
+			continue
+		}
+
+		if _, ok := ids[v.ID]; ok || idTaken(v.ID) {
+			v.Status = models.LinkConflict
+			continue
+		}
+
+		ids[v.ID] = struct{}{}
+		baseURLs[v.BaseURL] = v.ID
+		v.Status = models.LinkCreated
+	}
+}
+
+/*
+resolveImport - определение результата импорта каждой записи (Link.Status) без изменения хранилища.
+Запись с тем же ID и URL, что уже есть в хранилище или ранее в той же пачке, получает статус LinkExisted - к ней добавляются владельцы,
+поэтому повторный импорт тех же записей безопасен. Запись, у которой занят ID или URL другой ссылкой, получает статус LinkConflict.
+С overwrite запись с занятым ID получает статус LinkOverwritten, если её URL не занят другой ссылкой.
+Удалённые и истёкшие в момент now записи URL не занимают и с действующими ссылками по URL не конфликтуют.
+baseURLByID - поиск любой ссылки по ID, existingID - поиск действующей ссылки по URL в текущем состоянии хранилища
+*/
+func resolveImport(records []*models.LinkRecord, overwrite bool, now time.Time, baseURLByID func(id string) (string, bool),
+	existingID func(baseURL string) (string, bool)) {
+	ids := make(map[string]string, len(records))
+	baseURLs := make(map[string]string, len(records))
+
+	for _, v := range records {
+		// состояние пачки важнее состояния хранилища: перезапись в пачке меняет URL записи
+		baseURL, exists := ids[v.ID]
+		if !exists {
+			baseURL, exists = baseURLByID(v.ID)
+		}
+
+		if exists && !overwrite {
+			v.Status = models.LinkConflict
+			if baseURL == v.BaseURL {
+				v.Status = models.LinkExisted
+			}
+			continue
+		}
+
+		live := !v.Deleted && !v.Expired(now)
+		if live && baseURL != v.BaseURL {
+			if id, taken := baseURLs[v.BaseURL]; taken && id != v.ID {
+				v.Status = models.LinkConflict
+				continue
+			}
+			if id, taken := existingID(v.BaseURL); taken && id != v.ID {
+				v.Status = models.LinkConflict
+				continue
+			}
+		}
+
+		ids[v.ID] = v.BaseURL
+		if live {
+			baseURLs[v.BaseURL] = v.ID
+		}
+		v.Status = models.LinkCreated
+		if exists {
+			v.Status = models.LinkOverwritten
+		}
+	}
+}
+
+/*
+retiredImports - импортируемые записи с истёкшим сроком действия, URL которых занят действующей ссылкой хранилища,
+действующей записью пачки или предыдущей такой же записью. Уникальность URL в PostgreSQL и SQLite обеспечивает
+частичный индекс по неудалённым ссылкам, поэтому такие записи сохраняются удалёнными.
+existingID - поиск действующей ссылки по URL в текущем состоянии хранилища
+*/
+func retiredImports(records []*models.LinkRecord, now time.Time, existingID func(baseURL string) (string, bool)) map[*models.LinkRecord]bool {
+	retired := make(map[*models.LinkRecord]bool)
+	claimed := make(map[string]string, len(records))
+
+	imported := func(v *models.LinkRecord) bool {
+		return v.Status == models.LinkCreated || v.Status == models.LinkOverwritten
+	}
+
+	for _, v := range records {
+		if imported(v) && !v.Deleted && !v.Expired(now) {
+			claimed[v.BaseURL] = v.ID
+		}
+	}
+
+	for _, v := range records {
+		if !imported(v) || v.Deleted || !v.Expired(now) {
+			continue
+		}
+
+		id, ok := claimed[v.BaseURL]
+		if !ok {
+			id, ok = existingID(v.BaseURL)
+		}
+		if ok && id != v.ID {
+			retired[v] = true
+			continue
+		}
+		claimed[v.BaseURL] = v.ID
+	}
+
+	return retired
+}
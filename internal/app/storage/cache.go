@@ -0,0 +1,318 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/models"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/services"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/config"
+)
+
+// значение по умолчанию для времени жизни отрицательных записей кеша
+const defaultCacheNegativeTTL = 10 * time.Second
+
+// cacheEntry - запись кеша: копия ссылки либо ошибка ErrNotFound или ErrGone для отрицательной записи
+type cacheEntry struct {
+	id        string
+	link      *models.Link
+	err       error
+	expiresAt time.Time // нулевое значение - запись живёт до вытеснения или инвалидации
+}
+
+// expired - истекло ли время жизни записи на момент now
+func (e *cacheEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+/*
+CachedStorage - декоратор хранилища с read-through LRU кешем ссылок для перехода по короткой ссылке.
+Кешируются GetURLByID и GetLinkByID, остальные методы передаются хранилищу без изменений,
+а изменяющие ссылки дополнительно сбрасывают затронутые записи кеша.
+Одновременные промахи по одному ID объединяются в один запрос к хранилищу
+*/
+type CachedStorage struct {
+	services.RepositoryInterface
+
+	log         *zap.SugaredLogger
+	size        int
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // от недавно использованных к давно использованным
+	// счётчик инвалидаций: результат загрузки, начатой до инвалидации, в кеш не попадает
+	generation uint64
+
+	group singleflight.Group
+}
+
+/*
+NewCachedStorage - конструктор кеширующего декоратора. Размер кеша задаётся в cfg.App.Cache.Size,
+TTL - необязательное время жизни найденных ссылок, NegativeTTL - время жизни записей об отсутствующих ссылках
+*/
+func NewCachedStorage(log *zap.SugaredLogger, cfg *config.Config, repository services.RepositoryInterface) *CachedStorage {
+	if cfg.App.Cache.Size <= 0 {
+		log.Fatalf("can't create cached storage, cache size must be positive, got %d", cfg.App.Cache.Size)
+	}
+
+	negativeTTL := cfg.App.Cache.NegativeTTL
+	if negativeTTL <= 0 {
+		negativeTTL = defaultCacheNegativeTTL
+	}
+
+	log.Infof("using link cache: size %d, ttl %s, negative ttl %s", cfg.App.Cache.Size, cfg.App.Cache.TTL, negativeTTL)
+
+	return &CachedStorage{
+		RepositoryInterface: repository,
+		log:                 log,
+		size:                cfg.App.Cache.Size,
+		ttl:                 cfg.App.Cache.TTL,
+		negativeTTL:         negativeTTL,
+		entries:             make(map[string]*list.Element, cfg.App.Cache.Size),
+		order:               list.New(),
+	}
+}
+
+// GetURLByID - функция получения записи из кеша или хранилища
+func (c *CachedStorage) GetURLByID(ctx context.Context, id string) (string, error) {
+	link, err := c.GetLinkByID(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	return link.BaseURL, nil
+}
+
+// GetLinkByID - функция получения копии действующей записи из кеша или хранилища
+func (c *CachedStorage) GetLinkByID(ctx context.Context, id string) (*models.Link, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if entry, ok := c.get(id, time.Now()); ok {
+		return entryResult(entry)
+	}
+
+	ch := c.group.DoChan(id, func() (interface{}, error) {
+		return c.load(ctx, id)
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		// загрузку выполнял запрос, контекст которого уже отменён, - повторяем её со своим контекстом
+		if res.Err != nil && isContextErr(res.Err) && ctx.Err() == nil {
+			entry, err := c.load(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			return entryResult(entry)
+		}
+		if res.Err != nil {
+			return nil, res.Err
+		}
+
+		return entryResult(res.Val.(*cacheEntry))
+	}
+}
+
+// load - загрузка записи из хранилища и сохранение её в кеш, ошибки кроме ErrNotFound и ErrGone не кешируются
+func (c *CachedStorage) load(ctx context.Context, id string) (*cacheEntry, error) {
+	c.mutex.Lock()
+	generation := c.generation
+	c.mutex.Unlock()
+
+	link, err := c.RepositoryInterface.GetLinkByID(ctx, id)
+	now := time.Now()
+	entry := &cacheEntry{id: id, link: link, err: err}
+
+	switch {
+	case err == nil:
+		if c.ttl > 0 {
+			entry.expiresAt = now.Add(c.ttl)
+		}
+		// ссылка не должна открываться из кеша после истечения своего срока действия
+		if link.ExpiresAt != nil && (entry.expiresAt.IsZero() || link.ExpiresAt.Before(entry.expiresAt)) {
+			entry.expiresAt = *link.ExpiresAt
+		}
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrGone):
+		entry.expiresAt = now.Add(c.negativeTTL)
+	default:
+		return nil, err
+	}
+
+	c.put(entry, generation)
+
+	return entry, nil
+}
+
+// entryResult - результат запроса по записи кеша, ссылка копируется, чтобы вызывающий не изменил кеш
+func entryResult(entry *cacheEntry) (*models.Link, error) {
+	if entry.err != nil {
+		return nil, entry.err
+	}
+
+	link := *entry.link
+
+	return &link, nil
+}
+
+// isContextErr - является ли ошибка ошибкой отмены или истечения контекста
+func isContextErr(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// get - получение живой записи кеша с переносом её в начало очереди LRU, истёкшая запись удаляется
+func (c *CachedStorage) get(id string, now time.Time) (*cacheEntry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	elem, ok := c.entries[id]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if entry.expired(now) {
+		c.removeElement(elem)
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+
+	return entry, true
+}
+
+// put - сохранение записи в кеш, если с начала её загрузки не было инвалидаций. Лишние записи вытесняются с конца очереди
+func (c *CachedStorage) put(entry *cacheEntry, generation uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	if elem, ok := c.entries[entry.id]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[entry.id] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.size {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// removeElement - удаление элемента из кеша, вызывается под мьютексом
+func (c *CachedStorage) removeElement(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).id)
+}
+
+// invalidate - сброс записей кеша по ID и отмена объединения с начатыми до этого загрузками
+func (c *CachedStorage) invalidate(ids ...string) {
+	c.mutex.Lock()
+	c.generation++
+	for _, id := range ids {
+		if elem, ok := c.entries[id]; ok {
+			c.removeElement(elem)
+		}
+	}
+	c.mutex.Unlock()
+
+	for _, id := range ids {
+		c.group.Forget(id)
+	}
+}
+
+// invalidateGone - сброс всех записей об удалённых и истёкших ссылках
+func (c *CachedStorage) invalidateGone() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.generation++
+	for elem := c.order.Front(); elem != nil; {
+		next := elem.Next()
+		if entry := elem.Value.(*cacheEntry); errors.Is(entry.err, ErrGone) {
+			c.removeElement(elem)
+			c.group.Forget(entry.id)
+		}
+		elem = next
+	}
+}
+
+// linkIDs - ID ссылок для инвалидации
+func linkIDs(links []*models.Link) []string {
+	ids := make([]string, 0, len(links))
+	for _, v := range links {
+		ids = append(ids, v.ID)
+	}
+
+	return ids
+}
+
+// AddURL - функция добавления записи в хранилище со сбросом отрицательной записи кеша для её ID
+func (c *CachedStorage) AddURL(ctx context.Context, link *models.Link) error {
+	defer c.invalidate(link.ID)
+
+	return c.RepositoryInterface.AddURL(ctx, link)
+}
+
+// UpsertURL - функция добавления или получения записи в хранилище со сбросом записи кеша для её ID
+func (c *CachedStorage) UpsertURL(ctx context.Context, link *models.Link) (bool, error) {
+	id := link.ID
+	existed, err := c.RepositoryInterface.UpsertURL(ctx, link)
+	c.invalidate(id, link.ID)
+
+	return existed, err
+}
+
+// AddURLSBatch - функция добавления пачки записей в хранилище со сбросом записей кеша для их ID
+func (c *CachedStorage) AddURLSBatch(ctx context.Context, links []*models.Link) error {
+	ids := linkIDs(links)
+	err := c.RepositoryInterface.AddURLSBatch(ctx, links)
+	c.invalidate(append(ids, linkIDs(links)...)...)
+
+	return err
+}
+
+// DeleteURLS - функция удаления записей в хранилище со сбросом записей кеша для их ID
+func (c *CachedStorage) DeleteURLS(ctx context.Context, links []*models.Link) error {
+	defer c.invalidate(linkIDs(links)...)
+
+	return c.RepositoryInterface.DeleteURLS(ctx, links)
+}
+
+// DeleteExpiredURLS - функция очистки истёкших ссылок в хранилище, удалённые ссылки из кеша больше не отвечают ErrGone
+func (c *CachedStorage) DeleteExpiredURLS(ctx context.Context, before time.Time) (int, error) {
+	count, err := c.RepositoryInterface.DeleteExpiredURLS(ctx, before)
+	if count > 0 {
+		c.invalidateGone()
+	}
+
+	return count, err
+}
+
+// ImportURLS - функция импорта записей в хранилище со сбросом записей кеша для их ID
+func (c *CachedStorage) ImportURLS(ctx context.Context, records []*models.LinkRecord, opts models.ImportOptions) error {
+	if !opts.DryRun {
+		ids := make([]string, 0, len(records))
+		for _, v := range records {
+			ids = append(ids, v.ID)
+		}
+		defer c.invalidate(ids...)
+	}
+
+	return c.RepositoryInterface.ImportURLS(ctx, records, opts)
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/models"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/services"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStorage - хранилище, считающее обращения к GetLinkByID и при необходимости задерживающее их
+type countingStorage struct {
+	services.RepositoryInterface
+
+	calls   atomic.Int64
+	release chan struct{}
+}
+
+func (s *countingStorage) GetLinkByID(ctx context.Context, id string) (*models.Link, error) {
+	s.calls.Add(1)
+	if s.release != nil {
+		<-s.release
+	}
+
+	return s.RepositoryInterface.GetLinkByID(ctx, id)
+}
+
+func newCachedTestStorage(size int, ttl time.Duration) (*CachedStorage, *countingStorage) {
+	cfg := &config.Config{}
+	cfg.App.Cache.Size = size
+	cfg.App.Cache.TTL = ttl
+	cfg.App.Cache.NegativeTTL = time.Hour
+
+	inner := &countingStorage{RepositoryInterface: NewMapStorage(testLog)}
+
+	return NewCachedStorage(testLog, cfg, inner), inner
+}
+
+// TestCachedStorage - кеширующий декоратор должен проходить общий набор тестов хранилища
+func TestCachedStorage(t *testing.T) {
+	testRepository(t, func(t *testing.T) services.RepositoryInterface {
+		s, _ := newCachedTestStorage(100, time.Minute)
+		return s
+	})
+}
+
+func TestCachedStorageHitsAndEviction(t *testing.T) {
+	ctx := context.Background()
+	s, inner := newCachedTestStorage(2, 0)
+
+	links := make([]*models.Link, 3)
+	for i := range links {
+		links[i] = newTestLink(uniqueURL("cache"))
+		require.NoError(t, s.AddURL(ctx, links[i]))
+	}
+
+	for i := 0; i < 3; i++ {
+		url, err := s.GetURLByID(ctx, links[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, links[0].BaseURL, url)
+	}
+	assert.Equal(t, int64(1), inner.calls.Load())
+
+	// третья ссылка вытесняет давно не использованную вторую, первая остаётся в кеше
+	_, err := s.GetURLByID(ctx, links[1].ID)
+	require.NoError(t, err)
+	_, err = s.GetURLByID(ctx, links[0].ID)
+	require.NoError(t, err)
+	_, err = s.GetURLByID(ctx, links[2].ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), inner.calls.Load())
+
+	_, err = s.GetURLByID(ctx, links[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), inner.calls.Load())
+
+	_, err = s.GetURLByID(ctx, links[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), inner.calls.Load())
+}
+
+func TestCachedStorageExpiry(t *testing.T) {
+	ctx := context.Background()
+	s, inner := newCachedTestStorage(10, 50*time.Millisecond)
+
+	link := newTestLink(uniqueURL("cache-ttl"))
+	require.NoError(t, s.AddURL(ctx, link))
+	expiresAt := time.Now().Add(150 * time.Millisecond)
+	short := newTestLink(uniqueURL("cache-expires"))
+	short.ExpiresAt = &expiresAt
+	require.NoError(t, s.AddURL(ctx, short))
+
+	_, err := s.GetURLByID(ctx, link.ID)
+	require.NoError(t, err)
+	time.Sleep(60 * time.Millisecond)
+	_, err = s.GetURLByID(ctx, link.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), inner.calls.Load())
+
+	// запись кеша не переживает срок действия ссылки
+	s.ttl = time.Hour
+	_, err = s.GetURLByID(ctx, short.ID)
+	require.NoError(t, err)
+	time.Sleep(time.Until(expiresAt))
+	_, err = s.GetURLByID(ctx, short.ID)
+	assert.ErrorIs(t, err, ErrGone)
+}
+
+func TestCachedStorageNegative(t *testing.T) {
+	ctx := context.Background()
+	s, inner := newCachedTestStorage(10, 0)
+
+	link := newTestLink(uniqueURL("cache-negative"))
+	for i := 0; i < 3; i++ {
+		_, err := s.GetURLByID(ctx, link.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+	}
+	assert.Equal(t, int64(1), inner.calls.Load())
+
+	// добавление ссылки сбрасывает отрицательную запись
+	require.NoError(t, s.AddURL(ctx, link))
+	url, err := s.GetURLByID(ctx, link.ID)
+	require.NoError(t, err)
+	assert.Equal(t, link.BaseURL, url)
+
+	// удаление сбрасывает положительную запись
+	require.NoError(t, s.DeleteURLS(ctx, []*models.Link{link}))
+	_, err = s.GetURLByID(ctx, link.ID)
+	assert.ErrorIs(t, err, ErrGone)
+
+	// перезапись импортом сбрасывает запись об удалённой ссылке
+	record := &models.LinkRecord{Link: models.Link{ID: link.ID, BaseURL: uniqueURL("cache-import")}, Owners: []string{link.Hash}}
+	require.NoError(t, s.ImportURLS(ctx, []*models.LinkRecord{record}, models.ImportOptions{Overwrite: true}))
+	url, err = s.GetURLByID(ctx, link.ID)
+	require.NoError(t, err)
+	assert.Equal(t, record.BaseURL, url)
+}
+
+func TestCachedStorageSingleflight(t *testing.T) {
+	const readers = 20
+
+	ctx := context.Background()
+	s, inner := newCachedTestStorage(10, 0)
+	link := newTestLink(uniqueURL("cache-singleflight"))
+	require.NoError(t, s.AddURL(ctx, link))
+	inner.release = make(chan struct{})
+
+	var wg sync.WaitGroup
+	urls := make([]string, readers)
+	errs := make([]error, readers)
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			urls[i], errs[i] = s.GetURLByID(ctx, link.ID)
+		}(i)
+	}
+
+	// ждём первого обращения к хранилищу, остальные читатели присоединяются к нему
+	require.Eventually(t, func() bool { return inner.calls.Load() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	close(inner.release)
+	wg.Wait()
+
+	assert.Equal(t, int64(1), inner.calls.Load())
+	for i := 0; i < readers; i++ {
+		require.NoError(t, errs[i])
+		assert.Equal(t, link.BaseURL, urls[i])
+	}
+}
@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/models"
+)
+
+// statsKey - ключ агрегированного счётчика переходов
+type statsKey struct {
+	linkID    string
+	bucket    time.Time
+	dimension string
+	value     string
+}
+
+// clickEvent - сырое событие перехода и признак того, что оно уже учтено в агрегированных счётчиках
+type clickEvent struct {
+	event    models.ClickEvent
+	rolledUp bool
+}
+
+/*
+clickLog - in-memory журнал переходов и агрегированные счётчики для хранилищ map и file.
+Журнал не потокобезопасен, синхронизация лежит на хранилище, которое его использует.
+*/
+type clickLog struct {
+	lastID   int64
+	events   []*clickEvent
+	pending  map[int64]*clickEvent
+	counters map[statsKey]int64
+}
+
+// assignIDs - присвоение идентификаторов новым событиям
+func (l *clickLog) assignIDs(events []*models.ClickEvent) {
+	for _, v := range events {
+		l.lastID++
+		v.ID = l.lastID
+	}
+}
+
+// add - добавление событий с уже присвоенными идентификаторами
+func (l *clickLog) add(events ...*models.ClickEvent) {
+	for _, v := range events {
+		event := &clickEvent{event: *v}
+		l.events = append(l.events, event)
+		l.pending[v.ID] = event
+
+		if v.ID > l.lastID {
+			l.lastID = v.ID
+		}
+	}
+}
+
+// getPending - получение не более limit событий, ещё не учтённых в счётчиках, в порядке добавления
+func (l *clickLog) getPending(limit int) []*models.ClickEvent {
+	events := make([]*models.ClickEvent, 0, limit)
+
+	for _, v := range l.events {
+		if len(events) == limit {
+			break
+		}
+
+		if !v.rolledUp {
+			event := v.event
+			events = append(events, &event)
+		}
+	}
+
+	return events
+}
+
+// checkRollup - проверка, что все события ещё не учтены в счётчиках
+func (l *clickLog) checkRollup(ids []int64) error {
+	for _, id := range ids {
+		if _, ok := l.pending[id]; !ok {
+			return fmt.Errorf("%w: click event %d is already rolled up", ErrConflict, id)
+		}
+	}
+
+	return nil
+}
+
+// rollup - пометка событий учтёнными и увеличение счётчиков
+func (l *clickLog) rollup(ids []int64, counters []*models.StatsCounter) {
+	for _, id := range ids {
+		if event, ok := l.pending[id]; ok {
+			event.rolledUp = true
+			delete(l.pending, id)
+		}
+	}
+
+	for _, v := range counters {
+		l.counters[statsKey{linkID: v.LinkID, bucket: v.Bucket.UTC(), dimension: v.Dimension, value: v.Value}] += v.Count
+	}
+}
+
+// stats - получение всех счётчиков ссылки
+func (l *clickLog) stats(linkID string) []*models.StatsCounter {
+	var counters []*models.StatsCounter
+
+	for k, v := range l.counters {
+		if k.linkID != linkID {
+			continue
+		}
+
+		counters = append(counters, &models.StatsCounter{
+			LinkID:    k.linkID,
+			Bucket:    k.bucket,
+			Dimension: k.dimension,
+			Value:     k.value,
+			Count:     v,
+		})
+	}
+
+	return counters
+}
+
+// hasPurgeable - проверка наличия учтённых в счётчиках событий, произошедших до момента before
+func (l *clickLog) hasPurgeable(before time.Time) bool {
+	for _, v := range l.events {
+		if v.rolledUp && v.event.Time.Before(before) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// purge - удаление учтённых в счётчиках событий, произошедших до момента before
+func (l *clickLog) purge(before time.Time) int {
+	events := l.events[:0]
+
+	for _, v := range l.events {
+		if v.rolledUp && v.event.Time.Before(before) {
+			continue
+		}
+		events = append(events, v)
+	}
+
+	count := len(l.events) - len(events)
+	for i := len(events); i < len(l.events); i++ {
+		l.events[i] = nil
+	}
+	l.events = events
+
+	return count
+}
+
+// removeLink - удаление событий и счётчиков ссылки
+func (l *clickLog) removeLink(linkID string) {
+	events := l.events[:0]
+
+	for _, v := range l.events {
+		if v.event.LinkID == linkID {
+			delete(l.pending, v.event.ID)
+			continue
+		}
+		events = append(events, v)
+	}
+
+	for i := len(events); i < len(l.events); i++ {
+		l.events[i] = nil
+	}
+	l.events = events
+
+	for k := range l.counters {
+		if k.linkID == linkID {
+			delete(l.counters, k)
+		}
+	}
+}
+
+/*
+snapshot - текущее состояние журнала: оставшиеся события в порядке добавления, идентификаторы уже учтённых из них
+и все счётчики. Нужно для перезаписи файла хранилища без удалённых событий
+*/
+func (l *clickLog) snapshot() ([]*models.ClickEvent, []int64, []*models.StatsCounter) {
+	events := make([]*models.ClickEvent, 0, len(l.events))
+	var rolledUp []int64
+
+	for _, v := range l.events {
+		event := v.event
+		events = append(events, &event)
+
+		if v.rolledUp {
+			rolledUp = append(rolledUp, v.event.ID)
+		}
+	}
+
+	counters := make([]*models.StatsCounter, 0, len(l.counters))
+	for k, v := range l.counters {
+		counters = append(counters, &models.StatsCounter{
+			LinkID:    k.linkID,
+			Bucket:    k.bucket,
+			Dimension: k.dimension,
+			Value:     k.value,
+			Count:     v,
+		})
+	}
+
+	return events, rolledUp, counters
+}
+
+func newClickLog() *clickLog {
+	return &clickLog{
+		pending:  make(map[int64]*clickEvent),
+		counters: make(map[statsKey]int64),
+	}
+}
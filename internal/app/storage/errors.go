@@ -1,21 +1,120 @@
 package storage
 
-import "fmt"
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/services"
+)
+
+// ошибки хранилищ, общие для всех реализаций, проверяются через errors.Is
+var (
+	ErrNotFound    = errors.New("link not found")
+	ErrConflict    = errors.New("link already exists")
+	ErrGone        = errors.New("link is gone")
+	ErrUnavailable = errors.New("storage is unavailable")
+)
+
+// uniqueViolation - код ошибки PostgreSQL при нарушении ограничения уникальности
+const uniqueViolation = "23505"
+
+// сообщения SQLite о нарушении уникальности, одинаковые для всех драйверов SQLite
+const (
+	sqliteUniqueViolation = "UNIQUE constraint failed"
+	sqliteLinkIDViolation = "UNIQUE constraint failed: links.id"
+)
+
+// linkIDConstraints - ограничения уникальности id в таблице links (первичный ключ и UNIQUE из первой миграции)
+var linkIDConstraints = map[string]struct{}{
+	"links_pkey":   {},
+	"links_id_key": {},
+}
 
 type DBError struct {
 	function string
 	msg      string
 	err      error
+	kind     error
 }
 
 func (db *DBError) Error() string {
 	return fmt.Sprintf("function: %s, msg: %s, err: %v", db.function, db.msg, db.err)
 }
 
+// Unwrap - получение исходной ошибки драйвера
+func (db *DBError) Unwrap() error {
+	return db.err
+}
+
+/*
+Is - сопоставление ошибки драйвера с ошибками хранилища (ErrNotFound, ErrConflict, ErrUnavailable).
+Нарушение уникальности id дополнительно сопоставляется с services.ErrIDCollision
+*/
+func (db *DBError) Is(target error) bool {
+	if target == services.ErrIDCollision {
+		return isIDViolation(db.err)
+	}
+
+	return db.kind != nil && db.kind == target
+}
+
 func NewDBError(function, msg string, err error) error {
 	return &DBError{
 		function: function,
 		msg:      msg,
 		err:      err,
+		kind:     dbErrorKind(err),
+	}
+}
+
+// dbErrorKind - определение типа ошибки хранилища по ошибке драйвера
+func dbErrorKind(err error) error {
+	var pgErr *pgconn.PgError
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, pgx.ErrNoRows), errors.Is(err, sql.ErrNoRows):
+		return ErrNotFound
+	case errors.As(err, &pgErr) && pgErr.Code == uniqueViolation:
+		return ErrConflict
+	case err != nil && strings.Contains(err.Error(), sqliteUniqueViolation):
+		return ErrConflict
+	case errors.As(err, &netErr), pgconn.Timeout(err):
+		return ErrUnavailable
+	default:
+		return nil
+	}
+}
+
+// isIDViolation - проверка, что ошибка драйвера - нарушение уникальности id ссылки
+func isIDViolation(err error) bool {
+	if err != nil && strings.Contains(err.Error(), sqliteLinkIDViolation) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != uniqueViolation {
+		return false
 	}
+
+	_, ok := linkIDConstraints[pgErr.ConstraintName]
+	return ok
+}
+
+// idConflictError - ошибка занятости id ссылки: ErrConflict для хендлеров и services.ErrIDCollision для сервиса
+type idConflictError struct {
+	id string
+}
+
+func (e *idConflictError) Error() string {
+	return fmt.Sprintf("%s: id %s", ErrConflict, e.id)
+}
+
+func (e *idConflictError) Is(target error) bool {
+	return target == ErrConflict || target == services.ErrIDCollision
 }
@@ -0,0 +1,386 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/models"
+)
+
+// indexEntry - запись индекса: сама ссылка, множество хешей её владельцев и признак удаления
+type indexEntry struct {
+	link    models.Link
+	owners  map[string]struct{}
+	deleted bool
+}
+
+// live - действует ли ссылка в момент now: не удалена и не истекла
+func (e *indexEntry) live(now time.Time) bool {
+	return !e.deleted && !e.link.Expired(now)
+}
+
+/*
+linkIndex - in-memory индекс ссылок, повторяющий модель PostgreSQL:
+уникальные id, уникальные baseURL среди действующих ссылок, массив хешей владельцев у каждой записи.
+Индекс не потокобезопасен, синхронизация лежит на хранилище, которое его использует.
+*/
+type linkIndex struct {
+	links  map[string]*indexEntry // id -> запись
+	ids    map[string]string      // baseURL -> id последней добавленной ссылки с этим URL
+	hashes map[string][]string    // хеш владельца -> id ссылок в порядке добавления
+}
+
+// get - получение записи по id
+func (i *linkIndex) get(id string) (*indexEntry, bool) {
+	entry, ok := i.links[id]
+	return entry, ok
+}
+
+// lookup - получение копии записи для перехода по ссылке: ErrNotFound для отсутствующей, ErrGone для удалённой или истёкшей
+func (i *linkIndex) lookup(id string, now time.Time) (*models.Link, error) {
+	entry, ok := i.links[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: can't find URL by id: %s", ErrNotFound, id)
+	}
+	if entry.deleted {
+		return nil, fmt.Errorf("%w: URL with id %s was deleted", ErrGone, id)
+	}
+	if entry.link.Expired(now) {
+		return nil, fmt.Errorf("%w: URL with id %s has expired", ErrGone, id)
+	}
+
+	link := entry.link
+	return &link, nil
+}
+
+// idByBaseURL - получение id действующей в момент now записи по исходному URL, удалённые и истёкшие ссылки не учитываются
+func (i *linkIndex) idByBaseURL(baseURL string, now time.Time) (string, bool) {
+	id, ok := i.ids[baseURL]
+	if !ok || !i.links[id].live(now) {
+		return "", false
+	}
+
+	return id, true
+}
+
+// check - проверка, что ссылки можно добавить, не нарушив уникальность id и baseURL действующих ссылок (в том числе внутри пачки)
+func (i *linkIndex) check(now time.Time, links ...*models.Link) error {
+	ids := make(map[string]struct{}, len(links))
+	baseURLs := make(map[string]struct{}, len(links))
+
+	for _, v := range links {
+		if _, ok := i.links[v.ID]; ok {
+			return &idConflictError{id: v.ID}
+		}
+		if _, ok := ids[v.ID]; ok {
+			return &idConflictError{id: v.ID}
+		}
+		if _, ok := i.idByBaseURL(v.BaseURL, now); ok {
+			return fmt.Errorf("%w: URL %s", ErrConflict, v.BaseURL)
+		}
+		if _, ok := baseURLs[v.BaseURL]; ok {
+			return fmt.Errorf("%w: URL %s", ErrConflict, v.BaseURL)
+		}
+
+		ids[v.ID] = struct{}{}
+		baseURLs[v.BaseURL] = struct{}{}
+	}
+
+	return nil
+}
+
+// resolveBatch - определение результата добавления каждой ссылки пачки по состоянию индекса в момент now
+func (i *linkIndex) resolveBatch(links []*models.Link, now time.Time) {
+	resolveBatch(links, func(baseURL string) (string, bool) {
+		return i.idByBaseURL(baseURL, now)
+	}, func(id string) bool {
+		_, ok := i.links[id]
+		return ok
+	})
+}
+
+/*
+put - добавление ссылки в индекс без проверок уникальности.
+Если запись с таким id уже есть, то к ней только добавляется хеш владельца.
+Если baseURL уже занят другой действующей в момент now ссылкой, то индекс по baseURL не перезаписывается
+*/
+func (i *linkIndex) put(link *models.Link, now time.Time) {
+	i.putEntry(link, false, now)
+	i.addOwner(link.ID, link.Hash)
+}
+
+// putEntry - добавление записи без владельцев, удалённая или истёкшая запись не занимает baseURL
+func (i *linkIndex) putEntry(link *models.Link, deleted bool, now time.Time) {
+	if _, ok := i.links[link.ID]; !ok {
+		i.links[link.ID] = &indexEntry{
+			link: models.Link{
+				ID:            link.ID,
+				BaseURL:       link.BaseURL,
+				CorrelationID: link.CorrelationID,
+				CreatedAt:     link.CreatedAt,
+				ExpiresAt:     link.ExpiresAt,
+				Clicks:        link.Clicks,
+			},
+			owners:  make(map[string]struct{}),
+			deleted: deleted,
+		}
+	}
+
+	if _, ok := i.idByBaseURL(link.BaseURL, now); !ok {
+		i.ids[link.BaseURL] = link.ID
+	}
+}
+
+// stampCreated - установка момента создания новой ссылки, если он не задан (импортированные ссылки сохраняют свой)
+func stampCreated(link *models.Link) {
+	if link.CreatedAt.IsZero() {
+		link.CreatedAt = time.Now().UTC()
+	}
+}
+
+// addOwner - добавление хеша владельца к записи, возвращает false, если хеш уже был добавлен ранее
+func (i *linkIndex) addOwner(id, hash string) bool {
+	entry, ok := i.links[id]
+	if !ok || hash == "" {
+		return false
+	}
+
+	if _, ok = entry.owners[hash]; ok {
+		return false
+	}
+
+	entry.owners[hash] = struct{}{}
+	i.hashes[hash] = append(i.hashes[hash], id)
+
+	return true
+}
+
+// hasOwner - проверка, является ли хеш владельцем записи
+func (i *linkIndex) hasOwner(id, hash string) bool {
+	entry, ok := i.links[id]
+	if !ok {
+		return false
+	}
+
+	_, ok = entry.owners[hash]
+	return ok
+}
+
+// resolveImport - определение результата импорта каждой записи по состоянию индекса в момент now
+func (i *linkIndex) resolveImport(records []*models.LinkRecord, overwrite bool, now time.Time) {
+	resolveImport(records, overwrite, now, func(id string) (string, bool) {
+		entry, ok := i.links[id]
+		if !ok {
+			return "", false
+		}
+		return entry.link.BaseURL, true
+	}, func(baseURL string) (string, bool) {
+		return i.idByBaseURL(baseURL, now)
+	})
+}
+
+// putRecord - добавление импортированной записи со всеми владельцами, для уже существующей записи добавляются только владельцы
+func (i *linkIndex) putRecord(record *models.LinkRecord, now time.Time) {
+	i.putEntry(&record.Link, record.Deleted, now)
+
+	for _, hash := range record.Owners {
+		i.addOwner(record.ID, hash)
+	}
+}
+
+// applyImport - применение импортированной записи по её статусу, перезаписываемая запись заменяется целиком
+func (i *linkIndex) applyImport(record *models.LinkRecord, now time.Time) {
+	switch record.Status {
+	case models.LinkCreated, models.LinkExisted:
+		i.putRecord(record, now)
+	case models.LinkOverwritten:
+		i.remove(record.ID)
+		i.putRecord(record, now)
+	}
+}
+
+// list - получение копий записей с ID больше after в порядке возрастания ID, включая удалённые и истёкшие
+func (i *linkIndex) list(after string, limit int) []*models.LinkRecord {
+	ids := make([]string, 0)
+	for id := range i.links {
+		if id > after {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	records := make([]*models.LinkRecord, 0, len(ids))
+	for _, id := range ids {
+		entry := i.links[id]
+
+		owners := make([]string, 0, len(entry.owners))
+		for hash := range entry.owners {
+			owners = append(owners, hash)
+		}
+		sort.Strings(owners)
+
+		records = append(records, &models.LinkRecord{
+			Link: models.Link{
+				ID:            entry.link.ID,
+				BaseURL:       entry.link.BaseURL,
+				CorrelationID: entry.link.CorrelationID,
+				CreatedAt:     entry.link.CreatedAt,
+				ExpiresAt:     entry.link.ExpiresAt,
+				Clicks:        entry.link.Clicks,
+			},
+			Owners:  owners,
+			Deleted: entry.deleted,
+		})
+	}
+
+	return records
+}
+
+/*
+markDeleted - удаление ссылки владельцем: у ссылки с несколькими владельцами удаляется только хеш hash,
+последний владелец помечает запись удалённой. Удалить запись может только её владелец
+*/
+func (i *linkIndex) markDeleted(id, hash string) bool {
+	if !i.hasOwner(id, hash) || i.links[id].deleted {
+		return false
+	}
+
+	entry := i.links[id]
+	if len(entry.owners) > 1 {
+		delete(entry.owners, hash)
+		i.unlinkHash(hash, id)
+		return true
+	}
+
+	entry.deleted = true
+	// удалённая ссылка освобождает URL для новых ссылок
+	if i.ids[entry.link.BaseURL] == id {
+		delete(i.ids, entry.link.BaseURL)
+	}
+
+	return true
+}
+
+/*
+ownerships - пары (id ссылки, хеш владельца) в порядке добавления ссылок каждому владельцу,
+повторное добавление владельцев в этом порядке восстанавливает порядок ссылок пользователя
+*/
+func (i *linkIndex) ownerships() [][2]string {
+	hashes := make([]string, 0, len(i.hashes))
+	for hash := range i.hashes {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	var res [][2]string
+	for _, hash := range hashes {
+		for _, id := range i.hashes[hash] {
+			res = append(res, [2]string{id, hash})
+		}
+	}
+
+	return res
+}
+
+// addClicks - увеличение счётчика переходов по ссылке
+func (i *linkIndex) addClicks(id string, clicks int64) {
+	if entry, ok := i.links[id]; ok {
+		entry.link.Clicks += clicks
+	}
+}
+
+// remove - удаление записи из всех индексов
+func (i *linkIndex) remove(id string) {
+	entry, ok := i.links[id]
+	if !ok {
+		return
+	}
+
+	delete(i.links, id)
+	if i.ids[entry.link.BaseURL] == id {
+		delete(i.ids, entry.link.BaseURL)
+	}
+
+	for hash := range entry.owners {
+		i.unlinkHash(hash, id)
+	}
+}
+
+// unlinkHash - удаление id из списка ссылок пользователя с хешем hash
+func (i *linkIndex) unlinkHash(hash, id string) {
+	ids := i.hashes[hash][:0]
+	for _, v := range i.hashes[hash] {
+		if v != id {
+			ids = append(ids, v)
+		}
+	}
+
+	if len(ids) == 0 {
+		delete(i.hashes, hash)
+		return
+	}
+	i.hashes[hash] = ids
+}
+
+// expired - получение id записей, срок действия которых истёк до момента before
+func (i *linkIndex) expired(before time.Time) []string {
+	var ids []string
+
+	for id, entry := range i.links {
+		if entry.link.Expired(before) {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
+
+// owned - получение копии записи, включая удалённую и истёкшую, если hash её владелец, иначе nil
+func (i *linkIndex) owned(id, hash string) *models.Link {
+	if !i.hasOwner(id, hash) {
+		return nil
+	}
+
+	link := i.links[id].link
+	link.Hash = hash
+
+	return &link
+}
+
+// byHash - получение копий всех действующих записей пользователя в порядке их добавления
+func (i *linkIndex) byHash(hash string, now time.Time) []*models.Link {
+	ids := i.hashes[hash]
+	links := make([]*models.Link, 0, len(ids))
+
+	for _, id := range ids {
+		entry := i.links[id]
+		if entry.deleted || entry.link.Expired(now) {
+			continue
+		}
+
+		links = append(links, &models.Link{
+			ID:            entry.link.ID,
+			BaseURL:       entry.link.BaseURL,
+			CorrelationID: entry.link.CorrelationID,
+			Hash:          hash,
+			CreatedAt:     entry.link.CreatedAt,
+			ExpiresAt:     entry.link.ExpiresAt,
+			Clicks:        entry.link.Clicks,
+		})
+	}
+
+	return links
+}
+
+func newLinkIndex() *linkIndex {
+	return &linkIndex{
+		links:  make(map[string]*indexEntry),
+		ids:    make(map[string]string),
+		hashes: make(map[string][]string),
+	}
+}
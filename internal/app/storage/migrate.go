@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"sync"
+
+	"github.com/pressly/goose/v3"
+	"go.uber.org/zap"
+)
+
+// каталоги миграций PostgreSQL и SQLite во встроенных файловых системах embedMigrations и embedSQLiteMigrations
+const (
+	migrationsDir       = "migrations"
+	sqliteMigrationsDir = "migrations/sqlite"
+)
+
+// migrationsLockID - ключ advisory lock PostgreSQL, которым сериализуются миграции всех экземпляров сервиса
+const migrationsLockID int64 = 7385746739
+
+/*
+gooseMutex - goose хранит диалект, файловую систему миграций и логгер в глобальных переменных,
+поэтому их установка и выполнение команды сериализуются внутри процесса
+*/
+var gooseMutex sync.Mutex
+
+// MigrateCommands - поддерживаемые команды миграций goose
+var MigrateCommands = []string{"up", "down", "status", "redo", "version"}
+
+// gooseLogger - вывод goose через логгер приложения
+type gooseLogger struct {
+	log *zap.SugaredLogger
+}
+
+func (l *gooseLogger) Fatalf(format string, v ...interface{}) {
+	l.log.Fatalf(format, v...)
+}
+
+func (l *gooseLogger) Printf(format string, v ...interface{}) {
+	l.log.Infof(format, v...)
+}
+
+/*
+Migrate - выполнение команды goose по встроенным миграциям PostgreSQL или, для DSN sqlite://, SQLite.
+Для PostgreSQL на время выполнения удерживается advisory lock, поэтому одновременный запуск миграций с нескольких экземпляров безопасен:
+остальные экземпляры ждут освобождения блокировки и видят уже применённые миграции
+*/
+func Migrate(ctx context.Context, log *zap.SugaredLogger, dsn, command string) error {
+	if !isMigrateCommand(command) {
+		return fmt.Errorf("unknown migrate command: %s", command)
+	}
+
+	if isSQLiteDSN(dsn) {
+		db, err := openSQLite(dsn)
+		if err != nil {
+			return fmt.Errorf("can't open DB for migrations, err: %s", err)
+		}
+		defer db.Close()
+
+		return migrateSQLite(ctx, log, db, command)
+	}
+
+	db, err := goose.OpenDBWithDriver("pgx", dsn)
+	if err != nil {
+		return fmt.Errorf("can't open DB for migrations, err: %s", err)
+	}
+	defer db.Close()
+
+	// advisory lock принадлежит сессии, поэтому для него берётся отдельное соединение на всё время миграций
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("can't get connection for migrations lock, err: %s", err)
+	}
+	defer conn.Close()
+
+	log.Info("waiting for migrations lock")
+	if _, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationsLockID); err != nil {
+		return fmt.Errorf("can't acquire migrations lock, err: %s", err)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationsLockID); err != nil {
+			log.Errorf("can't release migrations lock, err: %s", err)
+		}
+	}()
+
+	return runGoose(ctx, log, embedMigrations, "postgres", db, command, migrationsDir)
+}
+
+// migrateSQLite - выполнение команды goose по встроенным миграциям SQLite, запись в файл БД SQLite сериализует сама SQLite
+func migrateSQLite(ctx context.Context, log *zap.SugaredLogger, db *sql.DB, command string) error {
+	return runGoose(ctx, log, embedSQLiteMigrations, "sqlite3", db, command, sqliteMigrationsDir)
+}
+
+// runGoose - установка глобальных настроек goose и выполнение команды под gooseMutex
+func runGoose(ctx context.Context, log *zap.SugaredLogger, fsys fs.FS, dialect string, db *sql.DB, command, dir string) error {
+	gooseMutex.Lock()
+	defer gooseMutex.Unlock()
+
+	goose.SetBaseFS(fsys)
+	goose.SetLogger(&gooseLogger{log: log})
+
+	if err := goose.SetDialect(dialect); err != nil {
+		return fmt.Errorf("can't set migrations dialect, err: %s", err)
+	}
+
+	if err := goose.RunContext(ctx, command, db, dir); err != nil {
+		return fmt.Errorf("can't run migrate %s, err: %s", command, err)
+	}
+
+	return nil
+}
+
+// isMigrateCommand - проверка, что команда есть среди поддерживаемых
+func isMigrateCommand(command string) bool {
+	for _, v := range MigrateCommands {
+		if v == command {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// migrateHelperEnv - переменная окружения, с которой тестовый бинарник запускается как отдельный экземпляр, выполняющий миграции
+const migrateHelperEnv = "SHORTENER_MIGRATE_HELPER"
+
+func TestMigrateUnknownCommand(t *testing.T) {
+	// команда проверяется до подключения к БД
+	err := Migrate(context.Background(), testLog, "postgres://localhost:1/unused", "drop")
+	assert.EqualError(t, err, "unknown migrate command: drop")
+}
+
+// TestMigrateHelperProcess - не тест, а тело отдельного процесса для TestMigrate
+func TestMigrateHelperProcess(t *testing.T) {
+	if os.Getenv(migrateHelperEnv) == "" {
+		t.Skip("helper process for TestMigrate")
+	}
+
+	require.NoError(t, Migrate(context.Background(), testLog, os.Getenv(testDatabaseDSN), "up"))
+}
+
+func TestMigrate(t *testing.T) {
+	dsn := os.Getenv(testDatabaseDSN)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDatabaseDSN)
+	}
+
+	ctx := context.Background()
+
+	// одновременные миграции с нескольких экземпляров сервиса (отдельных процессов) сериализуются advisory lock
+	var wg sync.WaitGroup
+	outputs := make([][]byte, 3)
+	errs := make([]error, len(outputs))
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			cmd := exec.Command(os.Args[0], "-test.run=^TestMigrateHelperProcess$")
+			cmd.Env = append(os.Environ(), migrateHelperEnv+"=1")
+			outputs[i], errs[i] = cmd.CombinedOutput()
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		assert.NoError(t, err, string(outputs[i]))
+	}
+
+	// пока блокировку держит другая сессия, миграции ждут её освобождения
+	db, err := sql.Open("pgx", dsn)
+	require.NoError(t, err)
+	defer db.Close()
+
+	conn, err := db.Conn(ctx)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationsLockID)
+	require.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- Migrate(ctx, testLog, dsn, "up")
+	}()
+
+	select {
+	case err = <-done:
+		t.Fatalf("migrations finished while the lock was held, err: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationsLockID)
+	require.NoError(t, err)
+	assert.NoError(t, <-done)
+
+	for _, command := range []string{"status", "version", "redo"} {
+		t.Run(command, func(t *testing.T) {
+			assert.NoError(t, Migrate(ctx, testLog, dsn, command))
+		})
+	}
+}
+
+func TestMigrateSQLiteConcurrent(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// одновременные миграции в одном процессе не гоняются за глобальными настройками goose
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = Migrate(ctx, testLog, sqliteScheme+filepath.Join(dir, fmt.Sprintf("storage-%d.db", i)), "up")
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+}
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS click_events (
+    id bigserial PRIMARY KEY,
+    link_id varchar(10) NOT NULL REFERENCES links (id) ON DELETE CASCADE,
+    created_at timestamptz NOT NULL,
+    referrer text NOT NULL DEFAULT '',
+    user_agent text NOT NULL DEFAULT '',
+    rolled_up boolean NOT NULL DEFAULT false
+);
+CREATE INDEX IF NOT EXISTS click_events_pending_idx ON click_events (id) WHERE NOT rolled_up;
+CREATE INDEX IF NOT EXISTS click_events_created_at_idx ON click_events (created_at) WHERE rolled_up;
+
+CREATE TABLE IF NOT EXISTS link_stats (
+    link_id varchar(10) NOT NULL REFERENCES links (id) ON DELETE CASCADE,
+    bucket timestamptz NOT NULL,
+    dimension varchar(16) NOT NULL,
+    value text NOT NULL,
+    count bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (link_id, bucket, dimension, value)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS link_stats;
+DROP TABLE IF EXISTS click_events;
+-- +goose StatementEnd
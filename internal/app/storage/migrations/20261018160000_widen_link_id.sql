@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE links ALTER COLUMN id TYPE varchar(64);
+ALTER TABLE click_events ALTER COLUMN link_id TYPE varchar(64);
+ALTER TABLE link_stats ALTER COLUMN link_id TYPE varchar(64);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- алиасы и сгенерированные ID длиннее 10 символов не помещаются в прежний столбец, обрезка сломала бы короткие ссылки
+DO $$
+DECLARE
+    long_ids bigint;
+BEGIN
+    SELECT count(*) INTO long_ids FROM (
+        SELECT id FROM links WHERE length(id) > 10
+        UNION SELECT link_id FROM click_events WHERE length(link_id) > 10
+        UNION SELECT link_id FROM link_stats WHERE length(link_id) > 10
+    ) l;
+    IF long_ids > 0 THEN
+        RAISE EXCEPTION 'can''t narrow link id to varchar(10): % links have longer ids, remove them first', long_ids;
+    END IF;
+END $$;
+ALTER TABLE link_stats ALTER COLUMN link_id TYPE varchar(10);
+ALTER TABLE click_events ALTER COLUMN link_id TYPE varchar(10);
+ALTER TABLE links ALTER COLUMN id TYPE varchar(10);
+-- +goose StatementEnd
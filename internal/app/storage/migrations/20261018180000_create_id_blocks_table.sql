@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS id_blocks (
+    name varchar(64) PRIMARY KEY,
+    next_id bigint NOT NULL,
+    updated_at timestamptz NOT NULL DEFAULT now()
+);
+-- блоки начинаются после значений последовательности, чтобы смена стратегии не приводила к коллизиям
+INSERT INTO id_blocks (name, next_id)
+SELECT 'links', CASE WHEN is_called THEN last_value + 1 ELSE 1 END FROM link_id_seq
+ON CONFLICT (name) DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS id_blocks;
+-- +goose StatementEnd
@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS users (
+    id bigserial PRIMARY KEY,
+    hash varchar(64) NOT NULL UNIQUE,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS link_owners (
+    user_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    link_id varchar(64) NOT NULL REFERENCES links (id) ON DELETE CASCADE,
+    -- clock_timestamp, а не now, чтобы ссылки одной транзакции (пачки) сохраняли порядок добавления
+    created_at timestamptz NOT NULL DEFAULT clock_timestamp(),
+    PRIMARY KEY (user_id, link_id)
+);
+
+-- список ссылок пользователя в порядке добавления и поиск владельцев ссылки
+CREATE INDEX IF NOT EXISTS link_owners_user_id_created_at_idx ON link_owners (user_id, created_at);
+CREATE INDEX IF NOT EXISTS link_owners_link_id_idx ON link_owners (link_id);
+
+-- перенос владельцев из массива hash, порядок хешей в массиве сохраняется через created_at
+INSERT INTO users (hash)
+SELECT DISTINCT h.hash FROM links l CROSS JOIN LATERAL unnest(l.hash) AS h (hash)
+WHERE h.hash <> ''
+ON CONFLICT (hash) DO NOTHING;
+
+INSERT INTO link_owners (user_id, link_id, created_at)
+SELECT u.id, l.id, now() + h.position * interval '1 microsecond'
+FROM links l
+CROSS JOIN LATERAL unnest(l.hash) WITH ORDINALITY AS h (hash, position)
+JOIN users u ON u.hash = h.hash
+ON CONFLICT (user_id, link_id) DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS link_owners;
+DROP TABLE IF EXISTS users;
+-- +goose StatementEnd
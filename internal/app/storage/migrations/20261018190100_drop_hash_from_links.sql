@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE links DROP COLUMN IF EXISTS hash;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE links ADD COLUMN IF NOT EXISTS hash varchar(64)[] NOT NULL DEFAULT '{}';
+
+UPDATE links l SET
+    hash = o.hashes
+FROM (
+    SELECT o.link_id, array_agg(u.hash ORDER BY o.created_at) AS hashes
+    FROM link_owners o
+    JOIN users u ON u.id = o.user_id
+    GROUP BY o.link_id
+) AS o
+WHERE l.id = o.link_id;
+
+ALTER TABLE links ALTER COLUMN hash DROP DEFAULT;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- NextID перешёл с link_id_seq на id_blocks: счётчик продолжается после значений, уже выданных последовательностью
+UPDATE id_blocks SET
+    next_id = GREATEST(next_id, (SELECT CASE WHEN is_called THEN last_value + 1 ELSE 1 END FROM link_id_seq)),
+    updated_at = now()
+WHERE name = 'links';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- последовательность продолжается после значений, выданных из id_blocks
+SELECT setval('link_id_seq', next_id - 1) FROM id_blocks WHERE name = 'links' AND next_id > 1;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+-- URL уникален только среди неудалённых ссылок, истёкшие ссылки помечаются удалёнными перед добавлением новой ссылки на тот же URL
+ALTER TABLE links DROP CONSTRAINT IF EXISTS links_baseurl_key;
+CREATE UNIQUE INDEX IF NOT EXISTS links_baseurl_live_idx ON links (baseurl) WHERE NOT is_deleted;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- удалённая и действующая ссылка на один URL не проходят ограничение UNIQUE (baseurl), автоматически их не разрешить без потери данных
+DO $$
+DECLARE
+    duplicates bigint;
+BEGIN
+    SELECT count(*) INTO duplicates FROM (SELECT baseurl FROM links GROUP BY baseurl HAVING count(*) > 1) d;
+    IF duplicates > 0 THEN
+        RAISE EXCEPTION 'can''t restore UNIQUE (baseurl): % URLs are shared by several links, remove the deleted duplicates first', duplicates;
+    END IF;
+END $$;
+DROP INDEX IF EXISTS links_baseurl_live_idx;
+ALTER TABLE links ADD CONSTRAINT links_baseurl_key UNIQUE (baseurl);
+-- +goose StatementEnd
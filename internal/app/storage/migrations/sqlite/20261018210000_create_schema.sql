@@ -0,0 +1,60 @@
+-- +goose Up
+-- схема SQLite соответствует схеме PostgreSQL на версии 20261018210000, моменты времени хранятся в наносекундах Unix
+CREATE TABLE IF NOT EXISTS links (
+    id TEXT PRIMARY KEY,
+    baseurl TEXT NOT NULL,
+    correlation_id TEXT NOT NULL DEFAULT '',
+    is_deleted INTEGER NOT NULL DEFAULT 0,
+    created_at INTEGER NOT NULL,
+    expires_at INTEGER,
+    clicks INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS links_expires_at_idx ON links (expires_at) WHERE expires_at IS NOT NULL;
+-- URL уникален только среди неудалённых ссылок, истёкшие ссылки помечаются удалёнными перед добавлением новой ссылки на тот же URL
+CREATE UNIQUE INDEX IF NOT EXISTS links_baseurl_live_idx ON links (baseurl) WHERE NOT is_deleted;
+
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    hash TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS link_owners (
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    link_id TEXT NOT NULL REFERENCES links (id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, link_id)
+);
+CREATE INDEX IF NOT EXISTS link_owners_link_id_idx ON link_owners (link_id);
+
+CREATE TABLE IF NOT EXISTS click_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    link_id TEXT NOT NULL REFERENCES links (id) ON DELETE CASCADE,
+    created_at INTEGER NOT NULL,
+    referrer TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    rolled_up INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS click_events_pending_idx ON click_events (id) WHERE NOT rolled_up;
+
+CREATE TABLE IF NOT EXISTS link_stats (
+    link_id TEXT NOT NULL REFERENCES links (id) ON DELETE CASCADE,
+    bucket INTEGER NOT NULL,
+    dimension TEXT NOT NULL,
+    value TEXT NOT NULL,
+    count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (link_id, bucket, dimension, value)
+);
+
+-- замена последовательности link_id_seq, из неё же резервируются блоки ID
+CREATE TABLE IF NOT EXISTS id_sequences (
+    name TEXT PRIMARY KEY,
+    value INTEGER NOT NULL
+);
+INSERT INTO id_sequences (name, value) VALUES ('links', 0) ON CONFLICT (name) DO NOTHING;
+
+-- +goose Down
+DROP TABLE IF EXISTS id_sequences;
+DROP TABLE IF EXISTS link_stats;
+DROP TABLE IF EXISTS click_events;
+DROP TABLE IF EXISTS link_owners;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS links;
@@ -0,0 +1,4 @@
+package storage
+
+// драйвер SQLite на чистом Go регистрируется в database/sql под именем sqliteDriver
+import _ "modernc.org/sqlite"
@@ -2,21 +2,63 @@ package storage
 
 import (
 	"context"
+	"fmt"
 	"go.uber.org/zap"
+	"strings"
 
 	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/services"
 	"github.com/kirill-chelyatnikov/shortener-url-service/internal/config"
 )
 
-// NewStorage - функция получения хранилища в зафисимости от выбранного способа хранить ссылки (Map / File / DB)
-func NewStorage(ctx context.Context, log *zap.SugaredLogger, cfg *config.Config) services.RepositoryInterface {
+// NewStorage - функция получения хранилища в зафисимости от выбранного способа хранить ссылки (Map / File / SQLite / DB)
+func NewStorage(ctx context.Context, log *zap.SugaredLogger, cfg *config.Config) (services.RepositoryInterface, error) {
+	if isSQLiteDSN(cfg.DB.CDN) {
+		return asRepository(NewSQLiteStorage(ctx, log, cfg))
+	}
+
 	if cfg.DB.CDN != "" {
-		return NewPostgreSQLStorage(ctx, log, cfg)
+		return asRepository(NewPostgreSQLStorage(ctx, log, cfg))
 	}
 
 	if cfg.App.FileStorage != "" {
-		return NewFileStorage(log, cfg)
+		return asRepository(NewFileStorage(log, cfg))
+	}
+
+	return NewMapStorage(log), nil
+}
+
+/*
+NewStorageFromDSN - функция получения хранилища по строке подключения:
+file:<путь> - файловое хранилище, sqlite://<путь> - SQLite, postgres://... или postgresql://... - PostgreSQL, memory: - хранилище в памяти
+*/
+func NewStorageFromDSN(ctx context.Context, log *zap.SugaredLogger, cfg *config.Config, dsn string) (services.RepositoryInterface, error) {
+	c := *cfg
+
+	switch {
+	case strings.HasPrefix(dsn, "file:"):
+		c.App.FileStorage = strings.TrimPrefix(dsn, "file:")
+		if c.App.FileStorage == "" {
+			return nil, fmt.Errorf("empty file path in DSN %s", dsn)
+		}
+		return asRepository(NewFileStorage(log, &c))
+	case isSQLiteDSN(dsn):
+		c.DB.CDN = dsn
+		return asRepository(NewSQLiteStorage(ctx, log, &c))
+	case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"):
+		c.DB.CDN = dsn
+		return asRepository(NewPostgreSQLStorage(ctx, log, &c))
+	case dsn == "memory:":
+		return NewMapStorage(log), nil
+	default:
+		return nil, fmt.Errorf("unsupported storage DSN: %s", dsn)
+	}
+}
+
+// asRepository - приведение результата конструктора к интерфейсу хранилища без nil-указателя в интерфейсе при ошибке
+func asRepository[T services.RepositoryInterface](repository T, err error) (services.RepositoryInterface, error) {
+	if err != nil {
+		return nil, err
 	}
 
-	return NewMapStorage(log)
+	return repository, nil
 }
@@ -1,99 +1,802 @@
 package storage
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"go.uber.org/zap"
+	"io"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/models"
 	"github.com/kirill-chelyatnikov/shortener-url-service/internal/config"
 )
 
+// типы записей в файле хранилища
+const (
+	recordAdd    = "add"    // добавление новой ссылки
+	recordOwner  = "owner"  // добавление хеша владельца к существующей ссылке
+	recordDelete = "delete" // пометка ссылки удалённой
+	recordPurge  = "purge"  // удаление ссылки с истёкшим сроком действия
+	recordClicks = "clicks" // увеличение счётчика переходов по ссылке
+
+	recordSequence = "sequence" // выданное значение последовательности ID ссылок
+	recordImport   = "import"   // импорт ссылки со всеми владельцами и признаком удаления
+
+	recordEvents      = "events"       // сырые события перехода по ссылкам
+	recordRollup      = "rollup"       // учёт событий в счётчиках статистики
+	recordEventsPurge = "events_purge" // удаление учтённых событий старше Before
+)
+
+/*
+fileRecord - строка файла хранилища. Записи без Action (формат до появления типов записей)
+считаются добавлением ссылки
+*/
+type fileRecord struct {
+	Action string `json:",omitempty"`
+	models.Link
+
+	// поля записей журнала переходов
+	Events   []*models.ClickEvent   `json:",omitempty"`
+	EventIDs []int64                `json:",omitempty"`
+	Counters []*models.StatsCounter `json:",omitempty"`
+	Before   *time.Time             `json:",omitempty"`
+
+	// поле записи последовательности ID
+	Sequence uint64 `json:",omitempty"`
+
+	// поля записи импорта, Replace - запись заменяет существующую с тем же ID
+	Owners  []string `json:",omitempty"`
+	Deleted bool     `json:",omitempty"`
+	Replace bool     `json:",omitempty"`
+}
+
 type FileStorage struct {
-	log     *zap.SugaredLogger
-	mutex   sync.RWMutex
-	file    *os.File
-	encoder *json.Encoder
-	decoder *json.Decoder
+	log      *zap.SugaredLogger
+	mutex    sync.RWMutex
+	path     string
+	file     *os.File
+	index    *linkIndex
+	clicks   *clickLog
+	sequence uint64
+	failed   error // ошибка, после которой файл не удалось вернуть в целостное состояние и записи запрещены
 }
 
 // AddURL - функция записи данных в storage (file)
 func (s *FileStorage) AddURL(ctx context.Context, link *models.Link) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	s.mutex.Lock()
-	if err := s.encoder.Encode(link); err != nil {
-		return fmt.Errorf("can't encode data to add it to file, err: %s", err)
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	if err := s.index.check(now, link); err != nil {
+		return err
+	}
+
+	stampCreated(link)
+	if err := s.write(fileRecord{Action: recordAdd, Link: *link}); err != nil {
+		return err
 	}
-	s.mutex.Unlock()
+	s.index.put(link, now)
 	s.log.Infof("success write to file storage: id - %s, value - %s", link.ID, link.BaseURL)
 
 	return nil
 }
 
+/*
+UpsertURL - функция атомарного добавления записи в storage (file): если URL уже сокращён, в ID записи пишется существующий ID,
+а хеш пользователя добавляется к владельцам. Возвращает true, если URL уже существовал
+*/
+func (s *FileStorage) UpsertURL(ctx context.Context, link *models.Link) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	s.index.resolveBatch([]*models.Link{link}, now)
+	switch link.Status {
+	case models.LinkConflict:
+		return false, &idConflictError{id: link.ID}
+	case models.LinkExisted:
+		if s.index.hasOwner(link.ID, link.Hash) {
+			return true, nil
+		}
+
+		if err := s.write(fileRecord{Action: recordOwner, Link: models.Link{ID: link.ID, Hash: link.Hash}}); err != nil {
+			return false, err
+		}
+		s.index.addOwner(link.ID, link.Hash)
+
+		return true, nil
+	}
+
+	stampCreated(link)
+	if err := s.write(fileRecord{Action: recordAdd, Link: *link}); err != nil {
+		return false, err
+	}
+	s.index.put(link, now)
+	s.log.Infof("success write to file storage: id - %s, value - %s", link.ID, link.BaseURL)
+
+	return false, nil
+}
+
+/*
+AddURLSBatch - функция добавления записей "пачкой" в storage (file).
+Результат добавления каждой записи пишется в её Status, для уже сокращённых URL в ID пишется существующий ID.
+Все изменения пачки пишутся в файл одним вызовом
+*/
+func (s *FileStorage) AddURLSBatch(ctx context.Context, links []*models.Link) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	s.index.resolveBatch(links, now)
+
+	records := make([]fileRecord, 0, len(links))
+	for _, v := range links {
+		switch v.Status {
+		case models.LinkCreated:
+			stampCreated(v)
+			records = append(records, fileRecord{Action: recordAdd, Link: *v})
+		case models.LinkExisted:
+			if !s.index.hasOwner(v.ID, v.Hash) {
+				records = append(records, fileRecord{Action: recordOwner, Link: models.Link{ID: v.ID, Hash: v.Hash}})
+			}
+		}
+	}
+
+	if err := s.write(records...); err != nil {
+		return err
+	}
+
+	for _, v := range links {
+		switch v.Status {
+		case models.LinkCreated:
+			s.index.put(v, now)
+		case models.LinkExisted:
+			s.index.addOwner(v.ID, v.Hash)
+		}
+	}
+	s.log.Infof("success write batch to file storage: %d links", len(links))
+
+	return nil
+}
+
 // GetURLByID - функция получения записи из storage (file)
 func (s *FileStorage) GetURLByID(ctx context.Context, id string) (string, error) {
+	link, err := s.GetLinkByID(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	return link.BaseURL, nil
+}
+
+// GetLinkByID - функция получения копии действующей записи со сроком действия из storage (file)
+func (s *FileStorage) GetLinkByID(ctx context.Context, id string) (*models.Link, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	f, err := os.Open(s.file.Name())
-	if err != nil {
-		s.log.Fatalf("cant't open file storage, err: %s", err)
+	return s.index.lookup(id, time.Now())
+}
+
+/*
+GetOwnedLink - функция получения записи пользователя с хешем hash, включая удалённую и истёкшую, из storage (file).
+Возвращает nil без ошибки, если записи нет или она принадлежит другим пользователям
+*/
+func (s *FileStorage) GetOwnedLink(ctx context.Context, id, hash string) (*models.Link, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	s.decoder = json.NewDecoder(f)
-	var link models.Link
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 
-	for s.decoder.More() {
-		err = s.decoder.Decode(&link)
-		if err != nil {
-			s.log.Fatalf("can't decode link, err: %s", err)
+	return s.index.owned(id, hash), nil
+}
+
+// GetAllURLSByHash - функция получения всех записей по хешу из storage (file)
+func (s *FileStorage) GetAllURLSByHash(ctx context.Context, hash string) ([]*models.Link, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	links := s.index.byHash(hash, time.Now())
+	if len(links) == 0 {
+		return nil, fmt.Errorf("%w: the user has no previously created links", ErrNotFound)
+	}
+
+	return links, nil
+}
+
+// CheckBaseURLExist - функция для проверки нахождения URL в storage (file), при нахождении присваивает ссылке ID из хранилища
+func (s *FileStorage) CheckBaseURLExist(ctx context.Context, link *models.Link) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	id, ok := s.index.idByBaseURL(link.BaseURL, time.Now())
+	if !ok {
+		return false, nil
+	}
+	link.ID = id
+
+	return true, nil
+}
+
+// UpdateHash - функция для добавления хеша пользователя в уже существующую запись
+func (s *FileStorage) UpdateHash(ctx context.Context, link *models.Link) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// как и в PostgreSQL, отсутствие записи или уже добавленный хеш ошибкой не считаются
+	id, ok := s.index.idByBaseURL(link.BaseURL, time.Now())
+	if !ok || link.Hash == "" || s.index.hasOwner(id, link.Hash) {
+		return nil
+	}
+
+	if err := s.write(fileRecord{Action: recordOwner, Link: models.Link{ID: id, Hash: link.Hash}}); err != nil {
+		return err
+	}
+	s.index.addOwner(id, link.Hash)
+
+	return nil
+}
+
+/*
+DeleteURLS - функция удаления записей пользователя в storage (file): у общей ссылки удаляется только владение пользователя,
+запись помечается удалённой, когда удаляет её последний владелец. Записи чужих пользователей пропускаются
+*/
+func (s *FileStorage) DeleteURLS(ctx context.Context, links []*models.Link) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	records := make([]fileRecord, 0, len(links))
+	for _, v := range links {
+		entry, ok := s.index.get(v.ID)
+		if !ok || entry.deleted || !s.index.hasOwner(v.ID, v.Hash) {
+			continue
 		}
-		if link.ID == id {
-			return link.BaseURL, nil
+		records = append(records, fileRecord{Action: recordDelete, Link: models.Link{ID: v.ID, Hash: v.Hash}})
+	}
+
+	if len(records) == 0 {
+		return nil
+	}
+
+	if err := s.write(records...); err != nil {
+		return err
+	}
+
+	for _, v := range records {
+		s.index.markDeleted(v.ID, v.Hash)
+	}
+	s.log.Infof("success delete from file storage: %d links", len(records))
+
+	return nil
+}
+
+// DeleteExpiredURLS - функция удаления записей, срок действия которых истёк до момента before, из storage (file)
+func (s *FileStorage) DeleteExpiredURLS(ctx context.Context, before time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ids := s.index.expired(before)
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	records := make([]fileRecord, 0, len(ids))
+	for _, id := range ids {
+		records = append(records, fileRecord{Action: recordPurge, Link: models.Link{ID: id}})
+	}
+
+	if err := s.write(records...); err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		s.index.remove(id)
+		s.clicks.removeLink(id)
+	}
+	s.compact()
+
+	return len(ids), nil
+}
+
+// AddClicks - функция увеличения счётчиков переходов по ссылкам в storage (file)
+func (s *FileStorage) AddClicks(ctx context.Context, clicks map[string]int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	records := make([]fileRecord, 0, len(clicks))
+	for id, count := range clicks {
+		if _, ok := s.index.get(id); !ok {
+			continue
+		}
+		records = append(records, fileRecord{Action: recordClicks, Link: models.Link{ID: id, Clicks: count}})
+	}
+
+	if len(records) == 0 {
+		return nil
+	}
+
+	if err := s.write(records...); err != nil {
+		return err
+	}
+
+	for _, v := range records {
+		s.index.addClicks(v.ID, v.Clicks)
+	}
+
+	return nil
+}
+
+// AddClickEvents - функция записи сырых событий перехода в storage (file), события по несуществующим ссылкам пропускаются
+func (s *FileStorage) AddClickEvents(ctx context.Context, events []*models.ClickEvent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	known := make([]*models.ClickEvent, 0, len(events))
+	for _, v := range events {
+		if _, ok := s.index.get(v.LinkID); ok {
+			known = append(known, v)
 		}
 	}
 
-	return "", fmt.Errorf("can't find URL by id: %s", id)
+	if len(known) == 0 {
+		return nil
+	}
+	s.clicks.assignIDs(known)
+
+	if err := s.write(fileRecord{Action: recordEvents, Events: known}); err != nil {
+		return err
+	}
+
+	s.clicks.add(known...)
+
+	return nil
 }
 
-// функции-заглушки для удовлетворения интерфейсу репозитория
+// GetPendingClickEvents - функция получения событий перехода, ещё не учтённых в статистике, из storage (file)
+func (s *FileStorage) GetPendingClickEvents(ctx context.Context, limit int) ([]*models.ClickEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 
-func (s *FileStorage) GetAllURLSByHash(_ context.Context, hash string) ([]*models.Link, error) {
-	return nil, nil
+	return s.clicks.getPending(limit), nil
 }
 
-func (s *FileStorage) AddURLSBatch(_ context.Context, links []*models.Link) error {
+// SaveClickStats - функция пометки событий учтёнными и увеличения счётчиков статистики в storage (file)
+func (s *FileStorage) SaveClickStats(ctx context.Context, ids []int64, counters []*models.StatsCounter) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.clicks.checkRollup(ids); err != nil {
+		return err
+	}
+
+	if err := s.write(fileRecord{Action: recordRollup, EventIDs: ids, Counters: counters}); err != nil {
+		return err
+	}
+
+	s.clicks.rollup(ids, counters)
+
 	return nil
 }
 
-func (s *FileStorage) CheckBaseURLExist(_ context.Context, link *models.Link) (bool, error) {
-	return false, nil
+// GetClickStats - функция получения счётчиков статистики ссылки из storage (file)
+func (s *FileStorage) GetClickStats(ctx context.Context, id string) ([]*models.StatsCounter, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.clicks.stats(id), nil
+}
+
+// DeleteClickEvents - функция удаления учтённых в статистике событий, произошедших до момента before, из storage (file)
+func (s *FileStorage) DeleteClickEvents(ctx context.Context, before time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// запись в файл нужна, только если есть что удалять
+	if !s.clicks.hasPurgeable(before) {
+		return 0, nil
+	}
+
+	if err := s.write(fileRecord{Action: recordEventsPurge, Before: &before}); err != nil {
+		return 0, err
+	}
+
+	count := s.clicks.purge(before)
+	s.compact()
+
+	return count, nil
+}
+
+// ListURLS - функция постраничного получения всех записей с владельцами в порядке возрастания ID, начиная после after (file)
+func (s *FileStorage) ListURLS(ctx context.Context, after string, limit int) ([]*models.LinkRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.index.list(after, limit), nil
 }
 
-func (s *FileStorage) UpdateHash(_ context.Context, link *models.Link) error {
+/*
+ImportURLS - функция добавления записей с сохранением ID, владельцев и признака удаления (file).
+Результат импорта каждой записи пишется в её Status, с DryRun хранилище не изменяется.
+Каждая импортированная запись пишется в файл одной строкой
+*/
+func (s *FileStorage) ImportURLS(ctx context.Context, records []*models.LinkRecord, opts models.ImportOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	s.index.resolveImport(records, opts.Overwrite, now)
+	if opts.DryRun {
+		return nil
+	}
+
+	for _, v := range records {
+		if v.Status == models.LinkCreated {
+			stampCreated(&v.Link)
+		}
+	}
+
+	lines := make([]fileRecord, 0, len(records))
+	for _, v := range records {
+		if v.Status != models.LinkConflict {
+			lines = append(lines, fileRecord{Action: recordImport, Link: v.Link, Owners: v.Owners, Deleted: v.Deleted,
+				Replace: v.Status == models.LinkOverwritten})
+		}
+	}
+
+	if err := s.write(lines...); err != nil {
+		return err
+	}
+
+	for _, v := range records {
+		s.index.applyImport(v, now)
+	}
+
 	return nil
 }
 
+/*
+NextID - функция получения следующего значения последовательности ID ссылок (file).
+Значение записывается в файл до выдачи, чтобы после перезапуска последовательность не начиналась заново
+*/
+func (s *FileStorage) NextID(ctx context.Context) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.write(fileRecord{Action: recordSequence, Sequence: s.sequence + 1}); err != nil {
+		return 0, err
+	}
+	s.sequence++
+
+	return s.sequence, nil
+}
+
+/*
+ReserveIDBlock - функция резервирования блока из size ID ссылок в той же последовательности, что и NextID (file).
+В файл пишется одна запись на блок, неиспользованный остаток блока после перезапуска не выдаётся повторно
+*/
+func (s *FileStorage) ReserveIDBlock(ctx context.Context, size uint64) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.write(fileRecord{Action: recordSequence, Sequence: s.sequence + size}); err != nil {
+		return 0, err
+	}
+
+	start := s.sequence + 1
+	s.sequence += size
+
+	return start, nil
+}
+
+// CurrentID - функция получения последнего выданного значения последовательности ID ссылок без его изменения (file)
+func (s *FileStorage) CurrentID(ctx context.Context) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.sequence, nil
+}
+
+// Ping - проверка доступности хранилища (file): файл существует и открывается на запись
+func (s *FileStorage) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return fmt.Errorf("file storage is not writable, err: %s", err)
+	}
+
+	return f.Close()
+}
+
+// Close - сброс записанных данных на диск и закрытие файла хранилища
 func (s *FileStorage) Close() error {
-	err := s.file.Close()
+	if err := s.file.Sync(); err != nil {
+		_ = s.file.Close()
+		return fmt.Errorf("can't sync file storage, err: %s", err)
+	}
+
+	return s.file.Close()
+}
+
+// write - запись в файл одним вызовом, чтобы пачка записей не оказалась записанной частично
+func (s *FileStorage) write(records ...fileRecord) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+
+	for _, v := range records {
+		if err := encoder.Encode(v); err != nil {
+			return fmt.Errorf("can't encode data to add it to file, err: %s", err)
+		}
+	}
+
+	if s.failed != nil {
+		return fmt.Errorf("%w: file storage is failed after unrecoverable write, err: %s", ErrUnavailable, s.failed)
+	}
+
+	/* Неудачная или неполная запись оставляет в конце файла часть строки, и следующая запись дописалась бы к ней.
+	Поэтому файл обрезается до размера перед записью, а если это невозможно, дальнейшие записи запрещаются */
+	offset, err := s.file.Seek(0, io.SeekEnd)
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: can't get file size, err: %s", ErrUnavailable, err)
+	}
+
+	if _, err = s.file.Write(buf.Bytes()); err != nil {
+		if truncErr := s.file.Truncate(offset); truncErr != nil {
+			s.failed = truncErr
+			s.log.Errorf("can't truncate incomplete record in file storage, writes are disabled, err: %s", truncErr)
+		}
+
+		return fmt.Errorf("%w: can't write data to file, err: %s", ErrUnavailable, err)
 	}
 
 	return nil
 }
 
-func NewFileStorage(log *zap.SugaredLogger, cfg *config.Config) *FileStorage {
+/*
+compact - перезапись файла текущим состоянием хранилища без удалённых ссылок и событий, иначе файл и чтение его при запуске
+растут с каждым переходом. Состояние пишется во временный файл, который затем атомарно заменяет основной.
+Ошибка перезаписи не теряет данных: основной файл остаётся прежним, поэтому она только логируется
+*/
+func (s *FileStorage) compact() {
+	if s.failed != nil {
+		return
+	}
+
+	tmp, err := os.OpenFile(s.path+".compact", os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0o777)
+	if err != nil {
+		s.log.Errorf("can't create file to compact file storage, err: %s", err)
+		return
+	}
+
+	if err = s.writeSnapshot(tmp); err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		s.log.Errorf("can't compact file storage, err: %s", err)
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return
+	}
+
+	if err = s.file.Close(); err != nil {
+		s.log.Errorf("can't close file storage replaced by compacted one, err: %s", err)
+	}
+	s.file = tmp
+}
+
+// writeSnapshot - запись текущего состояния хранилища в файл f в формате записей журнала со сбросом на диск
+func (s *FileStorage) writeSnapshot(f *os.File) error {
+	w := bufio.NewWriter(f)
+	encoder := json.NewEncoder(w)
+
+	// ссылки пишутся без владельцев, владельцы добавляются отдельно, чтобы сохранить порядок ссылок пользователей
+	for _, v := range s.index.list("", len(s.index.links)) {
+		if err := encoder.Encode(fileRecord{Action: recordImport, Link: v.Link, Deleted: v.Deleted}); err != nil {
+			return err
+		}
+	}
+
+	for _, v := range s.index.ownerships() {
+		if err := encoder.Encode(fileRecord{Action: recordOwner, Link: models.Link{ID: v[0], Hash: v[1]}}); err != nil {
+			return err
+		}
+	}
+
+	if s.sequence > 0 {
+		if err := encoder.Encode(fileRecord{Action: recordSequence, Sequence: s.sequence}); err != nil {
+			return err
+		}
+	}
+
+	events, rolledUp, counters := s.clicks.snapshot()
+	if len(events) > 0 {
+		if err := encoder.Encode(fileRecord{Action: recordEvents, Events: events}); err != nil {
+			return err
+		}
+	}
+	if len(rolledUp) > 0 || len(counters) > 0 {
+		if err := encoder.Encode(fileRecord{Action: recordRollup, EventIDs: rolledUp, Counters: counters}); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
+
+/*
+load - восстановление индексов по записям из файла. Каждая запись пишется строкой, завершённой переводом строки,
+поэтому последняя строка без него - запись, оборванная падением во время записи: она отбрасывается и файл обрезается
+*/
+func (s *FileStorage) load() error {
+	reader := bufio.NewReader(s.file)
+	now := time.Now()
+	var offset int64
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				s.log.Warnf("file storage ends with incomplete record at offset %d, truncating it", offset)
+				if err = s.file.Truncate(offset); err != nil {
+					return fmt.Errorf("can't truncate incomplete record, err: %s", err)
+				}
+			}
+
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("can't read file storage, err: %s", err)
+		}
+
+		var record fileRecord
+		if err = json.Unmarshal(line, &record); err != nil {
+			return fmt.Errorf("can't decode link at offset %d, err: %s", offset, err)
+		}
+
+		switch record.Action {
+		case recordOwner:
+			s.index.addOwner(record.ID, record.Hash)
+		case recordDelete:
+			s.index.markDeleted(record.ID, record.Hash)
+		case recordPurge:
+			s.index.remove(record.ID)
+			s.clicks.removeLink(record.ID)
+		case recordClicks:
+			s.index.addClicks(record.ID, record.Clicks)
+		case recordEvents:
+			s.clicks.add(record.Events...)
+		case recordRollup:
+			s.clicks.rollup(record.EventIDs, record.Counters)
+		case recordEventsPurge:
+			if record.Before == nil {
+				return fmt.Errorf("malformed %s record at offset %d: no time", recordEventsPurge, offset)
+			}
+			s.clicks.purge(*record.Before)
+		case recordSequence:
+			s.sequence = record.Sequence
+		case recordImport:
+			if record.Replace {
+				s.index.remove(record.ID)
+			}
+			s.index.putRecord(&models.LinkRecord{Link: record.Link, Owners: record.Owners, Deleted: record.Deleted}, now)
+		default:
+			s.index.put(&record.Link, now)
+		}
+		offset += int64(len(line))
+	}
+}
+
+func NewFileStorage(log *zap.SugaredLogger, cfg *config.Config) (*FileStorage, error) {
 	f, err := os.OpenFile(cfg.App.FileStorage, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o777)
 	if err != nil {
-		log.Fatalf("cant't create file storage, err: %s", err)
+		return nil, fmt.Errorf("cant't create file storage, err: %w", err)
+	}
+
+	s := &FileStorage{
+		log:    log,
+		path:   cfg.App.FileStorage,
+		file:   f,
+		index:  newLinkIndex(),
+		clicks: newClickLog(),
 	}
 
-	return &FileStorage{
-		log:     log,
-		file:    f,
-		encoder: json.NewEncoder(f),
+	if err = s.load(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("can't load file storage, err: %w", err)
 	}
+
+	return s, nil
 }
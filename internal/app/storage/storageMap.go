@@ -2,87 +2,417 @@ package storage
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"go.uber.org/zap"
 	"sync"
+	"time"
 
 	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/models"
 )
 
 type MapStorage struct {
-	log   *zap.SugaredLogger
-	mutex sync.RWMutex
-	data  map[string]*models.Link
+	log      *zap.SugaredLogger
+	mutex    sync.RWMutex
+	index    *linkIndex
+	clicks   *clickLog
+	sequence uint64
 }
 
 // AddURL - функция записи данных в storage (map)
 func (s *MapStorage) AddURL(ctx context.Context, link *models.Link) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-	s.data[link.ID] = &models.Link{
-		ID:      link.ID,
-		BaseURL: link.BaseURL,
-		Hash:    link.Hash,
+	now := time.Now()
+	if err := s.index.check(now, link); err != nil {
+		return err
 	}
-	s.mutex.Unlock()
+	stampCreated(link)
+	s.index.put(link, now)
 	s.log.Infof("success write to map storage: id - %s, value - %s", link.ID, link.BaseURL)
 
 	return nil
 }
 
+/*
+UpsertURL - функция атомарного добавления записи в storage (map): если URL уже сокращён, в ID записи пишется существующий ID,
+а хеш пользователя добавляется к владельцам. Возвращает true, если URL уже существовал
+*/
+func (s *MapStorage) UpsertURL(ctx context.Context, link *models.Link) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	s.index.resolveBatch([]*models.Link{link}, now)
+	switch link.Status {
+	case models.LinkConflict:
+		return false, &idConflictError{id: link.ID}
+	case models.LinkExisted:
+		s.index.addOwner(link.ID, link.Hash)
+		return true, nil
+	}
+
+	stampCreated(link)
+	s.index.put(link, now)
+	s.log.Infof("success write to map storage: id - %s, value - %s", link.ID, link.BaseURL)
+
+	return false, nil
+}
+
+/*
+AddURLSBatch - функция добавления записей "пачкой" в storage (map).
+Результат добавления каждой записи пишется в её Status, для уже сокращённых URL в ID пишется существующий ID
+*/
+func (s *MapStorage) AddURLSBatch(ctx context.Context, links []*models.Link) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	s.index.resolveBatch(links, now)
+	for _, v := range links {
+		switch v.Status {
+		case models.LinkCreated:
+			stampCreated(v)
+			s.index.put(v, now)
+		case models.LinkExisted:
+			s.index.addOwner(v.ID, v.Hash)
+		}
+	}
+	s.log.Infof("success write batch to map storage: %d links", len(links))
+
+	return nil
+}
+
 // GetURLByID - функция получения записи из storage (map)
 func (s *MapStorage) GetURLByID(ctx context.Context, id string) (string, error) {
+	link, err := s.GetLinkByID(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	return link.BaseURL, nil
+}
+
+// GetLinkByID - функция получения копии действующей записи со сроком действия из storage (map)
+func (s *MapStorage) GetLinkByID(ctx context.Context, id string) (*models.Link, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	if _, ok := s.data[id]; !ok {
-		return "", fmt.Errorf("can't find URL by id: %s", id)
+	return s.index.lookup(id, time.Now())
+}
+
+/*
+GetOwnedLink - функция получения записи пользователя с хешем hash, включая удалённую и истёкшую, из storage (map).
+Возвращает nil без ошибки, если записи нет или она принадлежит другим пользователям
+*/
+func (s *MapStorage) GetOwnedLink(ctx context.Context, id, hash string) (*models.Link, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	return s.data[id].BaseURL, nil
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.index.owned(id, hash), nil
 }
 
 // GetAllURLSByHash - функция получения всех записей по хешу из storage (map)
 func (s *MapStorage) GetAllURLSByHash(ctx context.Context, hash string) ([]*models.Link, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	var links []*models.Link
-	for _, v := range s.data {
-		if v.Hash == hash {
-			links = append(links, v)
+	links := s.index.byHash(hash, time.Now())
+	if len(links) == 0 {
+		return nil, fmt.Errorf("%w: the user has no previously created links", ErrNotFound)
+	}
+
+	return links, nil
+}
+
+// CheckBaseURLExist - функция для проверки нахождения URL в storage (map), при нахождении присваивает ссылке ID из хранилища
+func (s *MapStorage) CheckBaseURLExist(ctx context.Context, link *models.Link) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	id, ok := s.index.idByBaseURL(link.BaseURL, time.Now())
+	if !ok {
+		return false, nil
+	}
+	link.ID = id
+
+	return true, nil
+}
+
+// UpdateHash - функция для добавления хеша пользователя в уже существующую запись
+func (s *MapStorage) UpdateHash(ctx context.Context, link *models.Link) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if id, ok := s.index.idByBaseURL(link.BaseURL, time.Now()); ok {
+		s.index.addOwner(id, link.Hash)
+	}
+
+	return nil
+}
+
+/*
+DeleteURLS - функция удаления записей пользователя в storage (map): у общей ссылки удаляется только владение пользователя,
+запись помечается удалённой, когда удаляет её последний владелец. Записи чужих пользователей пропускаются
+*/
+func (s *MapStorage) DeleteURLS(ctx context.Context, links []*models.Link) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, v := range links {
+		s.index.markDeleted(v.ID, v.Hash)
+	}
+
+	return nil
+}
+
+// DeleteExpiredURLS - функция удаления записей, срок действия которых истёк до момента before, из storage (map)
+func (s *MapStorage) DeleteExpiredURLS(ctx context.Context, before time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ids := s.index.expired(before)
+	for _, id := range ids {
+		s.index.remove(id)
+		s.clicks.removeLink(id)
+	}
+
+	return len(ids), nil
+}
+
+// AddClicks - функция увеличения счётчиков переходов по ссылкам в storage (map)
+func (s *MapStorage) AddClicks(ctx context.Context, clicks map[string]int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for id, count := range clicks {
+		s.index.addClicks(id, count)
+	}
+
+	return nil
+}
+
+// AddClickEvents - функция записи сырых событий перехода в storage (map), события по несуществующим ссылкам пропускаются
+func (s *MapStorage) AddClickEvents(ctx context.Context, events []*models.ClickEvent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	known := make([]*models.ClickEvent, 0, len(events))
+	for _, v := range events {
+		if _, ok := s.index.get(v.LinkID); ok {
+			known = append(known, v)
 		}
 	}
 
-	if len(links) == 0 {
-		return nil, errors.New("the user has no previously created links")
+	if len(known) == 0 {
+		return nil
 	}
+	s.clicks.assignIDs(known)
 
-	return links, nil
+	s.clicks.add(known...)
+
+	return nil
 }
 
-// функции-заглушки для удовлетворения интерфейсу репозитория
+// GetPendingClickEvents - функция получения событий перехода, ещё не учтённых в статистике, из storage (map)
+func (s *MapStorage) GetPendingClickEvents(ctx context.Context, limit int) ([]*models.ClickEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.clicks.getPending(limit), nil
+}
+
+// SaveClickStats - функция пометки событий учтёнными и увеличения счётчиков статистики в storage (map)
+func (s *MapStorage) SaveClickStats(ctx context.Context, ids []int64, counters []*models.StatsCounter) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.clicks.checkRollup(ids); err != nil {
+		return err
+	}
+
+	s.clicks.rollup(ids, counters)
 
-func (s *MapStorage) AddURLSBatch(ctx context.Context, links []*models.Link) error {
 	return nil
 }
 
-func (s *MapStorage) CheckBaseURLExist(ctx context.Context, link *models.Link) (bool, error) {
-	return false, nil
+// GetClickStats - функция получения счётчиков статистики ссылки из storage (map)
+func (s *MapStorage) GetClickStats(ctx context.Context, id string) ([]*models.StatsCounter, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.clicks.stats(id), nil
 }
 
-func (s *MapStorage) UpdateHash(ctx context.Context, link *models.Link) error {
+// DeleteClickEvents - функция удаления учтённых в статистике событий, произошедших до момента before, из storage (map)
+func (s *MapStorage) DeleteClickEvents(ctx context.Context, before time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.clicks.purge(before), nil
+}
+
+// ListURLS - функция постраничного получения всех записей с владельцами в порядке возрастания ID, начиная после after (map)
+func (s *MapStorage) ListURLS(ctx context.Context, after string, limit int) ([]*models.LinkRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.index.list(after, limit), nil
+}
+
+/*
+ImportURLS - функция добавления записей с сохранением ID, владельцев и признака удаления (map).
+Результат импорта каждой записи пишется в её Status, с DryRun хранилище не изменяется
+*/
+func (s *MapStorage) ImportURLS(ctx context.Context, records []*models.LinkRecord, opts models.ImportOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	s.index.resolveImport(records, opts.Overwrite, now)
+	if opts.DryRun {
+		return nil
+	}
+
+	for _, v := range records {
+		if v.Status == models.LinkCreated {
+			stampCreated(&v.Link)
+		}
+	}
+
+	for _, v := range records {
+		s.index.applyImport(v, now)
+	}
+
 	return nil
 }
 
+// NextID - функция получения следующего значения последовательности ID ссылок (map)
+func (s *MapStorage) NextID(ctx context.Context) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sequence++
+
+	return s.sequence, nil
+}
+
+// ReserveIDBlock - функция резервирования блока из size ID ссылок в той же последовательности, что и NextID (map)
+func (s *MapStorage) ReserveIDBlock(ctx context.Context, size uint64) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	start := s.sequence + 1
+	s.sequence += size
+
+	return start, nil
+}
+
+// CurrentID - функция получения последнего выданного значения последовательности ID ссылок без его изменения (map)
+func (s *MapStorage) CurrentID(ctx context.Context) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.sequence, nil
+}
+
+// Ping - проверка доступности хранилища (map), хранилище в памяти всегда доступно
+func (s *MapStorage) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
 func (s *MapStorage) Close() error {
 	return nil
 }
 
 func NewMapStorage(log *zap.SugaredLogger) *MapStorage {
 	return &MapStorage{
-		log:  log,
-		data: make(map[string]*models.Link),
+		log:    log,
+		index:  newLinkIndex(),
+		clicks: newClickLog(),
 	}
 }
@@ -3,34 +3,102 @@ package storage
 import (
 	"context"
 	"embed"
+	"fmt"
 	"github.com/jackc/pgx/v5"
 	_ "github.com/jackc/pgx/v5/stdlib"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/models"
 	"github.com/kirill-chelyatnikov/shortener-url-service/internal/config"
-	"github.com/pressly/goose/v3"
 	"go.uber.org/zap"
 )
 
 //go:embed migrations/*.sql
 var embedMigrations embed.FS
 
+/*
+qUpsertLink - добавление ссылки или, если URL уже сокращён действующей ссылкой, добавление пользователя к её владельцам одним запросом.
+Пустое обновление при конфликте нужно, чтобы RETURNING вернул ID существующей ссылки, created - ссылка добавлена этим запросом.
+Занятый ID приводит к нарушению уникальности id. Истёкшие ссылки с тем же URL предварительно снимаются через qRetireExpired
+*/
+const qUpsertLink = `
+WITH link AS (
+	INSERT INTO links 
+	    (id, baseurl, expires_at, correlation_id)
+	VALUES
+		($1, $2, $4, $5)
+	ON CONFLICT (baseurl) WHERE NOT is_deleted DO UPDATE SET 
+		baseurl = EXCLUDED.baseurl
+	RETURNING id, xmax = 0 AS created
+), owner AS (
+	INSERT INTO users 
+	    (hash)
+	VALUES
+		($3)
+	ON CONFLICT (hash) DO UPDATE SET 
+		hash = EXCLUDED.hash
+	RETURNING id
+), owned AS (
+	INSERT INTO link_owners 
+	    (user_id, link_id)
+	SELECT 
+	    owner.id, link.id
+	FROM owner, link
+	ON CONFLICT (user_id, link_id) DO NOTHING
+)
+SELECT id, created FROM link
+`
+
+/*
+qRetireExpired - пометка удалёнными истёкших ссылок с переданными URL. Уникальность URL действующих ссылок
+обеспечивает частичный индекс по неудалённым ссылкам, поэтому истёкшая ссылка должна освободить его до добавления новой
+*/
+const qRetireExpired = `
+UPDATE links SET 
+	is_deleted = true
+WHERE 
+    baseurl = ANY ($1)
+AND NOT 
+    is_deleted
+AND 
+    expires_at <= now()
+`
+
 type PostgreSQLStorage struct {
 	log  *zap.SugaredLogger
 	cfg  *config.Config
 	pool *pgxpool.Pool
 }
 
-// AddURL - функция записи данных в storage (PostgreSQL)
+// AddURL - функция записи данных в storage (PostgreSQL). Ссылка, пользователь и связь владения добавляются одним запросом
 func (p *PostgreSQLStorage) AddURL(ctx context.Context, link *models.Link) error {
 	qInsertLink := `
-	INSERT INTO links as ls 
-	    (id, baseurl, hash)
-	VALUES
-		($1, $2, ARRAY[$3])
+	WITH link AS (
+		INSERT INTO links 
+		    (id, baseurl, expires_at, correlation_id)
+		VALUES
+			($1, $2, $4, $5)
+		RETURNING id
+	), owner AS (
+		INSERT INTO users 
+		    (hash)
+		SELECT v.hash FROM (VALUES ($3::varchar)) AS v (hash) WHERE v.hash <> ''
+		ON CONFLICT (hash) DO UPDATE SET 
+			hash = EXCLUDED.hash
+		RETURNING id
+	)
+	INSERT INTO link_owners 
+	    (user_id, link_id)
+	SELECT 
+	    owner.id, link.id
+	FROM owner, link
 	`
-	_, err := p.pool.Exec(ctx, qInsertLink, link.ID, link.BaseURL, link.Hash)
+	if _, err := p.pool.Exec(ctx, qRetireExpired, []string{link.BaseURL}); err != nil {
+		return NewDBError("AddURL", "can't retire expired links", err)
+	}
+
+	_, err := p.pool.Exec(ctx, qInsertLink, link.ID, link.BaseURL, link.Hash, link.ExpiresAt, link.CorrelationID)
 	if err != nil {
 		return NewDBError("AddURL", "can't do query", err)
 	}
@@ -38,12 +106,42 @@ func (p *PostgreSQLStorage) AddURL(ctx context.Context, link *models.Link) error
 	return nil
 }
 
+/*
+UpsertURL - функция атомарного добавления записи (PostgreSQL): если URL уже сокращён, в ID записи пишется существующий ID,
+а пользователь добавляется к владельцам. Возвращает true, если URL уже существовал
+*/
+func (p *PostgreSQLStorage) UpsertURL(ctx context.Context, link *models.Link) (bool, error) {
+	var created bool
+
+	if _, err := p.pool.Exec(ctx, qRetireExpired, []string{link.BaseURL}); err != nil {
+		return false, NewDBError("UpsertURL", "can't retire expired links", err)
+	}
+
+	row := p.pool.QueryRow(ctx, qUpsertLink, link.ID, link.BaseURL, link.Hash, link.ExpiresAt, link.CorrelationID)
+	if err := row.Scan(&link.ID, &created); err != nil {
+		return false, NewDBError("UpsertURL", "can't scan", err)
+	}
+
+	return !created, nil
+}
+
 // GetURLByID - функция получения записи из storage (PostgreSQL)
 func (p *PostgreSQLStorage) GetURLByID(ctx context.Context, id string) (string, error) {
-	var res string
+	link, err := p.GetLinkByID(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	return link.BaseURL, nil
+}
+
+// GetLinkByID - функция получения действующей записи со сроком действия из storage (PostgreSQL)
+func (p *PostgreSQLStorage) GetLinkByID(ctx context.Context, id string) (*models.Link, error) {
+	var link models.Link
+	var deleted, expired bool
 	q := `
 	SELECT 
-	    baseurl 
+	    id, baseurl, correlation_id, created_at, expires_at, clicks, is_deleted, coalesce(expires_at <= now(), false)
 	FROM links
 	WHERE 
 	    id = $1
@@ -51,12 +149,50 @@ func (p *PostgreSQLStorage) GetURLByID(ctx context.Context, id string) (string,
 
 	row := p.pool.QueryRow(ctx, q, id)
 
-	err := row.Scan(&res)
+	err := row.Scan(&link.ID, &link.BaseURL, &link.CorrelationID, &link.CreatedAt, &link.ExpiresAt, &link.Clicks, &deleted, &expired)
 	if err != nil {
-		return "", NewDBError("GetURLByID", "can't scan", err)
+		return nil, NewDBError("GetLinkByID", "can't scan", err)
+	}
+
+	if deleted {
+		return nil, fmt.Errorf("%w: URL with id %s was deleted", ErrGone, id)
 	}
 
-	return res, nil
+	if expired {
+		return nil, fmt.Errorf("%w: URL with id %s has expired", ErrGone, id)
+	}
+
+	return &link, nil
+}
+
+/*
+GetOwnedLink - функция получения записи пользователя с хешем hash, включая удалённую и истёкшую, из storage (PostgreSQL).
+Возвращает nil без ошибки, если записи нет или она принадлежит другим пользователям
+*/
+func (p *PostgreSQLStorage) GetOwnedLink(ctx context.Context, id, hash string) (*models.Link, error) {
+	link := models.Link{Hash: hash}
+	q := `
+	SELECT 
+	    l.id, l.baseurl, l.correlation_id, l.created_at, l.expires_at, l.clicks
+	FROM links l
+	JOIN link_owners o ON o.link_id = l.id
+	JOIN users u ON u.id = o.user_id
+	WHERE 
+	    l.id = $1
+	AND 
+	    u.hash = $2
+	`
+
+	row := p.pool.QueryRow(ctx, q, id, hash)
+
+	switch err := row.Scan(&link.ID, &link.BaseURL, &link.CorrelationID, &link.CreatedAt, &link.ExpiresAt, &link.Clicks); err {
+	case pgx.ErrNoRows:
+		return nil, nil
+	case nil:
+		return &link, nil
+	default:
+		return nil, NewDBError("GetOwnedLink", "can't scan", err)
+	}
 }
 
 // GetAllURLSByHash - функция получения всех записей по хешу из storage (PostgreSQL)
@@ -64,10 +200,17 @@ func (p *PostgreSQLStorage) GetAllURLSByHash(ctx context.Context, hash string) (
 	var links []*models.Link
 	q := `
 	SELECT 
-		id, baseurl
-	FROM links
+		l.id, l.baseurl, l.correlation_id, l.created_at, l.expires_at, l.clicks
+	FROM users u
+	JOIN link_owners o ON o.user_id = u.id
+	JOIN links l ON l.id = o.link_id
 	WHERE 
-	    hash = $1
+	    u.hash = $1
+	AND NOT 
+	    l.is_deleted
+	AND 
+	    (l.expires_at IS NULL OR l.expires_at > now())
+	ORDER BY o.created_at, l.id
 	`
 
 	rows, err := p.pool.Query(ctx, q, hash)
@@ -79,17 +222,30 @@ func (p *PostgreSQLStorage) GetAllURLSByHash(ctx context.Context, hash string) (
 
 	for rows.Next() {
 		var link models.Link
-		err = rows.Scan(&link.ID, &link.BaseURL)
+		err = rows.Scan(&link.ID, &link.BaseURL, &link.CorrelationID, &link.CreatedAt, &link.ExpiresAt, &link.Clicks)
 		if err != nil {
 			return nil, NewDBError("GetAllURLSByHash", "can't scan", err)
 		}
+		link.Hash = hash
 		links = append(links, &link)
 	}
 
+	if err = rows.Err(); err != nil {
+		return nil, NewDBError("GetAllURLSByHash", "can't read rows", err)
+	}
+
+	if len(links) == 0 {
+		return nil, fmt.Errorf("%w: the user has no previously created links", ErrNotFound)
+	}
+
 	return links, nil
 }
 
-// AddURLSBatch - функция добавления записей "пачкой"
+/*
+AddURLSBatch - функция добавления записей "пачкой" одной транзакцией через pgx.Batch.
+Уже сокращённые URL не прерывают пачку: ON CONFLICT (baseurl) добавляет хеш пользователя к владельцам и возвращает существующий ID.
+Результат добавления каждой записи пишется в её Status, записи с занятым ID (алиасом) пропускаются со статусом LinkConflict
+*/
 func (p *PostgreSQLStorage) AddURLSBatch(ctx context.Context, links []*models.Link) error {
 	// Начало транзакции
 	tx, err := p.pool.Begin(ctx)
@@ -100,20 +256,90 @@ func (p *PostgreSQLStorage) AddURLSBatch(ctx context.Context, links []*models.Li
 	// Обязательный откат транзакции при возникновении ошибок
 	defer tx.Rollback(ctx)
 
-	q := `
-	INSERT INTO links as ls 
-	    (id, baseurl, hash)
-	VALUES
-		($1, $2, ARRAY[$3])
+	ids := make([]string, 0, len(links))
+	baseURLs := make([]string, 0, len(links))
+	for _, v := range links {
+		ids = append(ids, v.ID)
+		baseURLs = append(baseURLs, v.BaseURL)
+	}
+
+	if _, err = tx.Exec(ctx, qRetireExpired, baseURLs); err != nil {
+		return NewDBError("AddURLSBatch", "can't retire expired links", err)
+	}
+
+	// уже существующие записи нужны, чтобы отличить занятый ID от уже сокращённого URL
+	qExisting := `
+	SELECT 
+	    id, baseurl, is_deleted
+	FROM links
+	WHERE 
+	    id = ANY ($1)
+	OR 
+	    baseurl = ANY ($2)
 	`
+	rows, err := tx.Query(ctx, qExisting, ids, baseURLs)
+	if err != nil {
+		return NewDBError("AddURLSBatch", "can't do query", err)
+	}
+
+	existing := make(map[string]string)
+	taken := make(map[string]struct{})
+	for rows.Next() {
+		var id, baseURL string
+		var deleted bool
+		if err = rows.Scan(&id, &baseURL, &deleted); err != nil {
+			rows.Close()
+			return NewDBError("AddURLSBatch", "can't scan", err)
+		}
+		if !deleted {
+			existing[baseURL] = id
+		}
+		taken[id] = struct{}{}
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return NewDBError("AddURLSBatch", "can't read rows", err)
+	}
+
+	resolveBatch(links, func(baseURL string) (string, bool) {
+		id, ok := existing[baseURL]
+		return id, ok
+	}, func(id string) bool {
+		_, ok := taken[id]
+		return ok
+	})
 
+	batch := &pgx.Batch{}
+	queued := make([]*models.Link, 0, len(links))
 	for _, v := range links {
-		_, err = tx.Exec(ctx, q, v.ID, v.BaseURL, v.Hash)
-		if err != nil {
-			return NewDBError("AddURLSBatch", "can't exec tx", err)
+		if v.Status == models.LinkConflict {
+			continue
+		}
+
+		batch.Queue(qUpsertLink, v.ID, v.BaseURL, v.Hash, v.ExpiresAt, v.CorrelationID)
+		queued = append(queued, v)
+	}
+
+	// статус берётся из результата вставки, так как URL мог сократить другой запрос после проверки
+	results := tx.SendBatch(ctx, batch)
+	for _, v := range queued {
+		var created bool
+		if err = results.QueryRow().Scan(&v.ID, &created); err != nil {
+			results.Close()
+			return NewDBError("AddURLSBatch", "can't exec batch", err)
+		}
+
+		v.Status = models.LinkExisted
+		if created {
+			v.Status = models.LinkCreated
 		}
 	}
 
+	if err = results.Close(); err != nil {
+		return NewDBError("AddURLSBatch", "can't close batch", err)
+	}
+
 	if err = tx.Commit(ctx); err != nil {
 		return NewDBError("AddURLSBatch", "can't commit tx", err)
 	}
@@ -121,16 +347,30 @@ func (p *PostgreSQLStorage) AddURLSBatch(ctx context.Context, links []*models.Li
 	return nil
 }
 
+// Ping - проверка доступности БД через соединение из пула (PostgreSQL)
+func (p *PostgreSQLStorage) Ping(ctx context.Context) error {
+	if err := p.pool.Ping(ctx); err != nil {
+		return NewDBError("Ping", "can't ping database", err)
+	}
+
+	return nil
+}
+
 func (p *PostgreSQLStorage) Close() error {
 	p.pool.Close()
 	return nil
 }
 
-// CheckBaseURLExist - функция для проверки нахождения URL в БД
+// CheckBaseURLExist - функция для проверки нахождения действующей ссылки на URL в БД
 func (p *PostgreSQLStorage) CheckBaseURLExist(ctx context.Context, link *models.Link) (bool, error) {
 	q := `
 	SELECT id FROM links 
-	WHERE baseurl = $1
+	WHERE 
+	    baseurl = $1
+	AND NOT 
+	    is_deleted
+	AND 
+	    (expires_at IS NULL OR expires_at > now())
 	`
 	var id string
 
@@ -149,16 +389,31 @@ func (p *PostgreSQLStorage) CheckBaseURLExist(ctx context.Context, link *models.
 	}
 }
 
-// UpdateHash - функция для добавления хеша пользователя в уже существующую запись
+// UpdateHash - функция для добавления пользователя к владельцам уже существующей записи
 func (p *PostgreSQLStorage) UpdateHash(ctx context.Context, link *models.Link) error {
 	qUpdateHash := `
-		UPDATE links ls SET 
-		hash = array_append(ls.hash, $1)
-		WHERE
-		     ls.baseurl = $2
-		AND NOT
-    	$1 = ANY (ls.hash)
-		`
+	WITH owner AS (
+		INSERT INTO users 
+		    (hash)
+		VALUES
+			($1)
+		ON CONFLICT (hash) DO UPDATE SET 
+			hash = EXCLUDED.hash
+		RETURNING id
+	)
+	INSERT INTO link_owners 
+	    (user_id, link_id)
+	SELECT 
+	    owner.id, l.id
+	FROM owner, links l
+	WHERE 
+	    l.baseurl = $2
+	AND NOT 
+	    l.is_deleted
+	AND 
+	    (l.expires_at IS NULL OR l.expires_at > now())
+	ON CONFLICT (user_id, link_id) DO NOTHING
+	`
 	_, err := p.pool.Exec(ctx, qUpdateHash, link.Hash, link.BaseURL)
 	if err != nil {
 		return NewDBError("UpdateHash", "can't do query", err)
@@ -167,41 +422,623 @@ func (p *PostgreSQLStorage) UpdateHash(ctx context.Context, link *models.Link) e
 	return nil
 }
 
-// dbConnect - фукция подключения к БД
-func dbConnect(ctx context.Context, cfg *config.Config) (*pgxpool.Pool, error) {
-	pool, err := pgxpool.New(ctx, cfg.DB.CDN)
+/*
+DeleteURLS - функция удаления записей пользователей одной транзакцией: у общей ссылки удаляется только владение пользователя,
+запись помечается удалённой, когда удаляет её последний владелец. Записи чужих пользователей пропускаются.
+Строки ссылок блокируются в начале транзакции, чтобы владельцы, удаляющие ссылку одновременно, не оставили её без владельцев
+*/
+func (p *PostgreSQLStorage) DeleteURLS(ctx context.Context, links []*models.Link) error {
+	tx, err := p.pool.Begin(ctx)
 	if err != nil {
-		return nil, NewDBError("dbConnect", "DB connect failed", err)
+		return NewDBError("DeleteURLS", "can't begin tx", err)
 	}
 
-	return pool, nil
+	defer tx.Rollback(ctx)
+
+	ids := make([]string, 0, len(links))
+	for _, v := range links {
+		ids = append(ids, v.ID)
+	}
+
+	qLock := `SELECT id FROM links WHERE id = ANY ($1) ORDER BY id FOR UPDATE`
+	if _, err = tx.Exec(ctx, qLock, ids); err != nil {
+		return NewDBError("DeleteURLS", "can't lock links", err)
+	}
+
+	qOwner := `
+	DELETE FROM link_owners o
+	USING users u, links l
+	WHERE 
+	    o.link_id = $1
+	AND 
+	    u.id = o.user_id AND u.hash = $2
+	AND 
+	    l.id = o.link_id AND NOT l.is_deleted
+	AND 
+	    (SELECT count(*) FROM link_owners WHERE link_id = o.link_id) > 1
+	`
+	qDelete := `
+	UPDATE links l SET 
+		is_deleted = true
+	WHERE 
+	    l.id = $1
+	AND NOT 
+	    l.is_deleted
+	AND 
+	    EXISTS (
+	        SELECT 1 FROM link_owners o
+	        JOIN users u ON u.id = o.user_id
+	        WHERE o.link_id = l.id AND u.hash = $2
+	    )
+	AND 
+	    (SELECT count(*) FROM link_owners WHERE link_id = l.id) = 1
+	`
+
+	batch := &pgx.Batch{}
+	for _, v := range links {
+		batch.Queue(qOwner, v.ID, v.Hash)
+		batch.Queue(qDelete, v.ID, v.Hash)
+	}
+
+	if err = tx.SendBatch(ctx, batch).Close(); err != nil {
+		return NewDBError("DeleteURLS", "can't exec batch", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return NewDBError("DeleteURLS", "can't commit tx", err)
+	}
+
+	return nil
 }
 
-func NewPostgreSQLStorage(ctx context.Context, log *zap.SugaredLogger, cfg *config.Config) *PostgreSQLStorage {
-	pool, err := dbConnect(ctx, cfg)
+// DeleteExpiredURLS - функция удаления записей, срок действия которых истёк до момента before
+func (p *PostgreSQLStorage) DeleteExpiredURLS(ctx context.Context, before time.Time) (int, error) {
+	q := `
+	DELETE FROM links 
+	WHERE 
+	    expires_at <= $1
+	`
+	tag, err := p.pool.Exec(ctx, q, before)
+	if err != nil {
+		return 0, NewDBError("DeleteExpiredURLS", "can't do query", err)
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+// AddClicks - функция увеличения счётчиков переходов по ссылкам одним запросом
+func (p *PostgreSQLStorage) AddClicks(ctx context.Context, clicks map[string]int64) error {
+	ids := make([]string, 0, len(clicks))
+	counts := make([]int64, 0, len(clicks))
+
+	for id, count := range clicks {
+		ids = append(ids, id)
+		counts = append(counts, count)
+	}
+
+	q := `
+	UPDATE links ls SET 
+		clicks = ls.clicks + c.count
+	FROM unnest($1::text[], $2::bigint[]) AS c (id, count)
+	WHERE 
+	    ls.id = c.id
+	`
+	_, err := p.pool.Exec(ctx, q, ids, counts)
 	if err != nil {
-		log.Fatalf("can't create PostgreSQLStorage, err: %s", err)
+		return NewDBError("AddClicks", "can't do query", err)
 	}
 
-	goose.SetBaseFS(embedMigrations)
+	return nil
+}
+
+// AddClickEvents - функция записи сырых событий перехода одним запросом, события по несуществующим ссылкам пропускаются
+func (p *PostgreSQLStorage) AddClickEvents(ctx context.Context, events []*models.ClickEvent) error {
+	linkIDs := make([]string, 0, len(events))
+	times := make([]time.Time, 0, len(events))
+	referrers := make([]string, 0, len(events))
+	userAgents := make([]string, 0, len(events))
 
-	db, err := goose.OpenDBWithDriver("pgx", cfg.DB.CDN)
+	for _, v := range events {
+		linkIDs = append(linkIDs, v.LinkID)
+		times = append(times, v.Time)
+		referrers = append(referrers, v.Referrer)
+		userAgents = append(userAgents, v.UserAgent)
+	}
+
+	q := `
+	INSERT INTO click_events 
+	    (link_id, created_at, referrer, user_agent)
+	SELECT 
+	    e.link_id, e.created_at, e.referrer, e.user_agent
+	FROM unnest($1::text[], $2::timestamptz[], $3::text[], $4::text[]) AS e (link_id, created_at, referrer, user_agent)
+	WHERE 
+	    EXISTS (SELECT 1 FROM links WHERE id = e.link_id)
+	`
+	_, err := p.pool.Exec(ctx, q, linkIDs, times, referrers, userAgents)
 	if err != nil {
-		log.Fatalf(err.Error())
+		return NewDBError("AddClickEvents", "can't do query", err)
 	}
-	defer db.Close()
 
-	if err = goose.SetDialect("postgres"); err != nil {
-		log.Fatalf(err.Error())
+	return nil
+}
+
+// GetPendingClickEvents - функция получения событий перехода, ещё не учтённых в статистике
+func (p *PostgreSQLStorage) GetPendingClickEvents(ctx context.Context, limit int) ([]*models.ClickEvent, error) {
+	q := `
+	SELECT 
+	    id, link_id, created_at, referrer, user_agent
+	FROM click_events
+	WHERE 
+	    NOT rolled_up
+	ORDER BY id
+	LIMIT $1
+	`
+
+	rows, err := p.pool.Query(ctx, q, limit)
+	if err != nil {
+		return nil, NewDBError("GetPendingClickEvents", "can't do query", err)
 	}
 
-	if err = goose.Up(db, "migrations"); err != nil {
-		log.Fatalf(err.Error())
+	defer rows.Close()
+
+	events := make([]*models.ClickEvent, 0, limit)
+	for rows.Next() {
+		var event models.ClickEvent
+		err = rows.Scan(&event.ID, &event.LinkID, &event.Time, &event.Referrer, &event.UserAgent)
+		if err != nil {
+			return nil, NewDBError("GetPendingClickEvents", "can't scan", err)
+		}
+		events = append(events, &event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, NewDBError("GetPendingClickEvents", "can't read rows", err)
+	}
+
+	return events, nil
+}
+
+/*
+SaveClickStats - функция пометки событий учтёнными и увеличения счётчиков статистики в одной транзакции.
+Если часть событий уже учтена другим экземпляром сервиса, транзакция откатывается, чтобы переходы не посчитались дважды
+*/
+func (p *PostgreSQLStorage) SaveClickStats(ctx context.Context, ids []int64, counters []*models.StatsCounter) error {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return NewDBError("SaveClickStats", "can't begin tx", err)
+	}
+
+	defer tx.Rollback(ctx)
+
+	qRollup := `
+	UPDATE click_events SET 
+		rolled_up = true
+	WHERE 
+	    id = ANY ($1)
+	AND NOT 
+	    rolled_up
+	`
+	tag, err := tx.Exec(ctx, qRollup, ids)
+	if err != nil {
+		return NewDBError("SaveClickStats", "can't exec tx", err)
+	}
+
+	if tag.RowsAffected() != int64(len(ids)) {
+		return fmt.Errorf("%w: click events are already rolled up", ErrConflict)
+	}
+
+	linkIDs := make([]string, 0, len(counters))
+	buckets := make([]time.Time, 0, len(counters))
+	dimensions := make([]string, 0, len(counters))
+	values := make([]string, 0, len(counters))
+	counts := make([]int64, 0, len(counters))
+
+	for _, v := range counters {
+		linkIDs = append(linkIDs, v.LinkID)
+		buckets = append(buckets, v.Bucket)
+		dimensions = append(dimensions, v.Dimension)
+		values = append(values, v.Value)
+		counts = append(counts, v.Count)
+	}
+
+	qCounters := `
+	INSERT INTO link_stats AS ls 
+	    (link_id, bucket, dimension, value, count)
+	SELECT 
+	    c.link_id, c.bucket, c.dimension, c.value, c.count
+	FROM unnest($1::text[], $2::timestamptz[], $3::text[], $4::text[], $5::bigint[]) AS c (link_id, bucket, dimension, value, count)
+	WHERE 
+	    EXISTS (SELECT 1 FROM links WHERE id = c.link_id)
+	ON CONFLICT (link_id, bucket, dimension, value) DO UPDATE SET 
+		count = ls.count + EXCLUDED.count
+	`
+	_, err = tx.Exec(ctx, qCounters, linkIDs, buckets, dimensions, values, counts)
+	if err != nil {
+		return NewDBError("SaveClickStats", "can't exec tx", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return NewDBError("SaveClickStats", "can't commit tx", err)
+	}
+
+	return nil
+}
+
+// GetClickStats - функция получения счётчиков статистики ссылки
+func (p *PostgreSQLStorage) GetClickStats(ctx context.Context, id string) ([]*models.StatsCounter, error) {
+	q := `
+	SELECT 
+	    link_id, bucket, dimension, value, count
+	FROM link_stats
+	WHERE 
+	    link_id = $1
+	`
+
+	rows, err := p.pool.Query(ctx, q, id)
+	if err != nil {
+		return nil, NewDBError("GetClickStats", "can't do query", err)
+	}
+
+	defer rows.Close()
+
+	var counters []*models.StatsCounter
+	for rows.Next() {
+		var counter models.StatsCounter
+		err = rows.Scan(&counter.LinkID, &counter.Bucket, &counter.Dimension, &counter.Value, &counter.Count)
+		if err != nil {
+			return nil, NewDBError("GetClickStats", "can't scan", err)
+		}
+		counters = append(counters, &counter)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, NewDBError("GetClickStats", "can't read rows", err)
+	}
+
+	return counters, nil
+}
+
+// DeleteClickEvents - функция удаления учтённых в статистике событий, произошедших до момента before
+func (p *PostgreSQLStorage) DeleteClickEvents(ctx context.Context, before time.Time) (int, error) {
+	q := `
+	DELETE FROM click_events 
+	WHERE 
+	    rolled_up
+	AND 
+	    created_at < $1
+	`
+	tag, err := p.pool.Exec(ctx, q, before)
+	if err != nil {
+		return 0, NewDBError("DeleteClickEvents", "can't do query", err)
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+/*
+NextID - функция получения следующего ID ссылок из того же счётчика id_blocks, что и ReserveIDBlock,
+поэтому стратегии генерации ID можно менять без коллизий
+*/
+func (p *PostgreSQLStorage) NextID(ctx context.Context) (uint64, error) {
+	var id int64
+	q := `
+	UPDATE id_blocks SET 
+		next_id = next_id + 1, updated_at = now()
+	WHERE 
+	    name = 'links'
+	RETURNING next_id - 1
+	`
+
+	if err := p.pool.QueryRow(ctx, q).Scan(&id); err != nil {
+		return 0, NewDBError("NextID", "can't scan", err)
+	}
+
+	return uint64(id), nil
+}
+
+/*
+ReserveIDBlock - функция резервирования блока из size ID ссылок, возвращает первый ID блока.
+Строка счётчика блокируется на время UPDATE, поэтому экземпляры сервиса получают непересекающиеся блоки
+*/
+func (p *PostgreSQLStorage) ReserveIDBlock(ctx context.Context, size uint64) (uint64, error) {
+	var start int64
+	q := `
+	UPDATE id_blocks SET 
+		next_id = next_id + $1, updated_at = now()
+	WHERE 
+	    name = 'links'
+	RETURNING next_id - $1
+	`
+
+	if err := p.pool.QueryRow(ctx, q, int64(size)).Scan(&start); err != nil {
+		return 0, NewDBError("ReserveIDBlock", "can't scan", err)
+	}
+
+	return uint64(start), nil
+}
+
+// CurrentID - функция получения последнего выданного значения счётчика id_blocks без его изменения
+func (p *PostgreSQLStorage) CurrentID(ctx context.Context) (uint64, error) {
+	var id int64
+	q := `SELECT next_id - 1 FROM id_blocks WHERE name = 'links'`
+
+	if err := p.pool.QueryRow(ctx, q).Scan(&id); err != nil {
+		return 0, NewDBError("CurrentID", "can't scan", err)
+	}
+
+	return uint64(id), nil
+}
+
+// ListURLS - функция постраничного получения всех записей с владельцами в порядке возрастания ID, начиная после after (PostgreSQL)
+func (p *PostgreSQLStorage) ListURLS(ctx context.Context, after string, limit int) ([]*models.LinkRecord, error) {
+	q := `
+	SELECT 
+	    l.id, l.baseurl, l.correlation_id, l.created_at, l.expires_at, l.clicks, l.is_deleted,
+	    coalesce(array_agg(u.hash ORDER BY u.hash) FILTER (WHERE u.hash IS NOT NULL), '{}')
+	FROM links l
+	LEFT JOIN link_owners o ON o.link_id = l.id
+	LEFT JOIN users u ON u.id = o.user_id
+	WHERE 
+	    l.id COLLATE "C" > $1
+	GROUP BY l.id
+	ORDER BY l.id COLLATE "C"
+	LIMIT $2
+	`
+
+	rows, err := p.pool.Query(ctx, q, after, limit)
+	if err != nil {
+		return nil, NewDBError("ListURLS", "can't do query", err)
+	}
+
+	defer rows.Close()
+
+	records := make([]*models.LinkRecord, 0, limit)
+	for rows.Next() {
+		var record models.LinkRecord
+		err = rows.Scan(&record.ID, &record.BaseURL, &record.CorrelationID, &record.CreatedAt, &record.ExpiresAt,
+			&record.Clicks, &record.Deleted, &record.Owners)
+		if err != nil {
+			return nil, NewDBError("ListURLS", "can't scan", err)
+		}
+		records = append(records, &record)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, NewDBError("ListURLS", "can't read rows", err)
+	}
+
+	return records, nil
+}
+
+// importRows - столбцы записей ссылок для вставки и обновления через unnest
+type importRows struct {
+	ids, baseURLs, correlationIDs []string
+	createdAt                     []*time.Time
+	expiresAt                     []*time.Time
+	clicks                        []int64
+	deleted                       []bool
+}
+
+// add - добавление записи, нулевой момент создания заменяется на now() в запросе, retired - запись сохраняется удалённой
+func (r *importRows) add(record *models.LinkRecord, retired bool) {
+	var createdAt *time.Time
+	if !record.CreatedAt.IsZero() {
+		createdAt = &record.CreatedAt
+	}
+
+	r.ids = append(r.ids, record.ID)
+	r.baseURLs = append(r.baseURLs, record.BaseURL)
+	r.correlationIDs = append(r.correlationIDs, record.CorrelationID)
+	r.createdAt = append(r.createdAt, createdAt)
+	r.expiresAt = append(r.expiresAt, record.ExpiresAt)
+	r.clicks = append(r.clicks, record.Clicks)
+	r.deleted = append(r.deleted, record.Deleted || retired)
+}
+
+// args - аргументы запроса в порядке столбцов
+func (r *importRows) args() []any {
+	return []any{r.ids, r.baseURLs, r.correlationIDs, r.createdAt, r.expiresAt, r.clicks, r.deleted}
+}
+
+/*
+ImportURLS - функция добавления записей с сохранением ID, владельцев и признака удаления одной транзакцией (PostgreSQL).
+Результат импорта каждой записи пишется в её Status, с DryRun хранилище не изменяется.
+Если ID встречается в пачке несколько раз, перезаписанная запись получает поля и владельцев последней перезаписи
+*/
+func (p *PostgreSQLStorage) ImportURLS(ctx context.Context, records []*models.LinkRecord, opts models.ImportOptions) error {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return NewDBError("ImportURLS", "can't begin tx", err)
+	}
+
+	defer tx.Rollback(ctx)
+
+	ids := make([]string, 0, len(records))
+	baseURLs := make([]string, 0, len(records))
+	for _, v := range records {
+		ids = append(ids, v.ID)
+		baseURLs = append(baseURLs, v.BaseURL)
+	}
+
+	if _, err = tx.Exec(ctx, qRetireExpired, baseURLs); err != nil {
+		return NewDBError("ImportURLS", "can't retire expired links", err)
+	}
+
+	qExisting := `
+	SELECT 
+	    id, baseurl, is_deleted
+	FROM links
+	WHERE 
+	    id = ANY ($1)
+	OR 
+	    baseurl = ANY ($2)
+	FOR UPDATE
+	`
+	rows, err := tx.Query(ctx, qExisting, ids, baseURLs)
+	if err != nil {
+		return NewDBError("ImportURLS", "can't do query", err)
+	}
+
+	byID := make(map[string]string)
+	byBaseURL := make(map[string]string)
+	for rows.Next() {
+		var id, baseURL string
+		var deleted bool
+		if err = rows.Scan(&id, &baseURL, &deleted); err != nil {
+			rows.Close()
+			return NewDBError("ImportURLS", "can't scan", err)
+		}
+		byID[id] = baseURL
+		if !deleted {
+			byBaseURL[baseURL] = id
+		}
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return NewDBError("ImportURLS", "can't read rows", err)
+	}
+
+	now := time.Now()
+	existingID := func(baseURL string) (string, bool) {
+		id, ok := byBaseURL[baseURL]
+		return id, ok
+	}
+	resolveImport(records, opts.Overwrite, now, func(id string) (string, bool) {
+		baseURL, ok := byID[id]
+		return baseURL, ok
+	}, existingID)
+
+	if opts.DryRun {
+		return nil
+	}
+
+	retired := retiredImports(records, now, existingID)
+
+	/* Записи обходятся с конца, чтобы для каждого ID взять только последнюю перезапись
+	и не добавлять владельцев записей, которые она заменяет */
+	var created, overwritten importRows
+	var ownerLinks, ownerHashes []string
+	replaced := make(map[string]struct{})
+	for n := len(records) - 1; n >= 0; n-- {
+		v := records[n]
+		if v.Status == models.LinkConflict {
+			continue
+		}
+		if _, ok := replaced[v.ID]; ok {
+			continue
+		}
+
+		switch v.Status {
+		case models.LinkCreated:
+			created.add(v, retired[v])
+		case models.LinkOverwritten:
+			// ID, добавленный ранее в этой же пачке, ещё не существует в БД
+			if _, ok := byID[v.ID]; ok {
+				overwritten.add(v, retired[v])
+			} else {
+				created.add(v, retired[v])
+			}
+			replaced[v.ID] = struct{}{}
+		}
+
+		for _, hash := range v.Owners {
+			if hash == "" {
+				continue
+			}
+			ownerLinks = append(ownerLinks, v.ID)
+			ownerHashes = append(ownerHashes, hash)
+		}
+	}
+
+	qInsertLinks := `
+	INSERT INTO links 
+	    (id, baseurl, correlation_id, created_at, expires_at, clicks, is_deleted)
+	SELECT 
+	    id, baseurl, correlation_id, coalesce(created_at, now()), expires_at, clicks, is_deleted
+	FROM unnest($1::varchar[], $2::varchar[], $3::text[], $4::timestamptz[], $5::timestamptz[], $6::bigint[], $7::boolean[])
+		AS v (id, baseurl, correlation_id, created_at, expires_at, clicks, is_deleted)
+	`
+	if _, err = tx.Exec(ctx, qInsertLinks, created.args()...); err != nil {
+		return NewDBError("ImportURLS", "can't insert links", err)
+	}
+
+	if len(overwritten.ids) > 0 {
+		qUpdateLinks := `
+		UPDATE links l SET 
+			baseurl = v.baseurl, correlation_id = v.correlation_id, created_at = coalesce(v.created_at, l.created_at),
+			expires_at = v.expires_at, clicks = v.clicks, is_deleted = v.is_deleted
+		FROM unnest($1::varchar[], $2::varchar[], $3::text[], $4::timestamptz[], $5::timestamptz[], $6::bigint[], $7::boolean[])
+			AS v (id, baseurl, correlation_id, created_at, expires_at, clicks, is_deleted)
+		WHERE 
+		    l.id = v.id
+		`
+		if _, err = tx.Exec(ctx, qUpdateLinks, overwritten.args()...); err != nil {
+			return NewDBError("ImportURLS", "can't update links", err)
+		}
+
+		if _, err = tx.Exec(ctx, `DELETE FROM link_owners WHERE link_id = ANY ($1)`, overwritten.ids); err != nil {
+			return NewDBError("ImportURLS", "can't delete owners", err)
+		}
+	}
+
+	qInsertOwners := `
+	WITH pairs AS (
+		SELECT * FROM unnest($1::varchar[], $2::varchar[]) AS p (link_id, hash)
+	), owner AS (
+		INSERT INTO users 
+		    (hash)
+		SELECT DISTINCT hash FROM pairs
+		ON CONFLICT (hash) DO UPDATE SET 
+			hash = EXCLUDED.hash
+		RETURNING id, hash
+	)
+	INSERT INTO link_owners 
+	    (user_id, link_id)
+	SELECT 
+	    owner.id, pairs.link_id
+	FROM pairs
+	JOIN owner ON owner.hash = pairs.hash
+	ON CONFLICT (user_id, link_id) DO NOTHING
+	`
+	if _, err = tx.Exec(ctx, qInsertOwners, ownerLinks, ownerHashes); err != nil {
+		return NewDBError("ImportURLS", "can't insert owners", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return NewDBError("ImportURLS", "can't commit tx", err)
+	}
+
+	return nil
+}
+
+// dbConnect - фукция подключения к БД
+func dbConnect(ctx context.Context, cfg *config.Config) (*pgxpool.Pool, error) {
+	pool, err := pgxpool.New(ctx, cfg.DB.CDN)
+	if err != nil {
+		return nil, NewDBError("dbConnect", "DB connect failed", err)
+	}
+
+	return pool, nil
+}
+
+func NewPostgreSQLStorage(ctx context.Context, log *zap.SugaredLogger, cfg *config.Config) (*PostgreSQLStorage, error) {
+	pool, err := dbConnect(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("can't create PostgreSQLStorage, err: %w", err)
+	}
+
+	// при выключенной автомиграции схему обновляют отдельной командой shortener migrate up
+	if cfg.DB.AutoMigrate {
+		if err = Migrate(ctx, log, cfg.DB.CDN, "up"); err != nil {
+			pool.Close()
+			return nil, fmt.Errorf("can't migrate DB, err: %w", err)
+		}
 	}
 
 	return &PostgreSQLStorage{
 		log:  log,
 		cfg:  cfg,
 		pool: pool,
-	}
+	}, nil
 }
@@ -0,0 +1,963 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/models"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/config"
+	"go.uber.org/zap"
+)
+
+//go:embed migrations/sqlite/*.sql
+var embedSQLiteMigrations embed.FS
+
+const (
+	// sqliteScheme - схема DSN, по которой выбирается SQLiteStorage: sqlite:///абсолютный/путь.db или sqlite://относительный.db
+	sqliteScheme = "sqlite://"
+	// sqliteDriver - имя драйвера database/sql
+	sqliteDriver = "sqlite"
+)
+
+/*
+SQLiteStorage - хранилище в файле SQLite с той же моделью данных, что и PostgreSQL.
+SQLite допускает только одного пишущего, поэтому все запросы идут через единственное соединение:
+транзакции выполняются последовательно, и проверка с последующей записью внутри транзакции атомарна
+*/
+type SQLiteStorage struct {
+	log *zap.SugaredLogger
+	cfg *config.Config
+	db  *sql.DB
+}
+
+// isSQLiteDSN - проверка, что DSN указывает на файл SQLite
+func isSQLiteDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, sqliteScheme)
+}
+
+// openSQLite - открытие БД SQLite по DSN sqlite://
+func openSQLite(dsn string) (*sql.DB, error) {
+	path := strings.TrimPrefix(dsn, sqliteScheme)
+	if path == "" {
+		return nil, fmt.Errorf("empty file path in DSN %s", dsn)
+	}
+
+	return sql.Open(sqliteDriver, path)
+}
+
+// unixNano - момент времени в наносекундах Unix для хранения в SQLite
+func unixNano(t time.Time) int64 {
+	return t.UnixNano()
+}
+
+// nullUnixNano - необязательный момент времени в наносекундах Unix
+func nullUnixNano(t *time.Time) sql.NullInt64 {
+	if t == nil {
+		return sql.NullInt64{}
+	}
+
+	return sql.NullInt64{Int64: t.UnixNano(), Valid: true}
+}
+
+// fromUnixNano - момент времени из наносекунд Unix
+func fromUnixNano(v int64) time.Time {
+	return time.Unix(0, v).UTC()
+}
+
+// fromNullUnixNano - необязательный момент времени из наносекунд Unix
+func fromNullUnixNano(v sql.NullInt64) *time.Time {
+	if !v.Valid {
+		return nil
+	}
+
+	res := fromUnixNano(v.Int64)
+	return &res
+}
+
+// placeholders - список из n параметров запроса для IN (...)
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// inTx - выполнение fn в транзакции, транзакция фиксируется, если fn не вернула ошибку
+func (s *SQLiteStorage) inTx(ctx context.Context, function string, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return NewDBError(function, "can't begin tx", err)
+	}
+
+	defer tx.Rollback()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return NewDBError(function, "can't commit tx", err)
+	}
+
+	return nil
+}
+
+/*
+retireExpired - пометка удалёнными истёкших ссылок с переданными URL. Уникальность URL действующих ссылок
+обеспечивает частичный индекс по неудалённым ссылкам, поэтому истёкшая ссылка должна освободить его до добавления новой
+*/
+func (s *SQLiteStorage) retireExpired(ctx context.Context, tx *sql.Tx, baseURLs []string, now time.Time) error {
+	if len(baseURLs) == 0 {
+		return nil
+	}
+
+	q := fmt.Sprintf(`
+	UPDATE links SET
+		is_deleted = 1
+	WHERE
+	    baseurl IN (%s)
+	AND NOT
+	    is_deleted
+	AND
+	    expires_at <= ?
+	`, placeholders(len(baseURLs)))
+
+	args := make([]any, 0, len(baseURLs)+1)
+	for _, v := range baseURLs {
+		args = append(args, v)
+	}
+	args = append(args, unixNano(now))
+
+	_, err := tx.ExecContext(ctx, q, args...)
+
+	return err
+}
+
+/*
+existingLinks - получение URL существующих ссылок с переданными ID и ID действующих ссылок с переданными URL.
+Истёкшие ссылки с переданными URL предварительно помечаются удалёнными
+*/
+func (s *SQLiteStorage) existingLinks(ctx context.Context, tx *sql.Tx, ids, baseURLs []string, now time.Time) (byID, byBaseURL map[string]string, err error) {
+	byID = make(map[string]string)
+	byBaseURL = make(map[string]string)
+	if len(ids) == 0 {
+		return byID, byBaseURL, nil
+	}
+
+	if err = s.retireExpired(ctx, tx, baseURLs, now); err != nil {
+		return nil, nil, err
+	}
+
+	q := fmt.Sprintf(`
+	SELECT
+	    id, baseurl, is_deleted
+	FROM links
+	WHERE
+	    id IN (%s)
+	OR
+	    baseurl IN (%s)
+	`, placeholders(len(ids)), placeholders(len(baseURLs)))
+
+	args := make([]any, 0, len(ids)+len(baseURLs))
+	for _, v := range ids {
+		args = append(args, v)
+	}
+	for _, v := range baseURLs {
+		args = append(args, v)
+	}
+
+	rows, err := tx.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, baseURL string
+		var deleted bool
+		if err = rows.Scan(&id, &baseURL, &deleted); err != nil {
+			return nil, nil, err
+		}
+		byID[id] = baseURL
+		if !deleted {
+			byBaseURL[baseURL] = id
+		}
+	}
+
+	return byID, byBaseURL, rows.Err()
+}
+
+// insertLink - добавление ссылки, нулевой момент создания заменяется текущим
+func (s *SQLiteStorage) insertLink(ctx context.Context, tx *sql.Tx, link *models.Link, deleted bool) error {
+	stampCreated(link)
+
+	q := `
+	INSERT INTO links
+	    (id, baseurl, correlation_id, created_at, expires_at, clicks, is_deleted)
+	VALUES
+		(?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := tx.ExecContext(ctx, q, link.ID, link.BaseURL, link.CorrelationID, unixNano(link.CreatedAt),
+		nullUnixNano(link.ExpiresAt), link.Clicks, deleted)
+
+	return err
+}
+
+// addOwner - добавление хеша пользователя к владельцам ссылки, пустой хеш пропускается
+func (s *SQLiteStorage) addOwner(ctx context.Context, tx *sql.Tx, id, hash string) error {
+	if hash == "" {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO users (hash) VALUES (?) ON CONFLICT (hash) DO NOTHING`, hash); err != nil {
+		return err
+	}
+
+	q := `
+	INSERT INTO link_owners
+	    (user_id, link_id)
+	SELECT
+	    u.id, l.id
+	FROM users u, links l
+	WHERE
+	    u.hash = ?
+	AND
+	    l.id = ?
+	ON CONFLICT (user_id, link_id) DO NOTHING
+	`
+	_, err := tx.ExecContext(ctx, q, hash, id)
+
+	return err
+}
+
+// applyBatch - определение результата добавления каждой ссылки и запись добавленных ссылок и владельцев
+func (s *SQLiteStorage) applyBatch(ctx context.Context, tx *sql.Tx, links []*models.Link) error {
+	ids := make([]string, 0, len(links))
+	baseURLs := make([]string, 0, len(links))
+	for _, v := range links {
+		ids = append(ids, v.ID)
+		baseURLs = append(baseURLs, v.BaseURL)
+	}
+
+	byID, byBaseURL, err := s.existingLinks(ctx, tx, ids, baseURLs, time.Now())
+	if err != nil {
+		return err
+	}
+
+	resolveBatch(links, func(baseURL string) (string, bool) {
+		id, ok := byBaseURL[baseURL]
+		return id, ok
+	}, func(id string) bool {
+		_, ok := byID[id]
+		return ok
+	})
+
+	for _, v := range links {
+		switch v.Status {
+		case models.LinkCreated:
+			if err = s.insertLink(ctx, tx, v, false); err != nil {
+				return err
+			}
+		case models.LinkConflict:
+			continue
+		}
+
+		if err = s.addOwner(ctx, tx, v.ID, v.Hash); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddURL - функция записи данных в storage (SQLite)
+func (s *SQLiteStorage) AddURL(ctx context.Context, link *models.Link) error {
+	return s.inTx(ctx, "AddURL", func(tx *sql.Tx) error {
+		if err := s.retireExpired(ctx, tx, []string{link.BaseURL}, time.Now()); err != nil {
+			return NewDBError("AddURL", "can't retire expired links", err)
+		}
+
+		if err := s.insertLink(ctx, tx, link, false); err != nil {
+			return NewDBError("AddURL", "can't insert link", err)
+		}
+
+		if err := s.addOwner(ctx, tx, link.ID, link.Hash); err != nil {
+			return NewDBError("AddURL", "can't insert owner", err)
+		}
+
+		return nil
+	})
+}
+
+/*
+UpsertURL - функция атомарного добавления записи (SQLite): если URL уже сокращён, в ID записи пишется существующий ID,
+а пользователь добавляется к владельцам. Возвращает true, если URL уже существовал
+*/
+func (s *SQLiteStorage) UpsertURL(ctx context.Context, link *models.Link) (bool, error) {
+	err := s.inTx(ctx, "UpsertURL", func(tx *sql.Tx) error {
+		if err := s.applyBatch(ctx, tx, []*models.Link{link}); err != nil {
+			return NewDBError("UpsertURL", "can't do query", err)
+		}
+
+		if link.Status == models.LinkConflict {
+			return &idConflictError{id: link.ID}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return link.Status == models.LinkExisted, nil
+}
+
+/*
+AddURLSBatch - функция добавления записей "пачкой" одной транзакцией (SQLite).
+Результат добавления каждой записи пишется в её Status, для уже сокращённых URL в ID пишется существующий ID
+*/
+func (s *SQLiteStorage) AddURLSBatch(ctx context.Context, links []*models.Link) error {
+	return s.inTx(ctx, "AddURLSBatch", func(tx *sql.Tx) error {
+		if err := s.applyBatch(ctx, tx, links); err != nil {
+			return NewDBError("AddURLSBatch", "can't exec batch", err)
+		}
+
+		return nil
+	})
+}
+
+// GetURLByID - функция получения записи из storage (SQLite)
+func (s *SQLiteStorage) GetURLByID(ctx context.Context, id string) (string, error) {
+	link, err := s.GetLinkByID(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	return link.BaseURL, nil
+}
+
+// GetLinkByID - функция получения действующей записи со сроком действия из storage (SQLite)
+func (s *SQLiteStorage) GetLinkByID(ctx context.Context, id string) (*models.Link, error) {
+	var link models.Link
+	var deleted bool
+	var createdAt int64
+	var expiresAt sql.NullInt64
+	q := `
+	SELECT
+	    id, baseurl, correlation_id, created_at, expires_at, clicks, is_deleted
+	FROM links
+	WHERE
+	    id = ?
+	`
+
+	err := s.db.QueryRowContext(ctx, q, id).Scan(&link.ID, &link.BaseURL, &link.CorrelationID, &createdAt, &expiresAt, &link.Clicks, &deleted)
+	if err != nil {
+		return nil, NewDBError("GetLinkByID", "can't scan", err)
+	}
+
+	if deleted {
+		return nil, fmt.Errorf("%w: URL with id %s was deleted", ErrGone, id)
+	}
+
+	link.CreatedAt = fromUnixNano(createdAt)
+	link.ExpiresAt = fromNullUnixNano(expiresAt)
+	if link.Expired(time.Now()) {
+		return nil, fmt.Errorf("%w: URL with id %s has expired", ErrGone, id)
+	}
+
+	return &link, nil
+}
+
+/*
+GetOwnedLink - функция получения записи пользователя с хешем hash, включая удалённую и истёкшую, из storage (SQLite).
+Возвращает nil без ошибки, если записи нет или она принадлежит другим пользователям
+*/
+func (s *SQLiteStorage) GetOwnedLink(ctx context.Context, id, hash string) (*models.Link, error) {
+	link := models.Link{Hash: hash}
+	var createdAt int64
+	var expiresAt sql.NullInt64
+	q := `
+	SELECT
+	    l.id, l.baseurl, l.correlation_id, l.created_at, l.expires_at, l.clicks
+	FROM links l
+	JOIN link_owners o ON o.link_id = l.id
+	JOIN users u ON u.id = o.user_id
+	WHERE
+	    l.id = ?
+	AND
+	    u.hash = ?
+	`
+
+	err := s.db.QueryRowContext(ctx, q, id, hash).Scan(&link.ID, &link.BaseURL, &link.CorrelationID, &createdAt, &expiresAt, &link.Clicks)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, nil
+	case err != nil:
+		return nil, NewDBError("GetOwnedLink", "can't scan", err)
+	}
+
+	link.CreatedAt = fromUnixNano(createdAt)
+	link.ExpiresAt = fromNullUnixNano(expiresAt)
+
+	return &link, nil
+}
+
+// GetAllURLSByHash - функция получения всех записей по хешу из storage (SQLite) в порядке добавления владельца
+func (s *SQLiteStorage) GetAllURLSByHash(ctx context.Context, hash string) ([]*models.Link, error) {
+	var links []*models.Link
+	q := `
+	SELECT
+		l.id, l.baseurl, l.correlation_id, l.created_at, l.expires_at, l.clicks
+	FROM users u
+	JOIN link_owners o ON o.user_id = u.id
+	JOIN links l ON l.id = o.link_id
+	WHERE
+	    u.hash = ?
+	AND NOT
+	    l.is_deleted
+	AND
+	    (l.expires_at IS NULL OR l.expires_at > ?)
+	ORDER BY o.rowid
+	`
+
+	rows, err := s.db.QueryContext(ctx, q, hash, unixNano(time.Now()))
+	if err != nil {
+		return nil, NewDBError("GetAllURLSByHash", "can't do query", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var link models.Link
+		var createdAt int64
+		var expiresAt sql.NullInt64
+		err = rows.Scan(&link.ID, &link.BaseURL, &link.CorrelationID, &createdAt, &expiresAt, &link.Clicks)
+		if err != nil {
+			return nil, NewDBError("GetAllURLSByHash", "can't scan", err)
+		}
+		link.CreatedAt = fromUnixNano(createdAt)
+		link.ExpiresAt = fromNullUnixNano(expiresAt)
+		link.Hash = hash
+		links = append(links, &link)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, NewDBError("GetAllURLSByHash", "can't read rows", err)
+	}
+
+	if len(links) == 0 {
+		return nil, fmt.Errorf("%w: the user has no previously created links", ErrNotFound)
+	}
+
+	return links, nil
+}
+
+// qLiveByBaseURL - поиск действующей ссылки по URL, удалённые и истёкшие ссылки не учитываются
+const qLiveByBaseURL = `
+SELECT
+    id
+FROM links
+WHERE
+    baseurl = ?
+AND NOT
+    is_deleted
+AND
+    (expires_at IS NULL OR expires_at > ?)
+`
+
+// CheckBaseURLExist - функция для проверки нахождения действующей ссылки на URL в БД
+func (s *SQLiteStorage) CheckBaseURLExist(ctx context.Context, link *models.Link) (bool, error) {
+	var id string
+
+	err := s.db.QueryRowContext(ctx, qLiveByBaseURL, link.BaseURL, unixNano(time.Now())).Scan(&id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return false, nil
+	case err == nil:
+		link.ID = id
+		return true, nil
+	default:
+		return false, NewDBError("CheckBaseURLExist", "can't scan", err)
+	}
+}
+
+// UpdateHash - функция для добавления пользователя к владельцам уже существующей записи
+func (s *SQLiteStorage) UpdateHash(ctx context.Context, link *models.Link) error {
+	return s.inTx(ctx, "UpdateHash", func(tx *sql.Tx) error {
+		var id string
+		err := tx.QueryRowContext(ctx, qLiveByBaseURL, link.BaseURL, unixNano(time.Now())).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return NewDBError("UpdateHash", "can't scan", err)
+		}
+
+		if err = s.addOwner(ctx, tx, id, link.Hash); err != nil {
+			return NewDBError("UpdateHash", "can't insert owner", err)
+		}
+
+		return nil
+	})
+}
+
+/*
+DeleteURLS - функция удаления записей пользователей одной транзакцией: у общей ссылки удаляется только владение пользователя,
+запись помечается удалённой, когда удаляет её последний владелец. Записи чужих пользователей пропускаются
+*/
+func (s *SQLiteStorage) DeleteURLS(ctx context.Context, links []*models.Link) error {
+	qOwner := `
+	DELETE FROM link_owners
+	WHERE
+	    link_id = ?
+	AND
+	    user_id = (SELECT id FROM users WHERE hash = ?)
+	AND
+	    EXISTS (SELECT 1 FROM links WHERE id = link_owners.link_id AND NOT is_deleted)
+	AND
+	    (SELECT count(*) FROM link_owners o WHERE o.link_id = link_owners.link_id) > 1
+	`
+	qDelete := `
+	UPDATE links SET
+		is_deleted = 1
+	WHERE
+	    id = ?
+	AND NOT
+	    is_deleted
+	AND
+	    EXISTS (
+	        SELECT 1 FROM link_owners o
+	        JOIN users u ON u.id = o.user_id
+	        WHERE o.link_id = links.id AND u.hash = ?
+	    )
+	AND
+	    (SELECT count(*) FROM link_owners o WHERE o.link_id = links.id) = 1
+	`
+
+	return s.inTx(ctx, "DeleteURLS", func(tx *sql.Tx) error {
+		for _, v := range links {
+			if _, err := tx.ExecContext(ctx, qOwner, v.ID, v.Hash); err != nil {
+				return NewDBError("DeleteURLS", "can't delete owner", err)
+			}
+			if _, err := tx.ExecContext(ctx, qDelete, v.ID, v.Hash); err != nil {
+				return NewDBError("DeleteURLS", "can't do query", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// DeleteExpiredURLS - функция удаления записей, срок действия которых истёк до момента before, вместе со связанными данными
+func (s *SQLiteStorage) DeleteExpiredURLS(ctx context.Context, before time.Time) (int, error) {
+	var deleted int64
+
+	// связанные строки удаляются явно, так как внешние ключи SQLite выключены по умолчанию
+	expired := `SELECT id FROM links WHERE expires_at <= ?`
+	queries := []string{
+		`DELETE FROM link_owners WHERE link_id IN (` + expired + `)`,
+		`DELETE FROM click_events WHERE link_id IN (` + expired + `)`,
+		`DELETE FROM link_stats WHERE link_id IN (` + expired + `)`,
+	}
+
+	err := s.inTx(ctx, "DeleteExpiredURLS", func(tx *sql.Tx) error {
+		for _, q := range queries {
+			if _, err := tx.ExecContext(ctx, q, unixNano(before)); err != nil {
+				return NewDBError("DeleteExpiredURLS", "can't do query", err)
+			}
+		}
+
+		res, err := tx.ExecContext(ctx, `DELETE FROM links WHERE expires_at <= ?`, unixNano(before))
+		if err != nil {
+			return NewDBError("DeleteExpiredURLS", "can't do query", err)
+		}
+
+		deleted, err = res.RowsAffected()
+		if err != nil {
+			return NewDBError("DeleteExpiredURLS", "can't get rows affected", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(deleted), nil
+}
+
+// AddClicks - функция увеличения счётчиков переходов по ссылкам одной транзакцией
+func (s *SQLiteStorage) AddClicks(ctx context.Context, clicks map[string]int64) error {
+	return s.inTx(ctx, "AddClicks", func(tx *sql.Tx) error {
+		for id, count := range clicks {
+			if _, err := tx.ExecContext(ctx, `UPDATE links SET clicks = clicks + ? WHERE id = ?`, count, id); err != nil {
+				return NewDBError("AddClicks", "can't do query", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// AddClickEvents - функция записи сырых событий перехода одной транзакцией, события по несуществующим ссылкам пропускаются
+func (s *SQLiteStorage) AddClickEvents(ctx context.Context, events []*models.ClickEvent) error {
+	q := `
+	INSERT INTO click_events
+	    (link_id, created_at, referrer, user_agent)
+	SELECT
+	    ?, ?, ?, ?
+	WHERE
+	    EXISTS (SELECT 1 FROM links WHERE id = ?)
+	`
+
+	return s.inTx(ctx, "AddClickEvents", func(tx *sql.Tx) error {
+		for _, v := range events {
+			_, err := tx.ExecContext(ctx, q, v.LinkID, unixNano(v.Time), v.Referrer, v.UserAgent, v.LinkID)
+			if err != nil {
+				return NewDBError("AddClickEvents", "can't do query", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetPendingClickEvents - функция получения событий перехода, ещё не учтённых в статистике
+func (s *SQLiteStorage) GetPendingClickEvents(ctx context.Context, limit int) ([]*models.ClickEvent, error) {
+	q := `
+	SELECT
+	    id, link_id, created_at, referrer, user_agent
+	FROM click_events
+	WHERE
+	    NOT rolled_up
+	ORDER BY id
+	LIMIT ?
+	`
+
+	rows, err := s.db.QueryContext(ctx, q, limit)
+	if err != nil {
+		return nil, NewDBError("GetPendingClickEvents", "can't do query", err)
+	}
+
+	defer rows.Close()
+
+	events := make([]*models.ClickEvent, 0, limit)
+	for rows.Next() {
+		var event models.ClickEvent
+		var createdAt int64
+		err = rows.Scan(&event.ID, &event.LinkID, &createdAt, &event.Referrer, &event.UserAgent)
+		if err != nil {
+			return nil, NewDBError("GetPendingClickEvents", "can't scan", err)
+		}
+		event.Time = fromUnixNano(createdAt)
+		events = append(events, &event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, NewDBError("GetPendingClickEvents", "can't read rows", err)
+	}
+
+	return events, nil
+}
+
+/*
+SaveClickStats - функция пометки событий учтёнными и увеличения счётчиков статистики в одной транзакции.
+Если часть событий уже учтена, транзакция откатывается, чтобы переходы не посчитались дважды
+*/
+func (s *SQLiteStorage) SaveClickStats(ctx context.Context, ids []int64, counters []*models.StatsCounter) error {
+	qCounters := `
+	INSERT INTO link_stats
+	    (link_id, bucket, dimension, value, count)
+	SELECT
+	    ?, ?, ?, ?, ?
+	WHERE
+	    EXISTS (SELECT 1 FROM links WHERE id = ?)
+	ON CONFLICT (link_id, bucket, dimension, value) DO UPDATE SET
+		count = count + excluded.count
+	`
+
+	return s.inTx(ctx, "SaveClickStats", func(tx *sql.Tx) error {
+		var rolledUp int64
+		for _, id := range ids {
+			res, err := tx.ExecContext(ctx, `UPDATE click_events SET rolled_up = 1 WHERE id = ? AND NOT rolled_up`, id)
+			if err != nil {
+				return NewDBError("SaveClickStats", "can't exec tx", err)
+			}
+
+			affected, err := res.RowsAffected()
+			if err != nil {
+				return NewDBError("SaveClickStats", "can't get rows affected", err)
+			}
+			rolledUp += affected
+		}
+
+		if rolledUp != int64(len(ids)) {
+			return fmt.Errorf("%w: click events are already rolled up", ErrConflict)
+		}
+
+		for _, v := range counters {
+			_, err := tx.ExecContext(ctx, qCounters, v.LinkID, unixNano(v.Bucket), v.Dimension, v.Value, v.Count, v.LinkID)
+			if err != nil {
+				return NewDBError("SaveClickStats", "can't exec tx", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetClickStats - функция получения счётчиков статистики ссылки
+func (s *SQLiteStorage) GetClickStats(ctx context.Context, id string) ([]*models.StatsCounter, error) {
+	q := `
+	SELECT
+	    link_id, bucket, dimension, value, count
+	FROM link_stats
+	WHERE
+	    link_id = ?
+	`
+
+	rows, err := s.db.QueryContext(ctx, q, id)
+	if err != nil {
+		return nil, NewDBError("GetClickStats", "can't do query", err)
+	}
+
+	defer rows.Close()
+
+	var counters []*models.StatsCounter
+	for rows.Next() {
+		var counter models.StatsCounter
+		var bucket int64
+		err = rows.Scan(&counter.LinkID, &bucket, &counter.Dimension, &counter.Value, &counter.Count)
+		if err != nil {
+			return nil, NewDBError("GetClickStats", "can't scan", err)
+		}
+		counter.Bucket = fromUnixNano(bucket)
+		counters = append(counters, &counter)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, NewDBError("GetClickStats", "can't read rows", err)
+	}
+
+	return counters, nil
+}
+
+// DeleteClickEvents - функция удаления учтённых в статистике событий, произошедших до момента before
+func (s *SQLiteStorage) DeleteClickEvents(ctx context.Context, before time.Time) (int, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM click_events WHERE rolled_up AND created_at < ?`, unixNano(before))
+	if err != nil {
+		return 0, NewDBError("DeleteClickEvents", "can't do query", err)
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, NewDBError("DeleteClickEvents", "can't get rows affected", err)
+	}
+
+	return int(deleted), nil
+}
+
+// NextID - функция получения следующего значения последовательности ID ссылок
+func (s *SQLiteStorage) NextID(ctx context.Context) (uint64, error) {
+	var id int64
+	q := `UPDATE id_sequences SET value = value + 1 WHERE name = 'links' RETURNING value`
+
+	if err := s.db.QueryRowContext(ctx, q).Scan(&id); err != nil {
+		return 0, NewDBError("NextID", "can't scan", err)
+	}
+
+	return uint64(id), nil
+}
+
+// ReserveIDBlock - функция резервирования блока из size ID ссылок из того же счётчика, что и NextID, возвращает первый ID блока
+func (s *SQLiteStorage) ReserveIDBlock(ctx context.Context, size uint64) (uint64, error) {
+	var start int64
+	q := `UPDATE id_sequences SET value = value + ? WHERE name = 'links' RETURNING value - ? + 1`
+
+	if err := s.db.QueryRowContext(ctx, q, int64(size), int64(size)).Scan(&start); err != nil {
+		return 0, NewDBError("ReserveIDBlock", "can't scan", err)
+	}
+
+	return uint64(start), nil
+}
+
+// CurrentID - функция получения последнего выданного значения последовательности ID ссылок без его изменения
+func (s *SQLiteStorage) CurrentID(ctx context.Context) (uint64, error) {
+	var id int64
+	q := `SELECT value FROM id_sequences WHERE name = 'links'`
+
+	if err := s.db.QueryRowContext(ctx, q).Scan(&id); err != nil {
+		return 0, NewDBError("CurrentID", "can't scan", err)
+	}
+
+	return uint64(id), nil
+}
+
+// ListURLS - функция постраничного получения всех записей с владельцами в порядке возрастания ID, начиная после after (SQLite)
+func (s *SQLiteStorage) ListURLS(ctx context.Context, after string, limit int) ([]*models.LinkRecord, error) {
+	q := `
+	SELECT
+	    l.id, l.baseurl, l.correlation_id, l.created_at, l.expires_at, l.clicks, l.is_deleted, u.hash
+	FROM (SELECT * FROM links WHERE id > ? ORDER BY id LIMIT ?) l
+	LEFT JOIN link_owners o ON o.link_id = l.id
+	LEFT JOIN users u ON u.id = o.user_id
+	ORDER BY l.id, u.hash
+	`
+
+	rows, err := s.db.QueryContext(ctx, q, after, limit)
+	if err != nil {
+		return nil, NewDBError("ListURLS", "can't do query", err)
+	}
+
+	defer rows.Close()
+
+	records := make([]*models.LinkRecord, 0, limit)
+	for rows.Next() {
+		var record models.LinkRecord
+		var createdAt int64
+		var expiresAt sql.NullInt64
+		var hash sql.NullString
+		err = rows.Scan(&record.ID, &record.BaseURL, &record.CorrelationID, &createdAt, &expiresAt, &record.Clicks,
+			&record.Deleted, &hash)
+		if err != nil {
+			return nil, NewDBError("ListURLS", "can't scan", err)
+		}
+
+		// строки одной ссылки идут подряд, по строке на владельца
+		if n := len(records); n == 0 || records[n-1].ID != record.ID {
+			record.CreatedAt = fromUnixNano(createdAt)
+			record.ExpiresAt = fromNullUnixNano(expiresAt)
+			record.Owners = []string{}
+			records = append(records, &record)
+		}
+
+		if hash.Valid {
+			last := records[len(records)-1]
+			last.Owners = append(last.Owners, hash.String)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, NewDBError("ListURLS", "can't read rows", err)
+	}
+
+	return records, nil
+}
+
+/*
+ImportURLS - функция добавления записей с сохранением ID, владельцев и признака удаления одной транзакцией (SQLite).
+Результат импорта каждой записи пишется в её Status, с DryRun хранилище не изменяется
+*/
+func (s *SQLiteStorage) ImportURLS(ctx context.Context, records []*models.LinkRecord, opts models.ImportOptions) error {
+	qOverwrite := `
+	UPDATE links SET
+		baseurl = ?, correlation_id = ?, created_at = coalesce(?, created_at), expires_at = ?, clicks = ?, is_deleted = ?
+	WHERE
+	    id = ?
+	`
+
+	return s.inTx(ctx, "ImportURLS", func(tx *sql.Tx) error {
+		ids := make([]string, 0, len(records))
+		baseURLs := make([]string, 0, len(records))
+		for _, v := range records {
+			ids = append(ids, v.ID)
+			baseURLs = append(baseURLs, v.BaseURL)
+		}
+
+		now := time.Now()
+		byID, byBaseURL, err := s.existingLinks(ctx, tx, ids, baseURLs, now)
+		if err != nil {
+			return NewDBError("ImportURLS", "can't do query", err)
+		}
+
+		existingID := func(baseURL string) (string, bool) {
+			id, ok := byBaseURL[baseURL]
+			return id, ok
+		}
+		resolveImport(records, opts.Overwrite, now, func(id string) (string, bool) {
+			baseURL, ok := byID[id]
+			return baseURL, ok
+		}, existingID)
+
+		if opts.DryRun {
+			return nil
+		}
+
+		retired := retiredImports(records, now, existingID)
+
+		// записи применяются по порядку, поэтому повтор ID в пачке обрабатывается так же, как в остальных хранилищах
+		for _, v := range records {
+			switch v.Status {
+			case models.LinkCreated:
+				err = s.insertLink(ctx, tx, &v.Link, v.Deleted || retired[v])
+			case models.LinkOverwritten:
+				var createdAt *time.Time
+				if !v.CreatedAt.IsZero() {
+					createdAt = &v.CreatedAt
+				}
+
+				_, err = tx.ExecContext(ctx, qOverwrite, v.BaseURL, v.CorrelationID, nullUnixNano(createdAt),
+					nullUnixNano(v.ExpiresAt), v.Clicks, v.Deleted || retired[v], v.ID)
+				if err == nil {
+					_, err = tx.ExecContext(ctx, `DELETE FROM link_owners WHERE link_id = ?`, v.ID)
+				}
+			case models.LinkConflict:
+				continue
+			}
+			if err != nil {
+				return NewDBError("ImportURLS", "can't write link", err)
+			}
+
+			for _, hash := range v.Owners {
+				if err = s.addOwner(ctx, tx, v.ID, hash); err != nil {
+					return NewDBError("ImportURLS", "can't insert owner", err)
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// Ping - проверка доступности БД (SQLite)
+func (s *SQLiteStorage) Ping(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return NewDBError("Ping", "can't ping database", err)
+	}
+
+	return nil
+}
+
+func (s *SQLiteStorage) Close() error {
+	return s.db.Close()
+}
+
+func NewSQLiteStorage(ctx context.Context, log *zap.SugaredLogger, cfg *config.Config) (*SQLiteStorage, error) {
+	// при выключенной автомиграции схему обновляют отдельной командой shortener migrate up
+	if cfg.DB.AutoMigrate {
+		if err := Migrate(ctx, log, cfg.DB.CDN, "up"); err != nil {
+			return nil, fmt.Errorf("can't migrate DB, err: %w", err)
+		}
+	}
+
+	db, err := openSQLite(cfg.DB.CDN)
+	if err != nil {
+		return nil, fmt.Errorf("can't create SQLiteStorage, err: %w", err)
+	}
+
+	// единственное соединение сериализует транзакции и исключает ошибки SQLITE_BUSY между соединениями
+	db.SetMaxOpenConns(1)
+
+	if err = db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("can't create SQLiteStorage, err: %w", err)
+	}
+
+	return &SQLiteStorage{
+		log: log,
+		cfg: cfg,
+		db:  db,
+	}, nil
+}
@@ -0,0 +1,1219 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/models"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/app/services"
+	"github.com/kirill-chelyatnikov/shortener-url-service/internal/config"
+	"github.com/kirill-chelyatnikov/shortener-url-service/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDatabaseDSN - переменная окружения с DSN локальной БД, без неё тесты PostgreSQLStorage пропускаются
+const testDatabaseDSN = "TEST_DATABASE_DSN"
+
+var testLog = logger.InitLogger()
+
+// newRepositoryFunc - конструктор хранилища, которое проверяется набором тестов
+type newRepositoryFunc func(t *testing.T) services.RepositoryInterface
+
+func TestMapStorage(t *testing.T) {
+	testRepository(t, func(t *testing.T) services.RepositoryInterface {
+		return NewMapStorage(testLog)
+	})
+}
+
+func TestFileStorage(t *testing.T) {
+	testRepository(t, func(t *testing.T) services.RepositoryInterface {
+		cfg := &config.Config{}
+		cfg.App.FileStorage = filepath.Join(t.TempDir(), "storage.json")
+
+		return newTestFileStorage(t, cfg)
+	})
+}
+
+// newTestFileStorage - открытие файлового хранилища с завершением теста при ошибке
+func newTestFileStorage(t *testing.T, cfg *config.Config) *FileStorage {
+	s, err := NewFileStorage(testLog, cfg)
+	require.NoError(t, err)
+
+	return s
+}
+
+func TestFileStorageReload(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{}
+	cfg.App.FileStorage = filepath.Join(t.TempDir(), "storage.json")
+
+	s := newTestFileStorage(t, cfg)
+	link := newTestLink(uniqueURL("reload"))
+	require.NoError(t, s.AddURL(ctx, link))
+	batchLink := newTestLink(uniqueURL("reload-batch"))
+	batchLink.Hash = link.Hash
+	require.NoError(t, s.AddURLSBatch(ctx, []*models.Link{batchLink}))
+	require.NoError(t, s.UpdateHash(ctx, &models.Link{BaseURL: link.BaseURL, Hash: "second"}))
+	require.NoError(t, s.AddClicks(ctx, map[string]int64{link.ID: 7}))
+	require.NoError(t, s.AddClickEvents(ctx, []*models.ClickEvent{{LinkID: link.ID, Time: time.Now()}, {LinkID: link.ID, Time: time.Now()}}))
+	pending, err := s.GetPendingClickEvents(ctx, 1)
+	require.NoError(t, err)
+	require.NoError(t, s.SaveClickStats(ctx, []int64{pending[0].ID}, []*models.StatsCounter{
+		{LinkID: link.ID, Bucket: time.Now().UTC().Truncate(time.Hour), Dimension: models.DimensionTraffic, Value: models.TrafficHuman, Count: 1},
+	}))
+	sequence, err := s.NextID(ctx)
+	require.NoError(t, err)
+	imported := &models.LinkRecord{Link: models.Link{ID: randomString(), BaseURL: uniqueURL("reload-import")}, Owners: []string{"second"}, Deleted: true}
+	require.NoError(t, s.ImportURLS(ctx, []*models.LinkRecord{imported}, models.ImportOptions{}))
+	require.NoError(t, s.Close())
+
+	s = newTestFileStorage(t, cfg)
+	defer s.Close()
+
+	// последовательность продолжается с места остановки
+	next, err := s.NextID(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, sequence+1, next)
+
+	url, err := s.GetURLByID(ctx, link.ID)
+	require.NoError(t, err)
+	assert.Equal(t, link.BaseURL, url)
+
+	links, err := s.GetAllURLSByHash(ctx, link.Hash)
+	require.NoError(t, err)
+	assert.Len(t, links, 2)
+
+	links, err = s.GetAllURLSByHash(ctx, "second")
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, link.ID, links[0].ID)
+	assert.Equal(t, int64(7), links[0].Clicks)
+
+	_, err = s.GetURLByID(ctx, imported.ID)
+	assert.ErrorIs(t, err, ErrGone)
+
+	records, err := s.ListURLS(ctx, "", 10)
+	require.NoError(t, err)
+	assert.Len(t, records, 3)
+
+	// после перезапуска не учтённым остаётся только второе событие
+	pending, err = s.GetPendingClickEvents(ctx, 10)
+	require.NoError(t, err)
+	assert.Len(t, pending, 1)
+
+	stats, err := s.GetClickStats(ctx, link.ID)
+	require.NoError(t, err)
+	require.Len(t, stats, 1)
+	assert.Equal(t, int64(1), stats[0].Count)
+}
+
+func TestFileStorageCompaction(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{}
+	cfg.App.FileStorage = filepath.Join(t.TempDir(), "storage.json")
+
+	s := newTestFileStorage(t, cfg)
+	first := newTestLink(uniqueURL("compact-first"))
+	second := newTestLink(uniqueURL("compact-second"))
+	second.Hash = first.Hash
+	require.NoError(t, s.AddURL(ctx, second))
+	require.NoError(t, s.AddURL(ctx, first))
+	sequence, err := s.NextID(ctx)
+	require.NoError(t, err)
+
+	old := time.Now().Add(-48 * time.Hour)
+	events := make([]*models.ClickEvent, 0, 100)
+	for i := 0; i < 100; i++ {
+		events = append(events, &models.ClickEvent{LinkID: first.ID, Time: old, Referrer: "https://referrer.com"})
+	}
+	require.NoError(t, s.AddClickEvents(ctx, events))
+	pending, err := s.GetPendingClickEvents(ctx, 100)
+	require.NoError(t, err)
+	ids := make([]int64, 0, len(pending))
+	for _, v := range pending {
+		ids = append(ids, v.ID)
+	}
+	require.NoError(t, s.SaveClickStats(ctx, ids, []*models.StatsCounter{
+		{LinkID: first.ID, Bucket: old.UTC().Truncate(time.Hour), Dimension: models.DimensionTraffic, Value: models.TrafficHuman, Count: 100},
+	}))
+	require.NoError(t, s.AddClickEvents(ctx, []*models.ClickEvent{{LinkID: first.ID, Time: time.Now()}}))
+
+	info, err := os.Stat(cfg.App.FileStorage)
+	require.NoError(t, err)
+	before := info.Size()
+
+	// удаление учтённых событий перезаписывает файл без них
+	count, err := s.DeleteClickEvents(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 100, count)
+
+	info, err = os.Stat(cfg.App.FileStorage)
+	require.NoError(t, err)
+	assert.Less(t, info.Size(), before)
+	require.NoError(t, s.Ping(ctx))
+
+	// запись после перезаписи попадает в новый файл
+	third := newTestLink(uniqueURL("compact-third"))
+	require.NoError(t, s.AddURL(ctx, third))
+	require.NoError(t, s.Close())
+
+	s = newTestFileStorage(t, cfg)
+	defer s.Close()
+
+	links, err := s.GetAllURLSByHash(ctx, first.Hash)
+	require.NoError(t, err)
+	require.Len(t, links, 2)
+	assert.Equal(t, second.ID, links[0].ID)
+	assert.Equal(t, first.ID, links[1].ID)
+
+	_, err = s.GetURLByID(ctx, third.ID)
+	require.NoError(t, err)
+
+	next, err := s.NextID(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, sequence+1, next)
+
+	pending, err = s.GetPendingClickEvents(ctx, 10)
+	require.NoError(t, err)
+	assert.Len(t, pending, 1)
+
+	stats, err := s.GetClickStats(ctx, first.ID)
+	require.NoError(t, err)
+	require.Len(t, stats, 1)
+	assert.Equal(t, int64(100), stats[0].Count)
+}
+
+func TestFileStorageIncompleteRecord(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{}
+	cfg.App.FileStorage = filepath.Join(t.TempDir(), "storage.json")
+
+	s := newTestFileStorage(t, cfg)
+	link := newTestLink(uniqueURL("incomplete"))
+	require.NoError(t, s.AddURL(ctx, link))
+	require.NoError(t, s.Close())
+
+	// падение во время записи оставляет в конце файла запись без перевода строки
+	f, err := os.OpenFile(cfg.App.FileStorage, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"action":"add","id":"brok`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	s = newTestFileStorage(t, cfg)
+	second := newTestLink(uniqueURL("incomplete-second"))
+	require.NoError(t, s.AddURL(ctx, second))
+	require.NoError(t, s.Close())
+
+	// оборванная запись отброшена, записи после неё читаются после перезапуска
+	s = newTestFileStorage(t, cfg)
+	defer s.Close()
+
+	for _, v := range []*models.Link{link, second} {
+		url, err := s.GetURLByID(ctx, v.ID)
+		require.NoError(t, err)
+		assert.Equal(t, v.BaseURL, url)
+	}
+}
+
+func TestFileStorageFailedWrite(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{}
+	cfg.App.FileStorage = filepath.Join(t.TempDir(), "storage.json")
+
+	s := newTestFileStorage(t, cfg)
+	link := newTestLink(uniqueURL("failed-write"))
+	require.NoError(t, s.AddURL(ctx, link))
+
+	// файл, открытый только на чтение, не принимает записи и не обрезается
+	writable := s.file
+	readonly, err := os.Open(cfg.App.FileStorage)
+	require.NoError(t, err)
+	s.file = readonly
+	assert.ErrorIs(t, s.AddURL(ctx, newTestLink(uniqueURL("failed-write-second"))), ErrUnavailable)
+	require.NoError(t, readonly.Close())
+
+	// после неисправимой ошибки хранилище отказывает в записи, даже если файл снова доступен
+	s.file = writable
+	assert.ErrorIs(t, s.AddURL(ctx, newTestLink(uniqueURL("failed-write-third"))), ErrUnavailable)
+	require.NoError(t, s.Close())
+
+	s = newTestFileStorage(t, cfg)
+	defer s.Close()
+
+	url, err := s.GetURLByID(ctx, link.ID)
+	require.NoError(t, err)
+	assert.Equal(t, link.BaseURL, url)
+}
+
+func TestFileStorageMalformedRecord(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.App.FileStorage = filepath.Join(t.TempDir(), "storage.json")
+	require.NoError(t, os.WriteFile(cfg.App.FileStorage, []byte(`{"action":"events_purge"}`+"\n"), 0o600))
+
+	s := &FileStorage{log: testLog, index: newLinkIndex(), clicks: newClickLog()}
+	f, err := os.Open(cfg.App.FileStorage)
+	require.NoError(t, err)
+	defer f.Close()
+	s.file = f
+
+	assert.Error(t, s.load())
+}
+
+func TestFileStoragePing(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.App.FileStorage = filepath.Join(t.TempDir(), "storage.json")
+
+	s := newTestFileStorage(t, cfg)
+	defer s.Close()
+	require.NoError(t, s.Ping(context.Background()))
+
+	// удалённый файл хранилища больше не принимает записи
+	require.NoError(t, os.Remove(cfg.App.FileStorage))
+	assert.Error(t, s.Ping(context.Background()))
+}
+
+func TestNewStorageFromDSNError(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing", "storage")
+
+	tests := []struct {
+		name string
+		dsn  string
+	}{
+		{name: "unsupported", dsn: "mysql://localhost"},
+		{name: "file", dsn: "file:" + missing + ".json"},
+		{name: "sqlite", dsn: sqliteScheme + missing + ".db"},
+		{name: "postgres", dsn: "postgres://localhost:invalid-port/db"},
+	}
+
+	// ошибка подключения возвращается вызывающему, а не завершает процесс
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.DB.AutoMigrate = true
+
+			repository, err := NewStorageFromDSN(context.Background(), testLog, cfg, tt.dsn)
+			assert.Error(t, err)
+			assert.Nil(t, repository)
+		})
+	}
+}
+
+func TestPostgreSQLStorage(t *testing.T) {
+	dsn := os.Getenv(testDatabaseDSN)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDatabaseDSN)
+	}
+
+	testRepository(t, func(t *testing.T) services.RepositoryInterface {
+		cfg := &config.Config{}
+		cfg.DB.CDN = dsn
+		cfg.DB.AutoMigrate = true
+
+		s, err := NewPostgreSQLStorage(context.Background(), testLog, cfg)
+		require.NoError(t, err)
+
+		return s
+	})
+}
+
+func TestSQLiteStorage(t *testing.T) {
+	testRepository(t, func(t *testing.T) services.RepositoryInterface {
+		cfg := &config.Config{}
+		cfg.DB.CDN = sqliteScheme + filepath.Join(t.TempDir(), "storage.db")
+		cfg.DB.AutoMigrate = true
+
+		s, err := NewSQLiteStorage(context.Background(), testLog, cfg)
+		require.NoError(t, err)
+
+		return s
+	})
+}
+
+// testRepository - общий набор тестов, которому должно удовлетворять любое хранилище
+func testRepository(t *testing.T, newRepository newRepositoryFunc) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, repository services.RepositoryInterface)
+	}{
+		{name: "not_found", test: testNotFound},
+		{name: "add_and_get", test: testAddAndGet},
+		{name: "dedup_base_url", test: testDedupBaseURL},
+		{name: "dedup_dead_links", test: testDedupDeadLinks},
+		{name: "multi_owner", test: testMultiOwner},
+		{name: "upsert", test: testUpsert},
+		{name: "batch", test: testBatch},
+		{name: "batch_dedup", test: testBatchDedup},
+		{name: "delete", test: testDelete},
+		{name: "delete_shared", test: testDeleteShared},
+		{name: "owned_link", test: testOwnedLink},
+		{name: "expiration", test: testExpiration},
+		{name: "clicks", test: testClicks},
+		{name: "click_stats", test: testClickStats},
+		{name: "sequence", test: testSequence},
+		{name: "list_and_import", test: testListAndImport},
+		{name: "import_overwrite", test: testImportOverwrite},
+		{name: "ping", test: testPing},
+		{name: "context_cancellation", test: testContextCancellation},
+		{name: "concurrent_writers", test: testConcurrentWriters},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := newRepository(t)
+			defer func() {
+				assert.NoError(t, repository.Close())
+			}()
+
+			tt.test(t, repository)
+		})
+	}
+}
+
+func testNotFound(t *testing.T, repository services.RepositoryInterface) {
+	ctx := context.Background()
+
+	_, err := repository.GetURLByID(ctx, randomString())
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = repository.GetAllURLSByHash(ctx, randomString())
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	link := newTestLink(uniqueURL("not-found"))
+	exist, err := repository.CheckBaseURLExist(ctx, link)
+	require.NoError(t, err)
+	assert.False(t, exist)
+}
+
+func testAddAndGet(t *testing.T, repository services.RepositoryInterface) {
+	ctx := context.Background()
+	link := newTestLink(uniqueURL("add"))
+
+	require.NoError(t, repository.AddURL(ctx, link))
+
+	url, err := repository.GetURLByID(ctx, link.ID)
+	require.NoError(t, err)
+	assert.Equal(t, link.BaseURL, url)
+
+	links, err := repository.GetAllURLSByHash(ctx, link.Hash)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, link.ID, links[0].ID)
+	assert.Equal(t, link.BaseURL, links[0].BaseURL)
+
+	// повторное добавление записи с тем же ID недопустимо
+	duplicate := newTestLink(uniqueURL("add-duplicate"))
+	duplicate.ID = link.ID
+	err = repository.AddURL(ctx, duplicate)
+	assert.ErrorIs(t, err, ErrConflict)
+	// занятость id сервис отличает от занятости URL, чтобы повторить вставку с новым ID
+	assert.ErrorIs(t, err, services.ErrIDCollision)
+}
+
+func testDedupBaseURL(t *testing.T, repository services.RepositoryInterface) {
+	ctx := context.Background()
+	link := newTestLink(uniqueURL("dedup"))
+
+	require.NoError(t, repository.AddURL(ctx, link))
+
+	duplicate := newTestLink(link.BaseURL)
+	exist, err := repository.CheckBaseURLExist(ctx, duplicate)
+	require.NoError(t, err)
+	assert.True(t, exist)
+	assert.Equal(t, link.ID, duplicate.ID)
+
+	// запись того же URL под другим ID недопустима
+	err = repository.AddURL(ctx, newTestLink(link.BaseURL))
+	assert.ErrorIs(t, err, ErrConflict)
+	assert.NotErrorIs(t, err, services.ErrIDCollision)
+}
+
+func testDedupDeadLinks(t *testing.T, repository services.RepositoryInterface) {
+	ctx := context.Background()
+	past := time.Now().Add(-time.Hour)
+
+	deleted := newTestLink(uniqueURL("dedup-deleted"))
+	expired := newTestLink(uniqueURL("dedup-expired"))
+	expired.ExpiresAt = &past
+	require.NoError(t, repository.AddURLSBatch(ctx, []*models.Link{deleted, expired}))
+	require.NoError(t, repository.DeleteURLS(ctx, []*models.Link{{ID: deleted.ID, Hash: deleted.Hash}}))
+
+	// удалённые и истёкшие ссылки не считаются уже сокращёнными URL
+	for _, v := range []*models.Link{deleted, expired} {
+		exist, err := repository.CheckBaseURLExist(ctx, &models.Link{BaseURL: v.BaseURL})
+		require.NoError(t, err)
+		assert.False(t, exist)
+
+		owner := randomString()
+		require.NoError(t, repository.UpdateHash(ctx, &models.Link{BaseURL: v.BaseURL, Hash: owner}))
+		_, err = repository.GetAllURLSByHash(ctx, owner)
+		assert.ErrorIs(t, err, ErrNotFound)
+	}
+
+	// новая ссылка на тот же URL создаётся под новым ID и работает, старая остаётся недоступной
+	upserted := newTestLink(deleted.BaseURL)
+	existed, err := repository.UpsertURL(ctx, upserted)
+	require.NoError(t, err)
+	assert.False(t, existed)
+
+	batch := []*models.Link{newTestLink(expired.BaseURL)}
+	require.NoError(t, repository.AddURLSBatch(ctx, batch))
+	assert.Equal(t, models.LinkCreated, batch[0].Status)
+
+	for old, fresh := range map[*models.Link]*models.Link{deleted: upserted, expired: batch[0]} {
+		assert.NotEqual(t, old.ID, fresh.ID)
+
+		url, err := repository.GetURLByID(ctx, fresh.ID)
+		require.NoError(t, err)
+		assert.Equal(t, old.BaseURL, url)
+
+		_, err = repository.GetURLByID(ctx, old.ID)
+		assert.ErrorIs(t, err, ErrGone)
+
+		// дальше URL сокращается в новую ссылку
+		duplicate := newTestLink(old.BaseURL)
+		existed, err = repository.UpsertURL(ctx, duplicate)
+		require.NoError(t, err)
+		assert.True(t, existed)
+		assert.Equal(t, fresh.ID, duplicate.ID)
+	}
+
+	// импорт действующей записи на URL удалённой ссылки не конфликтует
+	deletedAgain := newTestLink(uniqueURL("dedup-import"))
+	require.NoError(t, repository.AddURL(ctx, deletedAgain))
+	require.NoError(t, repository.DeleteURLS(ctx, []*models.Link{{ID: deletedAgain.ID, Hash: deletedAgain.Hash}}))
+	record := &models.LinkRecord{Link: models.Link{ID: randomString(), BaseURL: deletedAgain.BaseURL}, Owners: []string{randomString()}}
+	require.NoError(t, repository.ImportURLS(ctx, []*models.LinkRecord{record}, models.ImportOptions{}))
+	assert.Equal(t, models.LinkCreated, record.Status)
+
+	url, err := repository.GetURLByID(ctx, record.ID)
+	require.NoError(t, err)
+	assert.Equal(t, deletedAgain.BaseURL, url)
+}
+
+func testMultiOwner(t *testing.T, repository services.RepositoryInterface) {
+	ctx := context.Background()
+	link := newTestLink(uniqueURL("multi-owner"))
+	owner := randomString()
+
+	require.NoError(t, repository.AddURL(ctx, link))
+
+	// повторное добавление хеша не должно дублировать запись у пользователя
+	for i := 0; i < 2; i++ {
+		require.NoError(t, repository.UpdateHash(ctx, &models.Link{BaseURL: link.BaseURL, Hash: owner}))
+	}
+
+	for _, hash := range []string{link.Hash, owner} {
+		links, err := repository.GetAllURLSByHash(ctx, hash)
+		require.NoError(t, err)
+		require.Len(t, links, 1)
+		assert.Equal(t, link.ID, links[0].ID)
+	}
+}
+
+func testUpsert(t *testing.T, repository services.RepositoryInterface) {
+	const writers = 20
+
+	ctx := context.Background()
+	link := newTestLink(uniqueURL("upsert"))
+
+	existed, err := repository.UpsertURL(ctx, link)
+	require.NoError(t, err)
+	assert.False(t, existed)
+
+	// тот же URL под другим ID: возвращается существующий ID, пользователь становится владельцем
+	duplicate := newTestLink(link.BaseURL)
+	existed, err = repository.UpsertURL(ctx, duplicate)
+	require.NoError(t, err)
+	assert.True(t, existed)
+	assert.Equal(t, link.ID, duplicate.ID)
+
+	links, err := repository.GetAllURLSByHash(ctx, duplicate.Hash)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, link.ID, links[0].ID)
+
+	// занятый ID с новым URL - коллизия ID
+	taken := newTestLink(uniqueURL("upsert-taken"))
+	taken.ID = link.ID
+	_, err = repository.UpsertURL(ctx, taken)
+	assert.ErrorIs(t, err, ErrConflict)
+	assert.ErrorIs(t, err, services.ErrIDCollision)
+
+	// из конкурентных добавлений одного URL создаёт запись ровно одно, остальные получают её ID
+	shared := uniqueURL("upsert-shared")
+	sharedLinks := make([]*models.Link, writers)
+	results := make([]bool, writers)
+	errs := make([]error, writers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		sharedLinks[i] = newTestLink(shared)
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = repository.UpsertURL(ctx, sharedLinks[i])
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for i := 0; i < writers; i++ {
+		require.NoError(t, errs[i])
+		assert.Equal(t, sharedLinks[0].ID, sharedLinks[i].ID)
+		if !results[i] {
+			created++
+		}
+	}
+	assert.Equal(t, 1, created)
+}
+
+func testBatch(t *testing.T, repository services.RepositoryInterface) {
+	ctx := context.Background()
+	hash := randomString()
+	links := make([]*models.Link, 0, 3)
+
+	for i := 0; i < 3; i++ {
+		link := newTestLink(uniqueURL(fmt.Sprintf("batch-%d", i)))
+		link.Hash = hash
+		links = append(links, link)
+	}
+
+	require.NoError(t, repository.AddURLSBatch(ctx, links))
+
+	for _, v := range links {
+		url, err := repository.GetURLByID(ctx, v.ID)
+		require.NoError(t, err)
+		assert.Equal(t, v.BaseURL, url)
+	}
+
+	// ссылки пользователя возвращаются в порядке добавления
+	result, err := repository.GetAllURLSByHash(ctx, hash)
+	require.NoError(t, err)
+	require.Len(t, result, len(links))
+	for i, v := range result {
+		assert.Equal(t, links[i].ID, v.ID)
+	}
+}
+
+func testBatchDedup(t *testing.T, repository services.RepositoryInterface) {
+	ctx := context.Background()
+	existing := newTestLink(uniqueURL("batch-existing"))
+	require.NoError(t, repository.AddURL(ctx, existing))
+
+	hash := randomString()
+	newBatchLink := func(baseURL string) *models.Link {
+		link := newTestLink(baseURL)
+		link.Hash = hash
+		return link
+	}
+
+	fresh := newBatchLink(uniqueURL("batch-fresh"))
+	duplicate := newBatchLink(existing.BaseURL)
+	inner := newBatchLink(uniqueURL("batch-inner"))
+	innerDuplicate := newBatchLink(inner.BaseURL)
+	takenID := newBatchLink(uniqueURL("batch-taken-id"))
+	takenID.ID = existing.ID
+	innerTakenID := newBatchLink(uniqueURL("batch-inner-taken-id"))
+	innerTakenID.ID = fresh.ID
+
+	links := []*models.Link{fresh, duplicate, inner, innerDuplicate, takenID, innerTakenID}
+	require.NoError(t, repository.AddURLSBatch(ctx, links))
+
+	tests := []struct {
+		name   string
+		link   *models.Link
+		status string
+		id     string
+	}{
+		{name: "fresh", link: fresh, status: models.LinkCreated, id: fresh.ID},
+		{name: "existing_url", link: duplicate, status: models.LinkExisted, id: existing.ID},
+		{name: "inner", link: inner, status: models.LinkCreated, id: inner.ID},
+		{name: "inner_duplicate_url", link: innerDuplicate, status: models.LinkExisted, id: inner.ID},
+		{name: "taken_id", link: takenID, status: models.LinkConflict, id: existing.ID},
+		{name: "inner_taken_id", link: innerTakenID, status: models.LinkConflict, id: fresh.ID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.status, tt.link.Status)
+			assert.Equal(t, tt.id, tt.link.ID)
+
+			url, err := repository.GetURLByID(ctx, tt.id)
+			require.NoError(t, err)
+			if tt.status == models.LinkConflict {
+				// ссылка с занятым ID не добавлена и не перезаписала существующую
+				assert.NotEqual(t, tt.link.BaseURL, url)
+				return
+			}
+			assert.Equal(t, tt.link.BaseURL, url)
+		})
+	}
+
+	// хеш пользователя добавлен к владельцам уже сокращённого URL
+	result, err := repository.GetAllURLSByHash(ctx, hash)
+	require.NoError(t, err)
+
+	ids := make([]string, 0, len(result))
+	for _, v := range result {
+		ids = append(ids, v.ID)
+	}
+	assert.ElementsMatch(t, []string{fresh.ID, existing.ID, inner.ID}, ids)
+}
+
+func testDelete(t *testing.T, repository services.RepositoryInterface) {
+	ctx := context.Background()
+	link := newTestLink(uniqueURL("delete"))
+	kept := newTestLink(uniqueURL("delete-kept"))
+	kept.Hash = link.Hash
+	foreign := newTestLink(uniqueURL("delete-foreign"))
+
+	require.NoError(t, repository.AddURLSBatch(ctx, []*models.Link{link, kept, foreign}))
+
+	// ссылку foreign пытается удалить не её владелец, несуществующая ссылка пропускается
+	require.NoError(t, repository.DeleteURLS(ctx, []*models.Link{
+		{ID: link.ID, Hash: link.Hash},
+		{ID: foreign.ID, Hash: link.Hash},
+		{ID: randomString(), Hash: link.Hash},
+	}))
+
+	_, err := repository.GetURLByID(ctx, link.ID)
+	assert.ErrorIs(t, err, ErrGone)
+
+	url, err := repository.GetURLByID(ctx, foreign.ID)
+	require.NoError(t, err)
+	assert.Equal(t, foreign.BaseURL, url)
+
+	// удалённые ссылки не попадают в список ссылок пользователя
+	links, err := repository.GetAllURLSByHash(ctx, link.Hash)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, kept.ID, links[0].ID)
+}
+
+func testDeleteShared(t *testing.T, repository services.RepositoryInterface) {
+	ctx := context.Background()
+	link := newTestLink(uniqueURL("delete-shared"))
+	second := randomString()
+
+	require.NoError(t, repository.AddURL(ctx, link))
+	require.NoError(t, repository.UpdateHash(ctx, &models.Link{BaseURL: link.BaseURL, Hash: second}))
+
+	// удаление одним из владельцев не затрагивает ссылку у второго
+	require.NoError(t, repository.DeleteURLS(ctx, []*models.Link{{ID: link.ID, Hash: link.Hash}}))
+
+	url, err := repository.GetURLByID(ctx, link.ID)
+	require.NoError(t, err)
+	assert.Equal(t, link.BaseURL, url)
+
+	_, err = repository.GetAllURLSByHash(ctx, link.Hash)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	links, err := repository.GetAllURLSByHash(ctx, second)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, link.ID, links[0].ID)
+
+	// бывший владелец больше не может удалить ссылку, последний владелец удаляет её для всех
+	require.NoError(t, repository.DeleteURLS(ctx, []*models.Link{{ID: link.ID, Hash: link.Hash}}))
+	_, err = repository.GetURLByID(ctx, link.ID)
+	require.NoError(t, err)
+
+	require.NoError(t, repository.DeleteURLS(ctx, []*models.Link{{ID: link.ID, Hash: second}}))
+	_, err = repository.GetURLByID(ctx, link.ID)
+	assert.ErrorIs(t, err, ErrGone)
+}
+
+func testOwnedLink(t *testing.T, repository services.RepositoryInterface) {
+	ctx := context.Background()
+	past := time.Now().Add(-time.Hour)
+
+	link := newTestLink(uniqueURL("owned"))
+	expired := newTestLink(uniqueURL("owned-expired"))
+	expired.Hash = link.Hash
+	expired.ExpiresAt = &past
+	require.NoError(t, repository.AddURLSBatch(ctx, []*models.Link{link, expired}))
+
+	owned, err := repository.GetOwnedLink(ctx, link.ID, link.Hash)
+	require.NoError(t, err)
+	require.NotNil(t, owned)
+	assert.Equal(t, link.BaseURL, owned.BaseURL)
+
+	// чужая и несуществующая ссылки не отличаются
+	owned, err = repository.GetOwnedLink(ctx, link.ID, randomString())
+	require.NoError(t, err)
+	assert.Nil(t, owned)
+
+	owned, err = repository.GetOwnedLink(ctx, randomString(), link.Hash)
+	require.NoError(t, err)
+	assert.Nil(t, owned)
+
+	// истёкшая и удалённая ссылки остаются доступны владельцу
+	owned, err = repository.GetOwnedLink(ctx, expired.ID, link.Hash)
+	require.NoError(t, err)
+	require.NotNil(t, owned)
+	assert.Equal(t, expired.ID, owned.ID)
+
+	require.NoError(t, repository.DeleteURLS(ctx, []*models.Link{{ID: link.ID, Hash: link.Hash}}))
+	owned, err = repository.GetOwnedLink(ctx, link.ID, link.Hash)
+	require.NoError(t, err)
+	require.NotNil(t, owned)
+	assert.Equal(t, link.ID, owned.ID)
+}
+
+func testExpiration(t *testing.T, repository services.RepositoryInterface) {
+	ctx := context.Background()
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	expired := newTestLink(uniqueURL("expired"))
+	expired.ExpiresAt = &past
+	active := newTestLink(uniqueURL("active"))
+	active.Hash = expired.Hash
+	active.ExpiresAt = &future
+
+	require.NoError(t, repository.AddURLSBatch(ctx, []*models.Link{expired, active}))
+
+	_, err := repository.GetURLByID(ctx, expired.ID)
+	assert.ErrorIs(t, err, ErrGone)
+
+	links, err := repository.GetAllURLSByHash(ctx, expired.Hash)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, active.ID, links[0].ID)
+	require.NotNil(t, links[0].ExpiresAt)
+	assert.WithinDuration(t, future, *links[0].ExpiresAt, time.Second)
+
+	count, err := repository.DeleteExpiredURLS(ctx, time.Now())
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, count, 1)
+
+	// после очистки ссылка удалена полностью, а её URL снова можно сократить
+	_, err = repository.GetURLByID(ctx, expired.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	exist, err := repository.CheckBaseURLExist(ctx, newTestLink(expired.BaseURL))
+	require.NoError(t, err)
+	assert.False(t, exist)
+
+	url, err := repository.GetURLByID(ctx, active.ID)
+	require.NoError(t, err)
+	assert.Equal(t, active.BaseURL, url)
+}
+
+func testClicks(t *testing.T, repository services.RepositoryInterface) {
+	ctx := context.Background()
+	link := newTestLink(uniqueURL("clicks"))
+
+	require.NoError(t, repository.AddURL(ctx, link))
+
+	// переходы по несуществующим ссылкам игнорируются
+	require.NoError(t, repository.AddClicks(ctx, map[string]int64{link.ID: 3, randomString(): 1}))
+	require.NoError(t, repository.AddClicks(ctx, map[string]int64{link.ID: 2}))
+
+	links, err := repository.GetAllURLSByHash(ctx, link.Hash)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, int64(5), links[0].Clicks)
+}
+
+func testClickStats(t *testing.T, repository services.RepositoryInterface) {
+	ctx := context.Background()
+	link := newTestLink(uniqueURL("click-stats"))
+	bucket := time.Now().UTC().Truncate(time.Hour)
+
+	require.NoError(t, repository.AddURL(ctx, link))
+
+	// события по несуществующим ссылкам не сохраняются
+	require.NoError(t, repository.AddClickEvents(ctx, []*models.ClickEvent{
+		{LinkID: link.ID, Time: bucket, Referrer: "https://google.com", UserAgent: "curl/8.1.2"},
+		{LinkID: link.ID, Time: bucket, UserAgent: "curl/8.1.2"},
+		{LinkID: randomString(), Time: bucket},
+	}))
+
+	pending, err := repository.GetPendingClickEvents(ctx, 1000)
+	require.NoError(t, err)
+
+	var ids []int64
+	for _, v := range pending {
+		if v.LinkID == link.ID {
+			assert.NotZero(t, v.ID)
+			ids = append(ids, v.ID)
+		}
+	}
+	require.Len(t, ids, 2)
+
+	counters := []*models.StatsCounter{
+		{LinkID: link.ID, Bucket: bucket, Dimension: models.DimensionTraffic, Value: models.TrafficBot, Count: 2},
+	}
+	require.NoError(t, repository.SaveClickStats(ctx, ids, counters))
+
+	// повторный учёт тех же событий недопустим
+	assert.ErrorIs(t, repository.SaveClickStats(ctx, ids, counters), ErrConflict)
+
+	stats, err := repository.GetClickStats(ctx, link.ID)
+	require.NoError(t, err)
+	require.Len(t, stats, 1)
+	assert.Equal(t, int64(2), stats[0].Count)
+	assert.True(t, bucket.Equal(stats[0].Bucket))
+
+	pending, err = repository.GetPendingClickEvents(ctx, 1000)
+	require.NoError(t, err)
+	for _, v := range pending {
+		assert.NotEqual(t, link.ID, v.LinkID)
+	}
+
+	count, err := repository.DeleteClickEvents(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, count, 2)
+}
+
+func testSequence(t *testing.T, repository services.RepositoryInterface) {
+	ctx := context.Background()
+
+	// значения растут и не повторяются, в том числе при конкурентных запросах
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	values := make(map[uint64]struct{})
+	var last uint64
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 10; j++ {
+				n, err := repository.NextID(ctx)
+				if !assert.NoError(t, err) {
+					return
+				}
+
+				mutex.Lock()
+				_, ok := values[n]
+				assert.False(t, ok, "duplicate sequence value %d", n)
+				values[n] = struct{}{}
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, values, 100)
+
+	for n := range values {
+		if n > last {
+			last = n
+		}
+	}
+
+	n, err := repository.NextID(ctx)
+	require.NoError(t, err)
+	assert.Greater(t, n, last)
+
+	// блоки не пересекаются друг с другом и со значениями NextID
+	first, err := repository.ReserveIDBlock(ctx, 10)
+	require.NoError(t, err)
+	assert.Greater(t, first, n)
+
+	second, err := repository.ReserveIDBlock(ctx, 10)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, second, first+10)
+
+	n, err = repository.NextID(ctx)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, n, second+10)
+
+	// чтение текущего значения не сдвигает последовательность
+	for i := 0; i < 2; i++ {
+		current, err := repository.CurrentID(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, n, current)
+	}
+}
+
+func testListAndImport(t *testing.T, repository services.RepositoryInterface) {
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	expiredAt := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	owners := []string{randomString(), randomString(), randomString()}
+	sort.Strings(owners)
+
+	active := &models.LinkRecord{
+		Link:   models.Link{ID: randomString(), BaseURL: uniqueURL("import"), CorrelationID: "first", ExpiresAt: &expiresAt, Clicks: 3},
+		Owners: owners[:2],
+	}
+	deleted := &models.LinkRecord{
+		Link:    models.Link{ID: randomString(), BaseURL: uniqueURL("import-deleted")},
+		Owners:  owners[:1],
+		Deleted: true,
+	}
+	expired := &models.LinkRecord{
+		Link:   models.Link{ID: randomString(), BaseURL: uniqueURL("import-expired"), ExpiresAt: &expiredAt},
+		Owners: owners[:1],
+	}
+	require.NoError(t, repository.ImportURLS(ctx, []*models.LinkRecord{active, deleted, expired}, models.ImportOptions{}))
+	assert.Equal(t, models.LinkCreated, active.Status)
+	assert.Equal(t, models.LinkCreated, deleted.Status)
+	assert.Equal(t, models.LinkCreated, expired.Status)
+
+	for _, id := range []string{deleted.ID, expired.ID} {
+		_, err := repository.GetURLByID(ctx, id)
+		assert.ErrorIs(t, err, ErrGone)
+	}
+
+	links, err := repository.GetAllURLSByHash(ctx, owners[1])
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, active.ID, links[0].ID)
+	assert.Equal(t, "first", links[0].CorrelationID)
+	assert.Equal(t, int64(3), links[0].Clicks)
+
+	// повторный импорт добавляет владельцев, занятые ID и URL не перезаписываются
+	again := &models.LinkRecord{Link: active.Link, Owners: owners[2:]}
+	takenID := &models.LinkRecord{Link: models.Link{ID: active.ID, BaseURL: uniqueURL("import-taken")}}
+	takenURL := &models.LinkRecord{Link: models.Link{ID: randomString(), BaseURL: active.BaseURL}}
+	require.NoError(t, repository.ImportURLS(ctx, []*models.LinkRecord{again, takenID, takenURL}, models.ImportOptions{}))
+	assert.Equal(t, models.LinkExisted, again.Status)
+	assert.Equal(t, models.LinkConflict, takenID.Status)
+	assert.Equal(t, models.LinkConflict, takenURL.Status)
+
+	_, err = repository.GetURLByID(ctx, takenURL.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// постраничное чтение возвращает все записи в порядке возрастания ID
+	found := make(map[string]*models.LinkRecord)
+	after := ""
+	for {
+		records, err := repository.ListURLS(ctx, after, 2)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(records), 2)
+		if len(records) == 0 {
+			break
+		}
+
+		for _, v := range records {
+			assert.Greater(t, v.ID, after)
+			after = v.ID
+			found[v.ID] = v
+		}
+	}
+
+	require.Contains(t, found, active.ID)
+	assert.Equal(t, active.BaseURL, found[active.ID].BaseURL)
+	assert.Equal(t, "first", found[active.ID].CorrelationID)
+	assert.Equal(t, int64(3), found[active.ID].Clicks)
+	require.NotNil(t, found[active.ID].ExpiresAt)
+	assert.True(t, expiresAt.Equal(*found[active.ID].ExpiresAt))
+	assert.Equal(t, owners, found[active.ID].Owners)
+	assert.False(t, found[active.ID].Deleted)
+
+	require.Contains(t, found, deleted.ID)
+	assert.Equal(t, owners[:1], found[deleted.ID].Owners)
+	assert.True(t, found[deleted.ID].Deleted)
+
+	require.Contains(t, found, expired.ID)
+	require.NotNil(t, found[expired.ID].ExpiresAt)
+	assert.True(t, expiredAt.Equal(*found[expired.ID].ExpiresAt))
+	assert.False(t, found[expired.ID].Deleted)
+}
+
+func testImportOverwrite(t *testing.T, repository services.RepositoryInterface) {
+	ctx := context.Background()
+	createdAt := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+
+	stored := newTestLink(uniqueURL("overwrite"))
+	require.NoError(t, repository.AddURL(ctx, stored))
+	other := newTestLink(uniqueURL("overwrite-other"))
+	require.NoError(t, repository.AddURL(ctx, other))
+
+	replacement := &models.LinkRecord{
+		Link:   models.Link{ID: stored.ID, BaseURL: uniqueURL("overwrite-new"), CorrelationID: "new", CreatedAt: createdAt, Clicks: 5},
+		Owners: []string{"replacement"},
+	}
+	takenURL := &models.LinkRecord{Link: models.Link{ID: other.ID, BaseURL: stored.BaseURL}, Owners: []string{"replacement"}}
+	created := &models.LinkRecord{Link: models.Link{ID: randomString(), BaseURL: uniqueURL("overwrite-created")}, Owners: []string{"replacement"}}
+
+	// с DryRun результат определяется, но хранилище не меняется
+	records := []*models.LinkRecord{replacement, takenURL, created}
+	require.NoError(t, repository.ImportURLS(ctx, records, models.ImportOptions{Overwrite: true, DryRun: true}))
+	assert.Equal(t, []string{models.LinkOverwritten, models.LinkConflict, models.LinkCreated},
+		[]string{replacement.Status, takenURL.Status, created.Status})
+
+	url, err := repository.GetURLByID(ctx, stored.ID)
+	require.NoError(t, err)
+	assert.Equal(t, stored.BaseURL, url)
+	_, err = repository.GetURLByID(ctx, created.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, repository.ImportURLS(ctx, records, models.ImportOptions{Overwrite: true}))
+	assert.Equal(t, []string{models.LinkOverwritten, models.LinkConflict, models.LinkCreated},
+		[]string{replacement.Status, takenURL.Status, created.Status})
+
+	url, err = repository.GetURLByID(ctx, stored.ID)
+	require.NoError(t, err)
+	assert.Equal(t, replacement.BaseURL, url)
+
+	// перезаписанная ссылка заменяет владельцев, прежний владелец её больше не видит
+	_, err = repository.GetAllURLSByHash(ctx, stored.Hash)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	links, err := repository.GetAllURLSByHash(ctx, "replacement")
+	require.NoError(t, err)
+	ids := make(map[string]*models.Link)
+	for _, v := range links {
+		ids[v.ID] = v
+	}
+	require.Contains(t, ids, stored.ID)
+	require.Contains(t, ids, created.ID)
+	assert.Equal(t, "new", ids[stored.ID].CorrelationID)
+	assert.Equal(t, int64(5), ids[stored.ID].Clicks)
+	assert.True(t, createdAt.Equal(ids[stored.ID].CreatedAt))
+	assert.False(t, ids[created.ID].CreatedAt.IsZero())
+
+	// освободившийся URL можно сократить заново
+	existed, err := repository.UpsertURL(ctx, newTestLink(stored.BaseURL))
+	require.NoError(t, err)
+	assert.False(t, existed)
+}
+
+func testPing(t *testing.T, repository services.RepositoryInterface) {
+	assert.NoError(t, repository.Ping(context.Background()))
+}
+
+func testContextCancellation(t *testing.T, repository services.RepositoryInterface) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	link := newTestLink(uniqueURL("cancelled"))
+
+	assert.Error(t, repository.AddURL(ctx, link))
+	assert.Error(t, repository.AddURLSBatch(ctx, []*models.Link{link}))
+	assert.Error(t, repository.UpdateHash(ctx, link))
+	assert.Error(t, repository.DeleteURLS(ctx, []*models.Link{link}))
+
+	assert.Error(t, repository.AddClicks(ctx, map[string]int64{link.ID: 1}))
+	assert.Error(t, repository.AddClickEvents(ctx, []*models.ClickEvent{{LinkID: link.ID, Time: time.Now()}}))
+
+	_, err := repository.DeleteExpiredURLS(ctx, time.Now())
+	assert.Error(t, err)
+
+	_, err = repository.GetURLByID(ctx, link.ID)
+	assert.Error(t, err)
+
+	_, err = repository.GetAllURLSByHash(ctx, link.Hash)
+	assert.Error(t, err)
+
+	_, err = repository.CheckBaseURLExist(ctx, link)
+	assert.Error(t, err)
+
+	_, err = repository.UpsertURL(ctx, link)
+	assert.Error(t, err)
+
+	_, err = repository.NextID(ctx)
+	assert.Error(t, err)
+
+	_, err = repository.ReserveIDBlock(ctx, 10)
+	assert.Error(t, err)
+
+	_, err = repository.ListURLS(ctx, "", 10)
+	assert.Error(t, err)
+
+	assert.Error(t, repository.ImportURLS(ctx, []*models.LinkRecord{{Link: *link, Owners: []string{link.Hash}}}, models.ImportOptions{}))
+	assert.Error(t, repository.Ping(ctx))
+
+	// запись, переданная с отменённым контекстом, не должна сохраниться
+	_, err = repository.GetURLByID(context.Background(), link.ID)
+	assert.Error(t, err)
+}
+
+func testConcurrentWriters(t *testing.T, repository services.RepositoryInterface) {
+	const writers = 20
+
+	ctx := context.Background()
+	owned := newTestLink(uniqueURL("concurrent-owned"))
+	shared := uniqueURL("concurrent-shared")
+	sharedID := randomString()
+	links := make([]*models.Link, writers)
+	sharedErrs := make([]error, writers)
+	sharedIDErrs := make([]error, writers)
+
+	require.NoError(t, repository.AddURL(ctx, owned))
+
+	for i := range links {
+		links[i] = newTestLink(uniqueURL(fmt.Sprintf("concurrent-%d", i)))
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			assert.NoError(t, repository.AddURL(ctx, links[i]))
+			assert.NoError(t, repository.UpdateHash(ctx, &models.Link{BaseURL: owned.BaseURL, Hash: links[i].Hash}))
+			sharedErrs[i] = repository.AddURL(ctx, newTestLink(shared))
+
+			aliasLink := newTestLink(uniqueURL(fmt.Sprintf("concurrent-alias-%d", i)))
+			aliasLink.ID = sharedID
+			sharedIDErrs[i] = repository.AddURL(ctx, aliasLink)
+		}(i)
+	}
+	wg.Wait()
+
+	// каждая запись доступна по ID, а у каждого пользователя есть своя ссылка и общая ссылка owned
+	for _, v := range links {
+		url, err := repository.GetURLByID(ctx, v.ID)
+		require.NoError(t, err)
+		assert.Equal(t, v.BaseURL, url)
+
+		result, err := repository.GetAllURLSByHash(ctx, v.Hash)
+		require.NoError(t, err)
+		assert.Len(t, result, 2)
+	}
+
+	// один и тот же URL и один и тот же ID должны быть сохранены ровно один раз
+	for _, errs := range [][]error{sharedErrs, sharedIDErrs} {
+		var stored int
+		for _, err := range errs {
+			if err == nil {
+				stored++
+				continue
+			}
+			assert.ErrorIs(t, err, ErrConflict)
+		}
+		assert.Equal(t, 1, stored)
+	}
+}
+
+// newTestLink - создание ссылки с уникальными ID и хешем
+func newTestLink(baseURL string) *models.Link {
+	return &models.Link{
+		ID:      randomString(),
+		BaseURL: baseURL,
+		Hash:    randomString(),
+	}
+}
+
+// uniqueURL - URL со случайным путём, чтобы тесты не конфликтовали с данными, оставшимися в БД от предыдущих запусков
+func uniqueURL(name string) string {
+	return fmt.Sprintf("https://%s.com/%s", name, randomString())
+}
+
+// randomString - случайная строка длиной 10 символов (ограничение длины id в БД)
+func randomString() string {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
@@ -3,24 +3,96 @@ package config
 import (
 	"flag"
 	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/caarlos0/env"
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
+// defaultBaseURL - базовый адрес коротких ссылок по умолчанию
+const defaultBaseURL = "http://localhost:8080"
+
 type Config struct {
 	Server struct {
 		Address string `yaml:"address"`
-		Port    int    `yaml:"port"`
+		// адреса пользовательского API и внутренних эндпоинтов, без APIAddress все маршруты обслуживаются на Address,
+		// без InternalAddress внутренние эндпоинты обслуживаются на APIAddress
+		APIAddress      string        `yaml:"apiAddress"`
+		InternalAddress string        `yaml:"internalAddress"`
+		Port            int           `yaml:"port"`
+		ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+		// таймауты и ограничения http.Server, нулевые значения заменяются значениями по умолчанию
+		ReadTimeout       time.Duration `yaml:"readTimeout"`
+		ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout"`
+		WriteTimeout      time.Duration `yaml:"writeTimeout"`
+		IdleTimeout       time.Duration `yaml:"idleTimeout"`
+		MaxHeaderBytes    int64         `yaml:"maxHeaderBytes"`
+		// таймаут чтения запроса и записи ответа для выгрузки и загрузки ссылок через /admin, заменяет ReadTimeout и WriteTimeout
+		AdminTimeout time.Duration `yaml:"adminTimeout"`
+		// максимальный размер тела запроса в байтах по маршрутам
+		BodyLimit struct {
+			Shorten int64 `yaml:"shorten"`
+			Batch   int64 `yaml:"batch"`
+			Delete  int64 `yaml:"delete"`
+			Import  int64 `yaml:"import"`
+		} `yaml:"bodyLimit"`
+		// HTTPS: без путей к сертификату и ключу используется самоподписанный сертификат из CertCacheDir,
+		// RedirectAddress - необязательный адрес HTTP сервера, перенаправляющего запросы на HTTPS
+		HTTPS struct {
+			Enabled         bool   `yaml:"enabled"`
+			CertFile        string `yaml:"certFile"`
+			KeyFile         string `yaml:"keyFile"`
+			CertCacheDir    string `yaml:"certCacheDir"`
+			RedirectAddress string `yaml:"redirectAddress"`
+		} `yaml:"https"`
 	} `yaml:"server"`
 	App struct {
 		ShortedURLLen uint8  `yaml:"shortedURLLen"`
+		IDAttempts    int    `yaml:"idAttempts"`
+		IDStrategy    string `yaml:"idStrategy"`
 		BaseURL       string `yaml:"baseURL"`
 		FileStorage   string `yaml:"fileStorage"`
 		SecretKey     string `yaml:"secretKey"`
+		AdminToken    string `yaml:"adminToken"`
+		Hashids       struct {
+			Salt      string `yaml:"salt"`
+			MinLength int    `yaml:"minLength"`
+		} `yaml:"hashids"`
+		IDBlock struct {
+			Size   int     `yaml:"size"`
+			Refill float64 `yaml:"refill"`
+		} `yaml:"idBlock"`
+		Delete struct {
+			Workers       int           `yaml:"workers"`
+			BatchSize     int           `yaml:"batchSize"`
+			FlushInterval time.Duration `yaml:"flushInterval"`
+		} `yaml:"delete"`
+		Expire struct {
+			SweepInterval time.Duration `yaml:"sweepInterval"`
+			Retention     time.Duration `yaml:"retention"`
+		} `yaml:"expire"`
+		Clicks struct {
+			BufferSize    int           `yaml:"bufferSize"`
+			BatchSize     int           `yaml:"batchSize"`
+			FlushInterval time.Duration `yaml:"flushInterval"`
+		} `yaml:"clicks"`
+		Stats struct {
+			RollupInterval  time.Duration `yaml:"rollupInterval"`
+			RollupBatchSize int           `yaml:"rollupBatchSize"`
+			Retention       time.Duration `yaml:"retention"`
+			TopReferrers    int           `yaml:"topReferrers"`
+		} `yaml:"stats"`
+		Cache struct {
+			Size        int           `yaml:"size"`
+			TTL         time.Duration `yaml:"ttl"`
+			NegativeTTL time.Duration `yaml:"negativeTTL"`
+		} `yaml:"cache"`
 	} `yaml:"app"`
 	DB struct {
-		CDN string `yaml:"cdn"`
+		CDN         string `yaml:"cdn"`
+		AutoMigrate bool   `yaml:"autoMigrate"`
 	} `yaml:"db"`
 }
 
@@ -29,6 +101,28 @@ type Environment struct {
 	BaseURL       string `env:"BASE_URL"`
 	FileStorage   string `env:"FILE_STORAGE_PATH"`
 	DatabaseDSN   string `env:"DATABASE_DSN"`
+	AutoMigrate   string `env:"DB_AUTO_MIGRATE"`
+	AdminToken    string `env:"ADMIN_TOKEN"`
+
+	ReadTimeout       string `env:"SERVER_READ_TIMEOUT"`
+	ReadHeaderTimeout string `env:"SERVER_READ_HEADER_TIMEOUT"`
+	WriteTimeout      string `env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout       string `env:"SERVER_IDLE_TIMEOUT"`
+	AdminTimeout      string `env:"SERVER_ADMIN_TIMEOUT"`
+	MaxHeaderBytes    string `env:"SERVER_MAX_HEADER_BYTES"`
+	BodyLimitShorten  string `env:"BODY_LIMIT_SHORTEN"`
+	BodyLimitBatch    string `env:"BODY_LIMIT_BATCH"`
+	BodyLimitDelete   string `env:"BODY_LIMIT_DELETE"`
+	BodyLimitImport   string `env:"BODY_LIMIT_IMPORT"`
+
+	EnableHTTPS     string `env:"ENABLE_HTTPS"`
+	TLSCertFile     string `env:"TLS_CERT_FILE"`
+	TLSKeyFile      string `env:"TLS_KEY_FILE"`
+	TLSCertCacheDir string `env:"TLS_CERT_CACHE_DIR"`
+	RedirectAddress string `env:"HTTP_REDIRECT_ADDRESS"`
+
+	APIAddress      string `env:"API_ADDRESS"`
+	InternalAddress string `env:"INTERNAL_ADDRESS"`
 }
 
 type Flags struct {
@@ -36,6 +130,25 @@ type Flags struct {
 	BaseURL       string
 	FileStorage   string
 	DatabaseDSN   string
+
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	AdminTimeout      time.Duration
+	MaxHeaderBytes    int64
+	BodyLimitShorten  int64
+	BodyLimitBatch    int64
+	BodyLimitDelete   int64
+	BodyLimitImport   int64
+
+	EnableHTTPS     bool
+	TLSCertFile     string
+	TLSKeyFile      string
+	RedirectAddress string
+
+	APIAddress      string
+	InternalAddress string
 }
 
 // GetConfig - функция получения конфига приложения
@@ -60,10 +173,31 @@ func GetConfig(log *zap.SugaredLogger, path string, fl *Flags) *Config {
 		cfg.Server.Address = fl.ServerAddress
 	}
 
+	switch {
+	case environment.EnableHTTPS != "":
+		cfg.Server.HTTPS.Enabled, err = strconv.ParseBool(environment.EnableHTTPS)
+		if err != nil {
+			log.Fatalf("can't parse ENABLE_HTTPS! %s", err)
+		}
+	case fl.EnableHTTPS:
+		cfg.Server.HTTPS.Enabled = true
+	}
+
+	overrideString(environment.TLSCertFile, fl.TLSCertFile, &cfg.Server.HTTPS.CertFile)
+	overrideString(environment.TLSKeyFile, fl.TLSKeyFile, &cfg.Server.HTTPS.KeyFile)
+	overrideString(environment.TLSCertCacheDir, "", &cfg.Server.HTTPS.CertCacheDir)
+	overrideString(environment.RedirectAddress, fl.RedirectAddress, &cfg.Server.HTTPS.RedirectAddress)
+	overrideString(environment.APIAddress, fl.APIAddress, &cfg.Server.APIAddress)
+	overrideString(environment.InternalAddress, fl.InternalAddress, &cfg.Server.InternalAddress)
+
 	if environment.BaseURL != "" {
 		cfg.App.BaseURL = environment.BaseURL
 	} else {
 		cfg.App.BaseURL = fl.BaseURL
+		// в режиме HTTPS базовый адрес по умолчанию использует схему https
+		if cfg.Server.HTTPS.Enabled && fl.BaseURL == defaultBaseURL {
+			cfg.App.BaseURL = "https://" + strings.TrimPrefix(defaultBaseURL, "http://")
+		}
 	}
 
 	if environment.FileStorage != "" {
@@ -78,6 +212,29 @@ func GetConfig(log *zap.SugaredLogger, path string, fl *Flags) *Config {
 		cfg.DB.CDN = fl.DatabaseDSN
 	}
 
+	if environment.AutoMigrate != "" {
+		cfg.DB.AutoMigrate, err = strconv.ParseBool(environment.AutoMigrate)
+		if err != nil {
+			log.Fatalf("can't parse DB_AUTO_MIGRATE! %s", err)
+		}
+	}
+
+	if environment.AdminToken != "" {
+		cfg.App.AdminToken = environment.AdminToken
+	}
+
+	// таймауты и лимиты сервера: переменная окружения, затем заданный флаг, иначе значение из файла конфига
+	overrideDuration(log, "SERVER_READ_TIMEOUT", environment.ReadTimeout, fl.ReadTimeout, &cfg.Server.ReadTimeout)
+	overrideDuration(log, "SERVER_READ_HEADER_TIMEOUT", environment.ReadHeaderTimeout, fl.ReadHeaderTimeout, &cfg.Server.ReadHeaderTimeout)
+	overrideDuration(log, "SERVER_WRITE_TIMEOUT", environment.WriteTimeout, fl.WriteTimeout, &cfg.Server.WriteTimeout)
+	overrideDuration(log, "SERVER_IDLE_TIMEOUT", environment.IdleTimeout, fl.IdleTimeout, &cfg.Server.IdleTimeout)
+	overrideDuration(log, "SERVER_ADMIN_TIMEOUT", environment.AdminTimeout, fl.AdminTimeout, &cfg.Server.AdminTimeout)
+	overrideBytes(log, "SERVER_MAX_HEADER_BYTES", environment.MaxHeaderBytes, fl.MaxHeaderBytes, &cfg.Server.MaxHeaderBytes)
+	overrideBytes(log, "BODY_LIMIT_SHORTEN", environment.BodyLimitShorten, fl.BodyLimitShorten, &cfg.Server.BodyLimit.Shorten)
+	overrideBytes(log, "BODY_LIMIT_BATCH", environment.BodyLimitBatch, fl.BodyLimitBatch, &cfg.Server.BodyLimit.Batch)
+	overrideBytes(log, "BODY_LIMIT_DELETE", environment.BodyLimitDelete, fl.BodyLimitDelete, &cfg.Server.BodyLimit.Delete)
+	overrideBytes(log, "BODY_LIMIT_IMPORT", environment.BodyLimitImport, fl.BodyLimitImport, &cfg.Server.BodyLimit.Import)
+
 	log.Info("config received successfully")
 
 	return &cfg
@@ -87,9 +244,65 @@ func GetFlags() *Flags {
 	var fl Flags
 
 	flag.StringVar(&fl.ServerAddress, "a", "localhost:8080", "server address")
-	flag.StringVar(&fl.BaseURL, "b", "http://localhost:8080", "base url")
+	flag.StringVar(&fl.BaseURL, "b", defaultBaseURL, "base url")
 	flag.StringVar(&fl.FileStorage, "f", "", "file storage")
 	flag.StringVar(&fl.DatabaseDSN, "d", "", "DatabaseDSN")
 
+	flag.DurationVar(&fl.ReadTimeout, "read-timeout", 0, "max duration for reading the entire request")
+	flag.DurationVar(&fl.ReadHeaderTimeout, "read-header-timeout", 0, "max duration for reading request headers")
+	flag.DurationVar(&fl.WriteTimeout, "write-timeout", 0, "max duration before timing out writes of the response")
+	flag.DurationVar(&fl.IdleTimeout, "idle-timeout", 0, "max time to wait for the next request on a keep-alive connection")
+	flag.DurationVar(&fl.AdminTimeout, "admin-timeout", 0, "max duration for reading and writing /admin export and import")
+	flag.Int64Var(&fl.MaxHeaderBytes, "max-header-bytes", 0, "max size of request headers in bytes")
+	flag.Int64Var(&fl.BodyLimitShorten, "body-limit-shorten", 0, "max request body size in bytes for POST / and /api/shorten")
+	flag.Int64Var(&fl.BodyLimitBatch, "body-limit-batch", 0, "max request body size in bytes for /api/shorten/batch")
+	flag.Int64Var(&fl.BodyLimitDelete, "body-limit-delete", 0, "max request body size in bytes for DELETE /api/user/urls")
+	flag.Int64Var(&fl.BodyLimitImport, "body-limit-import", 0, "max request body size in bytes for /admin/import")
+
+	flag.BoolVar(&fl.EnableHTTPS, "s", false, "enable HTTPS")
+	flag.StringVar(&fl.TLSCertFile, "tls-cert", "", "TLS certificate file, a self-signed certificate is generated if empty")
+	flag.StringVar(&fl.TLSKeyFile, "tls-key", "", "TLS private key file")
+	flag.StringVar(&fl.RedirectAddress, "http-redirect", "", "address of the plain HTTP listener redirecting to HTTPS")
+	flag.StringVar(&fl.APIAddress, "api-address", "", "address of the user API, served on the main address if empty")
+	flag.StringVar(&fl.InternalAddress, "internal-address", "", "address of internal endpoints, served on the API address if empty")
+
 	return &fl
 }
+
+// overrideString - замена строки из файла конфига значением переменной окружения или заданного флага
+func overrideString(envValue, flagValue string, target *string) {
+	switch {
+	case envValue != "":
+		*target = envValue
+	case flagValue != "":
+		*target = flagValue
+	}
+}
+
+// overrideDuration - замена длительности из файла конфига значением переменной окружения или заданного флага
+func overrideDuration(log *zap.SugaredLogger, name, envValue string, flagValue time.Duration, target *time.Duration) {
+	switch {
+	case envValue != "":
+		value, err := time.ParseDuration(envValue)
+		if err != nil {
+			log.Fatalf("can't parse %s! %s", name, err)
+		}
+		*target = value
+	case flagValue != 0:
+		*target = flagValue
+	}
+}
+
+// overrideBytes - замена размера в байтах из файла конфига значением переменной окружения или заданного флага
+func overrideBytes(log *zap.SugaredLogger, name, envValue string, flagValue int64, target *int64) {
+	switch {
+	case envValue != "":
+		value, err := strconv.ParseInt(envValue, 10, 64)
+		if err != nil {
+			log.Fatalf("can't parse %s! %s", name, err)
+		}
+		*target = value
+	case flagValue != 0:
+		*target = flagValue
+	}
+}
@@ -1,19 +1,41 @@
 package pkg
 
 import (
-	"math/rand"
-	"time"
+	"crypto/rand"
+	"errors"
+	"fmt"
 )
 
-// GenerateRandomString - функция генерации короткого URL/cookie
-func GenerateRandomString() string {
-	rand.Seed(time.Now().UnixNano())
-	chars := []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0987654321")
-	str := make([]rune, 10)
+const chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0987654321"
 
-	for i := range str {
-		str[i] = chars[rand.Intn(len(chars))]
+// maxUnbiasedByte - байты не меньше этого значения отбрасываются, чтобы все символы выпадали равновероятно
+const maxUnbiasedByte = 256 - 256%len(chars)
+
+// GenerateRandomString - функция генерации короткого URL/cookie заданной длины на основе crypto/rand
+func GenerateRandomString(length int) (string, error) {
+	if length <= 0 {
+		return "", errors.New("length must be positive")
+	}
+
+	res := make([]byte, 0, length)
+	buf := make([]byte, length)
+
+	for len(res) < length {
+		if _, err := rand.Read(buf); err != nil {
+			return "", fmt.Errorf("can't read random bytes, err: %s", err)
+		}
+
+		for _, v := range buf {
+			if int(v) >= maxUnbiasedByte {
+				continue
+			}
+
+			res = append(res, chars[int(v)%len(chars)])
+			if len(res) == length {
+				break
+			}
+		}
 	}
 
-	return string(str)
+	return string(res), nil
 }
@@ -0,0 +1,51 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateRandomString(t *testing.T) {
+	tests := []struct {
+		name    string
+		length  int
+		wantErr bool
+	}{
+		{name: "short", length: 1},
+		{name: "default", length: 10},
+		{name: "long", length: 64},
+		{name: "zero", length: 0, wantErr: true},
+		{name: "negative", length: -1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := GenerateRandomString(tt.length)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Len(t, res, tt.length)
+			for _, v := range res {
+				assert.True(t, strings.ContainsRune(chars, v))
+			}
+		})
+	}
+}
+
+func TestGenerateRandomStringUnique(t *testing.T) {
+	generated := make(map[string]struct{})
+	for i := 0; i < 10000; i++ {
+		res, err := GenerateRandomString(10)
+		require.NoError(t, err)
+
+		_, ok := generated[res]
+		require.False(t, ok, "duplicate id %s", res)
+		generated[res] = struct{}{}
+	}
+}
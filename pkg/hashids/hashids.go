@@ -0,0 +1,198 @@
+/*
+Package hashids - реализация кодирования чисел в короткие строки по алгоритму Hashids (https://hashids.org).
+Результат совместим с эталонными реализациями при тех же соли, алфавите и минимальной длине
+*/
+package hashids
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// параметры алгоритма по умолчанию
+const (
+	DefaultAlphabet   = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890"
+	defaultSeparators = "cfhistuCFHISTU"
+	minAlphabetLength = 16
+	separatorDiv      = 3.5
+	guardDiv          = 12.0
+)
+
+// HashID - кодировщик с подготовленными по соли алфавитом, разделителями и guard-символами
+type HashID struct {
+	salt       []rune
+	minLength  int
+	alphabet   []rune
+	separators []rune
+	guards     []rune
+}
+
+// New - функция создания кодировщика с алфавитом по умолчанию
+func New(salt string, minLength int) (*HashID, error) {
+	return NewWithAlphabet(salt, minLength, DefaultAlphabet)
+}
+
+// NewWithAlphabet - функция создания кодировщика с собственным алфавитом
+func NewWithAlphabet(salt string, minLength int, alphabet string) (*HashID, error) {
+	if minLength < 0 {
+		return nil, errors.New("min length must not be negative")
+	}
+
+	unique := make([]rune, 0, len(alphabet))
+	seen := make(map[rune]struct{}, len(alphabet))
+	for _, v := range alphabet {
+		if v == ' ' {
+			return nil, errors.New("alphabet must not contain spaces")
+		}
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		unique = append(unique, v)
+	}
+
+	if len(unique) < minAlphabetLength {
+		return nil, fmt.Errorf("alphabet must contain at least %d unique characters", minAlphabetLength)
+	}
+
+	h := &HashID{salt: []rune(salt), minLength: minLength}
+
+	// разделители - только символы алфавита, а сам алфавит их не содержит
+	for _, v := range defaultSeparators {
+		if _, ok := seen[v]; ok {
+			h.separators = append(h.separators, v)
+		}
+	}
+	for _, v := range unique {
+		if !strings.ContainsRune(defaultSeparators, v) {
+			h.alphabet = append(h.alphabet, v)
+		}
+	}
+
+	h.separators = shuffle(h.separators, h.salt)
+
+	if len(h.separators) == 0 || float64(len(h.alphabet))/float64(len(h.separators)) > separatorDiv {
+		separatorsLen := int(math.Ceil(float64(len(h.alphabet)) / separatorDiv))
+		if separatorsLen == 1 {
+			separatorsLen++
+		}
+
+		if separatorsLen > len(h.separators) {
+			diff := separatorsLen - len(h.separators)
+			h.separators = append(h.separators, h.alphabet[:diff]...)
+			h.alphabet = h.alphabet[diff:]
+		} else {
+			h.separators = h.separators[:separatorsLen]
+		}
+	}
+
+	h.alphabet = shuffle(h.alphabet, h.salt)
+
+	guardCount := int(math.Ceil(float64(len(h.alphabet)) / guardDiv))
+	if len(h.alphabet) < 3 {
+		h.guards = h.separators[:guardCount]
+		h.separators = h.separators[guardCount:]
+	} else {
+		h.guards = h.alphabet[:guardCount]
+		h.alphabet = h.alphabet[guardCount:]
+	}
+
+	return h, nil
+}
+
+// Encode - кодирование чисел в строку
+func (h *HashID) Encode(numbers ...uint64) (string, error) {
+	if len(numbers) == 0 {
+		return "", errors.New("passed an empty array of numbers")
+	}
+
+	var numbersID uint64
+	for i, v := range numbers {
+		numbersID += v % uint64(i+100)
+	}
+
+	alphabet := make([]rune, len(h.alphabet))
+	copy(alphabet, h.alphabet)
+
+	lottery := alphabet[numbersID%uint64(len(alphabet))]
+	res := []rune{lottery}
+
+	buffer := make([]rune, 0, 1+len(h.salt)+len(alphabet))
+	for i, v := range numbers {
+		buffer = append(buffer[:0], lottery)
+		buffer = append(buffer, h.salt...)
+		buffer = append(buffer, alphabet...)
+		alphabet = shuffle(alphabet, buffer[:len(alphabet)])
+
+		last := toAlphabet(v, alphabet)
+		res = append(res, last...)
+
+		if i+1 < len(numbers) {
+			v %= uint64(last[0]) + uint64(i)
+			res = append(res, h.separators[v%uint64(len(h.separators))])
+		}
+	}
+
+	if len(res) < h.minLength {
+		guard := h.guards[(numbersID+uint64(res[0]))%uint64(len(h.guards))]
+		res = append([]rune{guard}, res...)
+
+		if len(res) < h.minLength {
+			guard = h.guards[(numbersID+uint64(res[2]))%uint64(len(h.guards))]
+			res = append(res, guard)
+		}
+	}
+
+	half := len(alphabet) / 2
+	for len(res) < h.minLength {
+		alphabet = shuffle(alphabet, alphabet)
+
+		padded := make([]rune, 0, len(res)+len(alphabet))
+		padded = append(padded, alphabet[half:]...)
+		padded = append(padded, res...)
+		padded = append(padded, alphabet[:half]...)
+		res = padded
+
+		if excess := len(res) - h.minLength; excess > 0 {
+			res = res[excess/2 : excess/2+h.minLength]
+		}
+	}
+
+	return string(res), nil
+}
+
+// shuffle - детерминированное перемешивание алфавита солью, возвращает новый срез
+func shuffle(alphabet, salt []rune) []rune {
+	res := make([]rune, len(alphabet))
+	copy(res, alphabet)
+
+	if len(salt) == 0 {
+		return res
+	}
+
+	for i, v, p := len(res)-1, 0, 0; i > 0; i, v = i-1, v+1 {
+		v %= len(salt)
+		integer := int(salt[v])
+		p += integer
+		j := (integer + v + p) % i
+		res[i], res[j] = res[j], res[i]
+	}
+
+	return res
+}
+
+// toAlphabet - запись числа в системе счисления по перемешанному алфавиту
+func toAlphabet(number uint64, alphabet []rune) []rune {
+	var res []rune
+	base := uint64(len(alphabet))
+
+	for {
+		res = append([]rune{alphabet[number%base]}, res...)
+		number /= base
+		if number == 0 {
+			return res
+		}
+	}
+}
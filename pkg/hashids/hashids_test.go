@@ -0,0 +1,93 @@
+package hashids
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name      string
+		salt      string
+		minLength int
+		numbers   []uint64
+		want      string
+	}{
+		{
+			name:    "single_number",
+			salt:    "this is my salt",
+			numbers: []uint64{12345},
+			want:    "NkK9",
+		},
+		{
+			name:    "several_numbers",
+			salt:    "this is my salt",
+			numbers: []uint64{1, 2, 3},
+			want:    "laHquq",
+		},
+		{
+			name:      "min_length",
+			salt:      "this is my salt",
+			minLength: 8,
+			numbers:   []uint64{1},
+			want:      "gB0NV05e",
+		},
+		{
+			name:    "without_salt",
+			numbers: []uint64{1, 2, 3},
+			want:    "o2fXhV",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := New(tt.salt, tt.minLength)
+			require.NoError(t, err)
+
+			res, err := h.Encode(tt.numbers...)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, res)
+		})
+	}
+}
+
+func TestEncodeUnique(t *testing.T) {
+	h, err := New("salt", 6)
+	require.NoError(t, err)
+
+	encoded := make(map[string]struct{})
+	for i := uint64(0); i < 10000; i++ {
+		res, err := h.Encode(i)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, len(res), 6)
+
+		_, ok := encoded[res]
+		require.False(t, ok, "duplicate hash %s for %d", res, i)
+		encoded[res] = struct{}{}
+	}
+}
+
+func TestNewWithAlphabet(t *testing.T) {
+	tests := []struct {
+		name     string
+		alphabet string
+		wantErr  bool
+	}{
+		{name: "default", alphabet: DefaultAlphabet},
+		{name: "short", alphabet: "abcdef", wantErr: true},
+		{name: "with_spaces", alphabet: "abcdefghij klmnopqrstuvwxyz", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewWithAlphabet("salt", 0, tt.alphabet)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
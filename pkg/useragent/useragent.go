@@ -0,0 +1,100 @@
+package useragent
+
+import "strings"
+
+// значения по умолчанию, если по User-Agent не удалось определить браузер или ОС
+const (
+	Other = "Other"
+
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+)
+
+// Agent - результат разбора заголовка User-Agent
+type Agent struct {
+	Browser string
+	OS      string
+	Device  string
+	Bot     bool
+}
+
+// rule - значение, которое определяется по наличию в User-Agent любой из подстрок
+type rule struct {
+	name    string
+	markers []string
+}
+
+// botMarkers - подстроки, по которым User-Agent считается ботом
+var botMarkers = []string{
+	"bot", "crawler", "spider", "slurp", "curl", "wget", "python-requests", "go-http-client",
+	"httpclient", "headless", "facebookexternalhit", "okhttp", "postman",
+}
+
+// browsers - порядок проверки важен: Edge, Opera и другие браузеры на Chromium содержат "chrome/", а Chrome - "safari/"
+var browsers = []rule{
+	{name: "Edge", markers: []string{"edg/", "edge/", "edga/", "edgios/"}},
+	{name: "Opera", markers: []string{"opr/", "opera"}},
+	{name: "Yandex Browser", markers: []string{"yabrowser/"}},
+	{name: "Samsung Internet", markers: []string{"samsungbrowser/"}},
+	{name: "Firefox", markers: []string{"firefox/", "fxios/"}},
+	{name: "Chrome", markers: []string{"chrome/", "crios/"}},
+	{name: "Safari", markers: []string{"safari/"}},
+	{name: "Internet Explorer", markers: []string{"msie ", "trident/"}},
+}
+
+// systems - iOS проверяется раньше macOS, т.к. User-Agent iPad содержит "mac os x", Android - раньше Linux
+var systems = []rule{
+	{name: "Windows", markers: []string{"windows"}},
+	{name: "iOS", markers: []string{"iphone", "ipad", "ipod"}},
+	{name: "Android", markers: []string{"android"}},
+	{name: "macOS", markers: []string{"mac os x", "macintosh"}},
+	{name: "ChromeOS", markers: []string{"cros"}},
+	{name: "Linux", markers: []string{"linux"}},
+}
+
+// Parse - разбор заголовка User-Agent на браузер, ОС и тип устройства. Пустой User-Agent считается ботом
+func Parse(userAgent string) Agent {
+	ua := strings.ToLower(userAgent)
+
+	agent := Agent{
+		Browser: match(ua, browsers),
+		OS:      match(ua, systems),
+		Bot:     ua == "" || containsAny(ua, botMarkers...),
+	}
+
+	switch {
+	case agent.Bot:
+		agent.Device = DeviceBot
+	case containsAny(ua, "ipad", "tablet"), strings.Contains(ua, "android") && !strings.Contains(ua, "mobile"):
+		agent.Device = DeviceTablet
+	case containsAny(ua, "mobi", "iphone", "ipod"):
+		agent.Device = DeviceMobile
+	default:
+		agent.Device = DeviceDesktop
+	}
+
+	return agent
+}
+
+// match - поиск первого подходящего значения из списка по подстрокам
+func match(ua string, rules []rule) string {
+	for _, v := range rules {
+		if containsAny(ua, v.markers...) {
+			return v.name
+		}
+	}
+
+	return Other
+}
+
+func containsAny(s string, substrings ...string) bool {
+	for _, v := range substrings {
+		if strings.Contains(s, v) {
+			return true
+		}
+	}
+
+	return false
+}
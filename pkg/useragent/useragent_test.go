@@ -0,0 +1,62 @@
+package useragent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		want      Agent
+	}{
+		{
+			name:      "chrome_windows",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36",
+			want:      Agent{Browser: "Chrome", OS: "Windows", Device: DeviceDesktop},
+		},
+		{
+			name:      "edge_windows",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36 Edg/118.0.2088.46",
+			want:      Agent{Browser: "Edge", OS: "Windows", Device: DeviceDesktop},
+		},
+		{
+			name:      "safari_iphone",
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1",
+			want:      Agent{Browser: "Safari", OS: "iOS", Device: DeviceMobile},
+		},
+		{
+			name:      "safari_ipad",
+			userAgent: "Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1",
+			want:      Agent{Browser: "Safari", OS: "iOS", Device: DeviceTablet},
+		},
+		{
+			name:      "firefox_android",
+			userAgent: "Mozilla/5.0 (Android 13; Mobile; rv:109.0) Gecko/118.0 Firefox/118.0",
+			want:      Agent{Browser: "Firefox", OS: "Android", Device: DeviceMobile},
+		},
+		{
+			name:      "googlebot",
+			userAgent: "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			want:      Agent{Browser: Other, OS: Other, Device: DeviceBot, Bot: true},
+		},
+		{
+			name:      "curl",
+			userAgent: "curl/8.1.2",
+			want:      Agent{Browser: Other, OS: Other, Device: DeviceBot, Bot: true},
+		},
+		{
+			name:      "empty",
+			userAgent: "",
+			want:      Agent{Browser: Other, OS: Other, Device: DeviceBot, Bot: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Parse(tt.userAgent))
+		})
+	}
+}